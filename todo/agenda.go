@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// AgendaGroup is one heading of the agenda: overdue todos, a single day,
+// everything after the agenda window, or undated todos
+type AgendaGroup struct {
+	Label   string `json:"label"`
+	Date    string `json:"date,omitempty"` // the day, for single-day groups
+	Overdue bool   `json:"overdue,omitempty"`
+	Todos   []Todo `json:"todos"`
+}
+
+// maxAgendaDays bounds how many days ahead an agenda lists day by day
+const maxAgendaDays = 366
+
+// BuildAgenda groups pending todos by due day: overdue first, then one
+// group per day for the next `days` days (empty days are skipped), then
+// later and undated todos. Within a group todos are in due order.
+func BuildAgenda(todos []Todo, now time.Time, days int) []AgendaGroup {
+	today := startOfDay(now)
+	overdue := AgendaGroup{Label: "Overdue", Overdue: true}
+	byDay := make([]AgendaGroup, days)
+	for i := range byDay {
+		day := today.AddDate(0, 0, i)
+		byDay[i] = AgendaGroup{Label: agendaDayLabel(day, i), Date: day.Format(dueDateLayout)}
+	}
+	later := AgendaGroup{Label: "Later"}
+	noDate := AgendaGroup{Label: "No date"}
+
+	sorted := append([]Todo(nil), todos...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].DueDate < sorted[j].DueDate })
+
+	for _, t := range sorted {
+		if t.Done {
+			continue
+		}
+		due, layout, ok := parseDueDate(t.DueDate)
+		if !ok {
+			noDate.Todos = append(noDate.Todos, t)
+			continue
+		}
+		isOverdue := due.Before(today)
+		if layout != dueDateLayout {
+			isOverdue = due.Before(now)
+		}
+		if isOverdue {
+			overdue.Todos = append(overdue.Todos, t)
+			continue
+		}
+		offset := int(startOfDay(due).Sub(today).Hours()+12) / 24 // rounding absorbs DST shifts
+		if offset < days {
+			byDay[offset].Todos = append(byDay[offset].Todos, t)
+		} else {
+			later.Todos = append(later.Todos, t)
+		}
+	}
+
+	var groups []AgendaGroup
+	for _, g := range append(append([]AgendaGroup{overdue}, byDay...), later, noDate) {
+		if len(g.Todos) > 0 {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
+func agendaDayLabel(day time.Time, offset int) string {
+	switch offset {
+	case 0:
+		return "Today"
+	case 1:
+		return "Tomorrow"
+	}
+	return day.Format("Monday 2 Jan")
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The command table. Todos live under `vault todo`, saved content under
+// `vault item`; the flat verbs from before the split still work as
+// deprecated aliases. printVaultUsage and every "Usage:" line are generated
+// from this table, and flags are parsed by parseCommandArgs.
+
+// flagDef is one flag of a command. Arg names the value; boolean flags
+// leave it empty.
+type flagDef struct {
+	Names []string // e.g. {"-p", "--priority"}; the first is shown in usage
+	Arg   string
+}
+
+// command is one CLI verb
+type command struct {
+	Group   string // "todo", "item", "tmux", or "" for top-level commands
+	Name    string
+	Aliases []string // other names within the group
+	Legacy  []string // deprecated top-level verbs that run this command
+	Args    string   // positional arguments, e.g. "<id>"
+	Flags   []flagDef
+	Summary string
+	NoDB    bool // runs before the database is opened
+	Run     func(a *cmdArgs)
+}
+
+var commands []*command
+
+func init() {
+	// Assigned in init so Run funcs may refer back to the table
+	commands = []*command{
+		// Todos
+		{Group: "todo", Name: "add", Legacy: []string{"add"}, Args: "<task>",
+			Flags: []flagDef{{[]string{"-p", "--priority"}, "priority"}, {[]string{"-c", "--category"}, "category"},
+				{[]string{"-d", "--due"}, "due"}, {[]string{"-r", "--repeat"}, "rule"}, {[]string{"--under"}, "id"},
+				{[]string{"--all"}, ""}},
+			Summary: "Add a todo (in the current context unless --all)", Run: handleAdd},
+		{Group: "todo", Name: "list", Aliases: []string{"ls"}, Legacy: []string{"list", "ls"},
+			Flags: []flagDef{{[]string{"-s", "--status"}, "status"}, {[]string{"-p", "--priority"}, "priority"},
+				{[]string{"-c", "--category"}, "category"}, {[]string{"--due"}, "overdue|today|this-week|no-date"},
+				{[]string{"--all"}, ""}},
+			Summary: "List todos as a tree (current context unless --all)", Run: handleList},
+		{Group: "todo", Name: "agenda", Legacy: []string{"agenda"},
+			Flags:   []flagDef{{[]string{"--days"}, "N"}, {[]string{"-c", "--category"}, "category"}, {[]string{"--all"}, ""}},
+			Summary: "Pending todos grouped by due day", Run: handleAgenda},
+		{Group: "todo", Name: "next", Legacy: []string{"next"},
+			Flags:   []flagDef{{[]string{"-c", "--category"}, "category"}, {[]string{"--all"}, ""}},
+			Summary: "Suggest the next actionable todo", Run: handleNext},
+		{Group: "todo", Name: "edit", Args: "<id>",
+			Flags: []flagDef{{[]string{"--task"}, "text"}, {[]string{"-p", "--priority"}, "priority"},
+				{[]string{"-c", "--category"}, "category"}, {[]string{"-d", "--due"}, "due"}, {[]string{"-r", "--repeat"}, "rule"},
+				{[]string{"--under"}, "id"}, {[]string{"--done"}, ""}, {[]string{"--undone"}, ""}, {[]string{"-f", "--force"}, ""}},
+			Summary: "Edit a todo in $EDITOR, or with flags", Run: handleEditTodo},
+		{Group: "todo", Name: "done", Legacy: []string{"done"}, Args: "<id>",
+			Flags:   []flagDef{{[]string{"-f", "--force"}, ""}},
+			Summary: "Mark a todo done (--force if it is blocked)", Run: handleDone},
+		{Group: "todo", Name: "undone", Legacy: []string{"undone"}, Args: "<id>",
+			Summary: "Reopen a todo", Run: handleUndone},
+		{Group: "todo", Name: "block", Legacy: []string{"block"}, Args: "<id>",
+			Flags:   []flagDef{{[]string{"--on"}, "id[,id...]"}},
+			Summary: "Block a todo until others are done", Run: handleBlock},
+		{Group: "todo", Name: "unblock", Legacy: []string{"unblock"}, Args: "<id>",
+			Flags:   []flagDef{{[]string{"--on"}, "id"}},
+			Summary: "Remove a todo's dependencies", Run: handleUnblock},
+		{Group: "todo", Name: "rm", Aliases: []string{"remove"}, Legacy: []string{"rm", "remove"}, Args: "<id>",
+			Summary: "Delete a todo and its subtasks", Run: handleRemove},
+		{Group: "todo", Name: "clear", Legacy: []string{"clear"},
+			Summary: "Delete all todos", Run: handleClear},
+		{Group: "todo", Name: "import", Legacy: []string{"import"}, Args: "<file>",
+			Flags:   []flagDef{{[]string{"--format"}, "json|todotxt"}},
+			Summary: "Import todos.json, a vault export or todo.txt", Run: handleImport},
+		{Group: "todo", Name: "export", Legacy: []string{"export"},
+			Flags: []flagDef{{[]string{"--format"}, "json|todotxt|ics"}, {[]string{"--type"}, "event|todo|all"},
+				{[]string{"-c", "--category"}, "category"}, {[]string{"-o", "--output"}, "file"}},
+			Summary: "Export todos", Run: handleExport},
+		{Group: "todo", Name: "sync", Legacy: []string{"sync"}, Args: "todotxt <file>",
+			Summary: "Two-way sync with a todo.txt file", Run: handleSync},
+
+		// Vault items
+		{Group: "item", Name: "save", Legacy: []string{"save"}, Args: "<url-or-text>",
+			Flags:   []flagDef{{[]string{"-t", "--tags"}, "tags"}, {[]string{"-p", "--pin"}, ""}, {[]string{"--html"}, ""}},
+			Summary: "Save a link (auto-detects type)", Run: handleVaultSave},
+		{Group: "item", Name: "note", Legacy: []string{"note"}, Args: "<text>",
+			Flags:   []flagDef{{[]string{"-t", "--tags"}, "tags"}, {[]string{"-p", "--pin"}, ""}},
+			Summary: "Save a quick note", Run: handleVaultNote},
+		{Group: "item", Name: "list", Aliases: []string{"ls"}, Legacy: []string{"items"},
+			Flags: []flagDef{{[]string{"-t", "--type"}, "type"}, {[]string{"--tags"}, "tags"}, {[]string{"-s", "--search"}, "query"},
+				{[]string{"--pinned"}, ""}, {[]string{"--archived"}, ""}},
+			Summary: "List saved items", Run: handleVaultList},
+		{Group: "item", Name: "random", Aliases: []string{"resurface"}, Legacy: []string{"random", "resurface"},
+			Summary: "Resurface a random old item", Run: handleVaultRandom},
+		{Group: "item", Name: "read", Legacy: []string{"read"}, Args: "<id>",
+			Flags:   []flagDef{{[]string{"--refresh"}, ""}, {[]string{"--html"}, ""}},
+			Summary: "Read the saved offline copy of an article", Run: handleVaultRead},
+		{Group: "item", Name: "edit", Args: "<id>",
+			Flags: []flagDef{{[]string{"--title"}, "text"}, {[]string{"-t", "--tags"}, "tags"}, {[]string{"--content"}, "text"},
+				{[]string{"--pin"}, ""}, {[]string{"--unpin"}, ""}, {[]string{"--archive"}, ""}, {[]string{"--unarchive"}, ""}},
+			Summary: "Edit an item in $EDITOR, or with flags", Run: handleEditItem},
+		{Group: "item", Name: "refetch", Legacy: []string{"refetch"}, Args: "[<id>]",
+			Flags:   []flagDef{{[]string{"--failed"}, ""}},
+			Summary: "Retry fetching metadata for links", Run: handleVaultRefetch},
+		{Group: "item", Name: "dedupe", Legacy: []string{"dedupe"},
+			Flags:   []flagDef{{[]string{"-n", "--dry-run"}, ""}},
+			Summary: "Merge links saved more than once", Run: handleVaultDedupe},
+		{Group: "item", Name: "pin", Legacy: []string{"pin"}, Args: "<id>",
+			Summary: "Pin an item", Run: func(a *cmdArgs) { handleVaultPin(a, true) }},
+		{Group: "item", Name: "unpin", Legacy: []string{"unpin"}, Args: "<id>",
+			Summary: "Unpin an item", Run: func(a *cmdArgs) { handleVaultPin(a, false) }},
+		{Group: "item", Name: "archive", Legacy: []string{"archive"}, Args: "<id>",
+			Summary: "Archive an item", Run: func(a *cmdArgs) { handleVaultArchive(a, true) }},
+		{Group: "item", Name: "unarchive", Legacy: []string{"unarchive"}, Args: "<id>",
+			Summary: "Unarchive an item", Run: func(a *cmdArgs) { handleVaultArchive(a, false) }},
+		{Group: "item", Name: "rm", Aliases: []string{"remove", "delete"}, Args: "<id>",
+			Summary: "Delete an item", Run: handleVaultDelete},
+		{Group: "item", Name: "tags", Legacy: []string{"tags"},
+			Summary: "List all tags", Run: handleVaultTags},
+		{Group: "item", Name: "tag", Legacy: []string{"tag"}, Args: "<id> <tag1,tag2,...>",
+			Summary: "Set tags for an item", Run: handleVaultSetTags},
+
+		// Everything else
+		{Name: "server", Summary: "Start web UI", Run: func(*cmdArgs) { startServer() }},
+		{Name: "status", Flags: []flagDef{{[]string{"--template"}, "text"}, {[]string{"--plain"}, ""}, {[]string{"--no-cache"}, ""}},
+			Summary: "One-line summary for the tmux status bar", NoDB: true, Run: handleStatus},
+		{Name: "pick", Flags: []flagDef{{[]string{"--todos"}, ""}, {[]string{"--items"}, ""}, {[]string{"--pane"}, "id"}},
+			Summary: "Fuzzy-find a todo or item (enter: done/open, ctrl-y: paste)", Run: handlePick},
+		{Name: "tui", Flags: []flagDef{{[]string{"--todos"}, ""}},
+			Summary: "Full-screen interface to todos and the vault", Run: handleTUI},
+		{Name: "scan", Args: "<dir>", Flags: []flagDef{{[]string{"-n", "--dry-run"}, ""}},
+			Summary: "Turn TODO/FIXME/HACK comments in a source tree into todos in the current context", Run: handleScan},
+		{Name: "worker", Flags: []flagDef{{[]string{"--once"}, ""}, {[]string{"--drain"}, ""}},
+			Summary: "Process queued metadata fetches until interrupted", Run: handleVaultWorker},
+		{Name: "migrate", Args: "[status|up]", Summary: "Show or apply schema migrations", NoDB: true, Run: handleMigrate},
+		{Name: "profiles", Summary: "List named vaults", Run: handleVaultProfiles},
+
+		// tmux
+		{Group: "tmux", Name: "install", Flags: []flagDef{{[]string{"--print"}, ""}},
+			Summary: "Add the picker key bindings to ~/.tmux.conf", NoDB: true, Run: handleTmuxInstall},
+		{Name: "help", Args: "[todo|item|tmux]", Summary: "Show help", NoDB: true, Run: handleHelp},
+	}
+}
+
+// commandGroups are the command groups in help order
+var commandGroups = []struct{ Name, Title string }{
+	{"todo", "Todo Commands"},
+	{"item", "Item Commands"},
+	{"tmux", "Tmux Commands"},
+	{"", "Other Commands"},
+}
+
+// isGroup reports whether name is a command group
+func isGroup(name string) bool {
+	for _, g := range commandGroups {
+		if g.Name != "" && g.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// usageExamples are shown at the end of the help
+var usageExamples = []string{
+	`vault item save "https://youtube.com/watch?v=..." -t music,favorites`,
+	`vault item note "Great idea for app" -t ideas -p`,
+	`vault item list --tags coding`,
+	`vault item list -s '"exact phrase" go* -python'`,
+	`vault todo add "Standup prep" -r "every mon,wed"`,
+	`vault todo add "Pay rent" -d "next fri 9am"`,
+	`vault todo add "Write changelog" --under 12`,
+	`vault --profile work item list`,
+	`set -g status-right '#(vault status)'   # in ~/.tmux.conf`,
+}
+
+// findCommand resolves a group and name (or alias)
+func findCommand(group, name string) *command {
+	for _, c := range commands {
+		if c.Group != group {
+			continue
+		}
+		if c.Name == name {
+			return c
+		}
+		for _, alias := range c.Aliases {
+			if alias == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// findLegacy resolves a deprecated top-level verb
+func findLegacy(verb string) *command {
+	for _, c := range commands {
+		for _, l := range c.Legacy {
+			if l == verb {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// resolveCommand finds the command for the arguments after the global
+// flags and returns it with its own arguments. deprecated is set when a
+// legacy verb was used.
+func resolveCommand(args []string) (cmd *command, rest []string, deprecated bool) {
+	if len(args) == 0 {
+		return nil, nil, false
+	}
+	verb := args[0]
+	switch {
+	case isGroup(verb):
+		if len(args) < 2 {
+			return findCommand("", "help"), args[:1], false
+		}
+		if c := findCommand(verb, args[1]); c != nil {
+			return c, args[2:], false
+		}
+		return nil, nil, false
+	case verb == "-h" || verb == "--help":
+		return findCommand("", "help"), nil, false
+	case verb == "edit":
+		// The old `vault edit [todo|item] <id>`
+		if len(args) > 1 && (args[1] == "todo" || args[1] == "item") {
+			return findCommand(args[1], "edit"), args[2:], true
+		}
+		return findCommand("todo", "edit"), args[1:], true
+	}
+	if c := findCommand("", verb); c != nil {
+		return c, args[1:], false
+	}
+	if c := findLegacy(verb); c != nil {
+		return c, args[1:], true
+	}
+	return nil, nil, false
+}
+
+// path is how the command is typed, e.g. "vault todo add"
+func (c *command) path() string {
+	if c.Group == "" {
+		return "vault " + c.Name
+	}
+	return "vault " + c.Group + " " + c.Name
+}
+
+// synopsis is the command with its arguments and flags
+func (c *command) synopsis() string {
+	parts := []string{c.path()}
+	if c.Args != "" {
+		parts = append(parts, c.Args)
+	}
+	for _, f := range c.Flags {
+		if f.Arg == "" {
+			parts = append(parts, "["+f.Names[0]+"]")
+		} else {
+			parts = append(parts, "["+f.Names[0]+" "+f.Arg+"]")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// cmdArgs are a command's parsed arguments
+type cmdArgs struct {
+	cmd        *command
+	Positional []string
+	values     map[string]string // by the flag's first name
+	set        map[string]bool
+}
+
+// parseCommandArgs splits args into the command's flags and positional
+// arguments. Flags may come anywhere, as "-p high" or "--priority=high".
+// Only the command's own flags are parsed, so other words that start with
+// "-" are positional ("add Fix -Wall"), as is everything after "--".
+func parseCommandArgs(cmd *command, args []string) (*cmdArgs, error) {
+	a := &cmdArgs{cmd: cmd, values: map[string]string{}, set: map[string]bool{}}
+	byName := map[string]flagDef{}
+	for _, f := range cmd.Flags {
+		for _, n := range f.Names {
+			byName[n] = f
+		}
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			a.Positional = append(a.Positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			a.Positional = append(a.Positional, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		f, ok := byName[name]
+		if !ok {
+			a.Positional = append(a.Positional, arg)
+			continue
+		}
+		key := f.Names[0]
+		switch {
+		case f.Arg == "" && hasValue:
+			return nil, fmt.Errorf("%s doesn't take a value", name)
+		case f.Arg == "":
+		case hasValue:
+			a.values[key] = value
+		case i+1 < len(args):
+			a.values[key] = args[i+1]
+			i++
+		default:
+			return nil, fmt.Errorf("%s needs a value (%s)", name, f.Arg)
+		}
+		a.set[key] = true
+	}
+	return a, nil
+}
+
+// Has reports whether a flag was given, by any of its names
+func (a *cmdArgs) Has(name string) bool {
+	return a.set[a.key(name)]
+}
+
+// Value returns a flag's value, or "" if it wasn't given
+func (a *cmdArgs) Value(name string) string {
+	return a.values[a.key(name)]
+}
+
+func (a *cmdArgs) key(name string) string {
+	for _, f := range a.cmd.Flags {
+		for _, n := range f.Names {
+			if n == name {
+				return f.Names[0]
+			}
+		}
+	}
+	return name
+}
+
+// Arg returns the i-th positional argument, or ""
+func (a *cmdArgs) Arg(i int) string {
+	if i < len(a.Positional) {
+		return a.Positional[i]
+	}
+	return ""
+}
+
+// Text joins the positional arguments, so quoting a task is optional
+func (a *cmdArgs) Text() string {
+	return strings.Join(a.Positional, " ")
+}
+
+// ID parses the first positional argument as an ID, printing the usage or
+// an error when it's missing or invalid
+func (a *cmdArgs) ID() (int64, bool) {
+	if len(a.Positional) == 0 {
+		a.Usage()
+		return 0, false
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(a.Positional[0], "#"), 10, 64)
+	if err != nil {
+		fmt.Println("Invalid ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// Usage prints the command's usage line
+func (a *cmdArgs) Usage() {
+	fmt.Println("Usage:", a.cmd.synopsis())
+}
+
+// runCLI dispatches a command line (without the program name). openDB
+// opens the database for commands that need it.
+func runCLI(args []string, openDB func() error) {
+	cmd, rest, deprecated := resolveCommand(args)
+	if cmd == nil {
+		if len(args) > 0 {
+			fmt.Printf("Unknown command: %s\n\n", strings.Join(args[:min(2, len(args))], " "))
+		}
+		printVaultUsage()
+		return
+	}
+	if deprecated {
+		fmt.Fprintf(os.Stderr, "warning: \"vault %s\" is deprecated, use \"%s\"\n", args[0], cmd.path())
+	}
+
+	a, err := parseCommandArgs(cmd, rest)
+	if err != nil {
+		fmt.Println("Error:", err)
+		a = &cmdArgs{cmd: cmd}
+		a.Usage()
+		return
+	}
+	if !cmd.NoDB {
+		if err := openDB(); err != nil {
+			fmt.Println("Error initializing database:", err)
+			os.Exit(1)
+		}
+		defer CloseDB()
+	}
+	cmd.Run(a)
+}
+
+func handleHelp(a *cmdArgs) {
+	if group := a.Arg(0); isGroup(group) {
+		printGroupUsage(group)
+		return
+	}
+	printVaultUsage()
+}
+
+// printUsageLine prints a synopsis with its summary aligned beside it, or
+// below it when the synopsis is long
+func printUsageLine(synopsis, summary string) {
+	const column = 36
+	if len(synopsis) < column-2 {
+		fmt.Printf("  %-*s%s\n", column-2, synopsis, summary)
+		return
+	}
+	fmt.Printf("  %s\n  %*s%s\n", synopsis, column-2, "", summary)
+}
+
+func printGroupUsage(group string) {
+	for _, g := range commandGroups {
+		if g.Name != group {
+			continue
+		}
+		fmt.Printf("%s:\n", g.Title)
+		for _, c := range commands {
+			if c.Group == group {
+				printUsageLine(c.synopsis(), c.Summary)
+			}
+		}
+	}
+}
+
+func printVaultUsage() {
+	fmt.Println("vault - personal content manager")
+	for _, g := range commandGroups {
+		fmt.Println()
+		printGroupUsage(g.Name)
+	}
+
+	fmt.Println()
+	fmt.Println("Global Flags:")
+	printUsageLine("--db <path>", "Use a specific database file (or $VAULT_DB)")
+	printUsageLine("--profile <name>", "Use a named vault (or $VAULT_PROFILE)")
+
+	var legacy []string
+	for _, c := range commands {
+		legacy = append(legacy, c.Legacy...)
+	}
+	fmt.Println()
+	fmt.Println("Deprecated verbs (vault <verb> still works, with a warning):")
+	fmt.Println(wrapText(strings.Join(append(legacy, "edit"), ", "), terminalWidth(), "  "))
+
+	fmt.Println()
+	fmt.Println("Examples:")
+	for _, e := range usageExamples {
+		fmt.Println("  " + e)
+	}
+}
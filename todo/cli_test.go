@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommandArgs(t *testing.T) {
+	add := findCommand("todo", "add")
+	tests := []struct {
+		args       []string
+		positional []string
+		values     map[string]string
+		set        []string
+	}{
+		{[]string{"Fix", "-Wall"}, []string{"Fix", "-Wall"}, nil, nil},
+		{[]string{"Fix", "-Wall", "-p", "high"}, []string{"Fix", "-Wall"}, map[string]string{"-p": "high"}, nil},
+		{[]string{"--priority=low", "Read", "docs", "--all"}, []string{"Read", "docs"}, map[string]string{"-p": "low"}, []string{"--all"}},
+		{[]string{"Decrease", "by", "-5"}, []string{"Decrease", "by", "-5"}, nil, nil},
+		{[]string{"Document", "--", "-p", "high", "--all"}, []string{"Document", "-p", "high", "--all"}, nil, nil},
+		{[]string{"-", "dash"}, []string{"-", "dash"}, nil, nil},
+		{[]string{"-Dkey=value", "-c", "build"}, []string{"-Dkey=value"}, map[string]string{"-c": "build"}, nil},
+	}
+	for _, tt := range tests {
+		a, err := parseCommandArgs(add, tt.args)
+		if err != nil {
+			t.Errorf("parseCommandArgs(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(a.Positional, tt.positional) {
+			t.Errorf("parseCommandArgs(%q) positional = %q, want %q", tt.args, a.Positional, tt.positional)
+		}
+		for name, want := range tt.values {
+			if got := a.Value(name); got != want {
+				t.Errorf("parseCommandArgs(%q) %s = %q, want %q", tt.args, name, got, want)
+			}
+		}
+		for _, name := range tt.set {
+			if !a.Has(name) {
+				t.Errorf("parseCommandArgs(%q) %s not set", tt.args, name)
+			}
+		}
+	}
+
+	for _, args := range [][]string{{"task", "-p"}, {"task", "--all=yes"}} {
+		if _, err := parseCommandArgs(add, args); err == nil {
+			t.Errorf("parseCommandArgs(%q) succeeded, want an error", args)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Config is the optional user configuration stored in the XDG config directory
+type Config struct {
+	DefaultProfile string             `json:"default_profile"`
+	Profiles       map[string]Profile `json:"profiles"`
+	Status         StatusConfig       `json:"status"`
+}
+
+// Profile is a named vault pointing at its own database file
+type Profile struct {
+	DB string `json:"db"`
+}
+
+// Global flags, set by parseGlobalFlags before dispatching commands
+var (
+	dbFlag      string
+	profileFlag string
+)
+
+// parseGlobalFlags strips --db and --profile from anywhere in args before
+// a "--" and returns the remaining arguments, "--" and what follows it
+// included
+func parseGlobalFlags(args []string) ([]string, error) {
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return append(rest, args[i:]...), nil
+		case arg == "--db" || arg == "--profile":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s requires a value", arg)
+			}
+			if arg == "--db" {
+				dbFlag = args[i+1]
+			} else {
+				profileFlag = args[i+1]
+			}
+			i++
+		case strings.HasPrefix(arg, "--db="):
+			dbFlag = strings.TrimPrefix(arg, "--db=")
+		case strings.HasPrefix(arg, "--profile="):
+			profileFlag = strings.TrimPrefix(arg, "--profile=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, nil
+}
+
+// configDir returns $XDG_CONFIG_HOME/vault, falling back to ~/.config/vault
+func configDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "vault")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "vault")
+}
+
+// dataDir returns $XDG_DATA_HOME/vault, falling back to ~/.local/share/vault
+func dataDir() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "vault")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "share", "vault")
+}
+
+// cacheDir returns $XDG_CACHE_HOME/vault, falling back to ~/.cache/vault
+func cacheDir() string {
+	if dir := os.Getenv("XDG_CACHE_HOME"); dir != "" {
+		return filepath.Join(dir, "vault")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cache", "vault")
+}
+
+func configPath() string {
+	return filepath.Join(configDir(), "config.json")
+}
+
+// LoadConfig reads the config file. A missing file yields an empty config.
+func LoadConfig() (*Config, error) {
+	cfg := &Config{Profiles: map[string]Profile{}}
+	data, err := os.ReadFile(configPath())
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", configPath(), err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]Profile{}
+	}
+	return cfg, nil
+}
+
+// resolveDBPath picks the database file using, in order: --db, --profile,
+// VAULT_DB, VAULT_PROFILE, the config's default profile, then ~/.todo.db
+func resolveDBPath() (string, error) {
+	if dbFlag != "" {
+		return expandHome(dbFlag), nil
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return "", err
+	}
+
+	if profileFlag != "" {
+		return profileDBPath(cfg, profileFlag)
+	}
+	if env := os.Getenv("VAULT_DB"); env != "" {
+		return expandHome(env), nil
+	}
+	if env := os.Getenv("VAULT_PROFILE"); env != "" {
+		return profileDBPath(cfg, env)
+	}
+	if cfg.DefaultProfile != "" {
+		return profileDBPath(cfg, cfg.DefaultProfile)
+	}
+
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".todo.db"), nil
+}
+
+// profileDBPath resolves a profile name to its database file. Profiles not
+// listed in the config live in the XDG data directory as <name>.db.
+func profileDBPath(cfg *Config, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid profile name %q", name)
+	}
+	if p, ok := cfg.Profiles[name]; ok && p.DB != "" {
+		return expandHome(p.DB), nil
+	}
+	return filepath.Join(dataDir(), name+".db"), nil
+}
+
+// ProfileNames lists profiles from the config plus any databases found in
+// the data directory
+func ProfileNames(cfg *Config) []string {
+	seen := map[string]bool{}
+	for name := range cfg.Profiles {
+		seen[name] = true
+	}
+	matches, _ := filepath.Glob(filepath.Join(dataDir(), "*.db"))
+	for _, m := range matches {
+		seen[strings.TrimSuffix(filepath.Base(m), ".db")] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	return path
+}
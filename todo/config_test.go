@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGlobalFlags(t *testing.T) {
+	tests := []struct {
+		args, rest  []string
+		db, profile string
+	}{
+		{[]string{"todo", "list"}, []string{"todo", "list"}, "", ""},
+		{[]string{"--db", "/tmp/a.db", "todo", "list"}, []string{"todo", "list"}, "/tmp/a.db", ""},
+		{[]string{"todo", "list", "--profile=work"}, []string{"todo", "list"}, "", "work"},
+		// Nothing after "--" is a global flag
+		{[]string{"todo", "add", "--", "mention", "--db", "x"}, []string{"todo", "add", "--", "mention", "--db", "x"}, "", ""},
+		{[]string{"--db=/tmp/b.db", "todo", "add", "--", "--profile=home"}, []string{"todo", "add", "--", "--profile=home"}, "/tmp/b.db", ""},
+	}
+	for _, tt := range tests {
+		dbFlag, profileFlag = "", ""
+		rest, err := parseGlobalFlags(tt.args)
+		if err != nil {
+			t.Errorf("parseGlobalFlags(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(rest, tt.rest) || dbFlag != tt.db || profileFlag != tt.profile {
+			t.Errorf("parseGlobalFlags(%q) = %q, db %q, profile %q; want %q, %q, %q",
+				tt.args, rest, dbFlag, profileFlag, tt.rest, tt.db, tt.profile)
+		}
+	}
+	dbFlag, profileFlag = "", ""
+
+	if _, err := parseGlobalFlags([]string{"todo", "list", "--db"}); err == nil {
+		t.Error("parseGlobalFlags accepted --db without a value")
+	}
+	dbFlag, profileFlag = "", ""
+}
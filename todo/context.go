@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Todo contexts. A todo added inside a tmux session, or otherwise inside a
+// git repository, remembers where it was added, and the todo views default
+// to the context they are run in. Todos without a context (older ones, and
+// any added with --all) show up in every context.
+
+// currentContext detects the context from the environment: $VAULT_CONTEXT
+// if set, then the tmux session name ("tmux:work"), then the root of the
+// git repository containing the working directory ("git:/home/me/proj").
+// It is "" when none applies. Detection runs tmux or git, so it happens
+// only when a command first asks and is then remembered.
+var currentContext = sync.OnceValue(detectContext)
+
+func detectContext() string {
+	if ctx, ok := os.LookupEnv("VAULT_CONTEXT"); ok {
+		return strings.TrimSpace(ctx)
+	}
+	if os.Getenv("TMUX") != "" {
+		out, err := exec.Command("tmux", "display-message", "-p", "#S").Output()
+		if name := strings.TrimSpace(string(out)); err == nil && name != "" {
+			return "tmux:" + name
+		}
+	}
+	out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if root := strings.TrimSpace(string(out)); err == nil && root != "" {
+		return "git:" + filepath.Clean(root)
+	}
+	return ""
+}
+
+// todoContext is the context a todo command works in: none with --all,
+// otherwise the detected one
+func todoContext(a *cmdArgs) string {
+	if a.Has("--all") {
+		return ""
+	}
+	return currentContext()
+}
+
+// contextNote is the line telling which context a view was limited to
+func contextNote(ctx string) string {
+	return "Context: " + ctx + " (--all shows every context)"
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectContext(t *testing.T) {
+	t.Setenv("VAULT_CONTEXT", " work ")
+	if got := detectContext(); got != "work" {
+		t.Errorf("with $VAULT_CONTEXT: detectContext() = %q, want %q", got, "work")
+	}
+
+	t.Setenv("VAULT_CONTEXT", "")
+	os.Unsetenv("VAULT_CONTEXT")
+	t.Setenv("TMUX", "")
+	repo, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exec.Command("git", "init", "-q", repo).Run(); err != nil {
+		t.Skip("git not available:", err)
+	}
+	sub := filepath.Join(repo, "pkg", "sub")
+	os.MkdirAll(sub, 0755)
+	t.Chdir(sub)
+	if got, want := detectContext(), "git:"+repo; got != want {
+		t.Errorf("inside a repository: detectContext() = %q, want %q", got, want)
+	}
+
+	t.Chdir(t.TempDir())
+	if got := detectContext(); got != "" {
+		t.Errorf("outside any repository: detectContext() = %q, want none", got)
+	}
+}
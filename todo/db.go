@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -12,20 +13,11 @@ import (
 
 var db *sql.DB
 
-func getDBPath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".todo.db")
-}
+// dbPath is the database file opened by OpenDB
+var dbPath string
 
-func InitDB() error {
-	var err error
-	db, err = sql.Open("sqlite", getDBPath())
-	if err != nil {
-		return err
-	}
-
-	// Todo schema
-	schema := `
+// todoSchema is the original todos table (migration 1)
+const todoSchema = `
 	CREATE TABLE IF NOT EXISTS todos (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		task TEXT NOT NULL,
@@ -37,13 +29,27 @@ func InitDB() error {
 		updated_at TEXT
 	);
 	`
-	_, err = db.Exec(schema)
+
+// OpenDB opens the database without touching its schema
+func OpenDB() error {
+	path, err := resolveDBPath()
 	if err != nil {
 		return err
 	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	dbPath = path
+	db, err = sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	return err
+}
 
-	// Vault schema
-	return InitVaultDB()
+// InitDB opens the database and applies any pending migrations
+func InitDB() error {
+	if err := OpenDB(); err != nil {
+		return err
+	}
+	return Migrate()
 }
 
 func CloseDB() {
@@ -52,32 +58,66 @@ func CloseDB() {
 	}
 }
 
-func CreateTodo(task string, priority Priority, category string, dueDate string) (*Todo, error) {
+// CreateTodo inserts a todo, as a subtask when ParentID is set. A recurring
+// todo without a due date gets its first occurrence as the due date.
+// CreatedAt is kept when set (imports), otherwise it is now. Subtasks
+// always take their parent's context.
+func CreateTodo(todo *Todo) (*Todo, error) {
+	return createTodo(db, todo)
+}
+
+// sqlRunner is what *sql.DB and *sql.Tx have in common, so the steps of
+// one change can share a transaction
+type sqlRunner interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func createTodo(q sqlRunner, todo *Todo) (*Todo, error) {
+	if err := checkParent(q, 0, todo.ParentID); err != nil {
+		return nil, err
+	}
+	if todo.ParentID != 0 {
+		if err := q.QueryRow(`SELECT context FROM todos WHERE id = ?`, todo.ParentID).Scan(&todo.Context); err != nil {
+			return nil, err
+		}
+	}
 	now := time.Now()
-	result, err := db.Exec(
-		`INSERT INTO todos (task, done, priority, category, due_date, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
-		task, false, priority, category, dueDate, now.Format(time.RFC3339), now.Format(time.RFC3339),
+	created := now
+	if !todo.CreatedAt.IsZero() {
+		created = todo.CreatedAt
+	}
+	if todo.Priority == "" {
+		todo.Priority = PriorityMedium
+	}
+	if todo.Recurrence != "" && todo.DueDate == "" {
+		if rule, err := ParseRecurrence(todo.Recurrence); err == nil && rule != nil {
+			todo.DueDate = rule.FirstDue(now)
+		}
+	}
+	if todo.Done && todo.CompletedAt.IsZero() {
+		todo.CompletedAt = now
+	}
+	result, err := q.Exec(
+		`INSERT INTO todos (task, done, priority, category, due_date, due_phrase, recurrence, parent_id, source_id, context, created_at, updated_at, completed_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		todo.Task, todo.Done, todo.Priority, todo.Category, todo.DueDate, todo.DuePhrase, todo.Recurrence,
+		nullableID(todo.ParentID), todo.SourceID, todo.Context, created.Format(time.RFC3339), now.Format(time.RFC3339),
+		completedAt(todo),
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	id, _ := result.LastInsertId()
-	return &Todo{
-		ID:        id,
-		Task:      task,
-		Done:      false,
-		Priority:  priority,
-		Category:  category,
-		DueDate:   dueDate,
-		CreatedAt: now,
-		UpdatedAt: now,
-	}, nil
+	todo.ID, _ = result.LastInsertId()
+	todo.CreatedAt = created
+	todo.UpdatedAt = now
+	return todo, nil
 }
 
 func GetTodos(filter TodoFilter) ([]Todo, error) {
-	query := `SELECT id, task, done, priority, category, due_date, created_at, updated_at FROM todos WHERE 1=1`
+	query := `SELECT ` + todoColumns + ` FROM todos WHERE 1=1`
 	args := []interface{}{}
 
 	if filter.Status == "done" {
@@ -98,12 +138,33 @@ func GetTodos(filter TodoFilter) ([]Todo, error) {
 		args = append(args, filter.Category)
 	}
 
+	if filter.Context != "" {
+		query += " AND (context = ? OR context = '')"
+		args = append(args, filter.Context)
+	}
+
 	if filter.Search != "" {
 		query += " AND task LIKE ?"
 		args = append(args, "%"+filter.Search+"%")
 	}
 
-	query += " ORDER BY done ASC, CASE priority WHEN 'high' THEN 1 WHEN 'medium' THEN 2 WHEN 'low' THEN 3 END, created_at DESC"
+	if filter.Due != "" {
+		clause, dueArgs, err := dueFilterClause(filter.Due, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		query += " AND " + clause
+		args = append(args, dueArgs...)
+	}
+
+	// Due views read best in date order; otherwise priority comes first and
+	// due dates break ties, soonest first and undated last
+	priorityOrder := "CASE priority WHEN 'high' THEN 1 WHEN 'medium' THEN 2 WHEN 'low' THEN 3 END"
+	if filter.Due != "" && filter.Due != DueNoDate {
+		query += " ORDER BY done ASC, due_date ASC, " + priorityOrder + ", created_at DESC"
+	} else {
+		query += " ORDER BY done ASC, " + priorityOrder + ", due_date = '' ASC, due_date ASC, created_at DESC"
+	}
 
 	rows, err := db.Query(query, args...)
 	if err != nil {
@@ -113,51 +174,243 @@ func GetTodos(filter TodoFilter) ([]Todo, error) {
 
 	var todos []Todo
 	for rows.Next() {
-		var t Todo
-		var createdAt, updatedAt string
-		var priority string
-		err := rows.Scan(&t.ID, &t.Task, &t.Done, &priority, &t.Category, &t.DueDate, &createdAt, &updatedAt)
+		t, err := scanTodo(rows)
 		if err != nil {
 			continue
 		}
-		t.Priority = Priority(priority)
-		t.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-		t.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
-		todos = append(todos, t)
+		todos = append(todos, *t)
 	}
-	return todos, nil
+	rows.Close()
+	if err := fillProgress(db, todos); err != nil {
+		return nil, err
+	}
+	return todos, fillDeps(db, todos)
 }
 
 func GetTodo(id int64) (*Todo, error) {
-	var t Todo
-	var createdAt, updatedAt string
-	var priority string
-	err := db.QueryRow(
-		`SELECT id, task, done, priority, category, due_date, created_at, updated_at FROM todos WHERE id = ?`,
-		id,
-	).Scan(&t.ID, &t.Task, &t.Done, &priority, &t.Category, &t.DueDate, &createdAt, &updatedAt)
+	return getTodo(db, id)
+}
+
+func getTodo(q sqlRunner, id int64) (*Todo, error) {
+	t, err := scanTodo(q.QueryRow(`SELECT `+todoColumns+` FROM todos WHERE id = ?`, id))
 	if err != nil {
 		return nil, err
 	}
-	t.Priority = Priority(priority)
-	t.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-	t.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
-	return &t, nil
+	todos := []Todo{*t}
+	if err := fillProgress(q, todos); err != nil {
+		return nil, err
+	}
+	if err := fillDeps(q, todos); err != nil {
+		return nil, err
+	}
+	return &todos[0], nil
+}
+
+// dueFilterClause builds the WHERE condition for a TodoFilter.Due mode.
+// Due dates are local-time strings, so plain string comparison orders them;
+// all-day dates (10 characters) only become overdue once their day is over.
+func dueFilterClause(mode string, now time.Time) (string, []interface{}, error) {
+	today := now.Format(dueDateLayout)
+	switch mode {
+	case DueOverdue:
+		return `done = FALSE AND due_date != '' AND CASE WHEN length(due_date) = 10 THEN due_date < ? ELSE due_date < ? END`,
+			[]interface{}{today, now.Format(dueTimeLayout)}, nil
+	case DueToday:
+		return `substr(due_date, 1, 10) = ?`, []interface{}{today}, nil
+	case DueThisWeek:
+		// Monday to Sunday of the current week
+		monday := startOfDay(now).AddDate(0, 0, -((int(now.Weekday()) + 6) % 7))
+		sunday := monday.AddDate(0, 0, 6)
+		return `due_date != '' AND substr(due_date, 1, 10) BETWEEN ? AND ?`,
+			[]interface{}{monday.Format(dueDateLayout), sunday.Format(dueDateLayout)}, nil
+	case DueNoDate:
+		return `due_date = ''`, nil, nil
+	}
+	return "", nil, fmt.Errorf("unknown due filter %q (use overdue, today, this-week or no-date)", mode)
+}
+
+// UpdateTodo saves every editable field of a todo; the context stays as it
+// was when the todo was added. Changing the done state has the same
+// effects as MarkTodoDone, all in one transaction, and likewise refuses to
+// complete a blocked todo unless force is set.
+func UpdateTodo(todo *Todo, force bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := updateTodo(tx, todo, force); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func UpdateTodo(id int64, task string, done bool, priority Priority, category string, dueDate string) error {
+func updateTodo(q sqlRunner, todo *Todo, force bool) error {
+	prev, err := getTodo(q, todo.ID)
+	if err != nil {
+		return err
+	}
+	if err := checkParent(q, todo.ID, todo.ParentID); err != nil {
+		return err
+	}
+	todo.Context = prev.Context
+	if todo.Done && !prev.Done && !force {
+		if err := checkNotBlocked(q, todo.ID); err != nil {
+			return err
+		}
+	}
 	now := time.Now()
-	_, err := db.Exec(
-		`UPDATE todos SET task=?, done=?, priority=?, category=?, due_date=?, updated_at=? WHERE id=?`,
-		task, done, priority, category, dueDate, now.Format(time.RFC3339), id,
+	switch {
+	case !todo.Done:
+		todo.CompletedAt = time.Time{}
+	case prev.Done:
+		todo.CompletedAt = prev.CompletedAt
+	case todo.CompletedAt.IsZero():
+		todo.CompletedAt = now
+	}
+	_, err = q.Exec(
+		`UPDATE todos SET task=?, done=?, priority=?, category=?, due_date=?, due_phrase=?, recurrence=?, parent_id=?, updated_at=?, completed_at=? WHERE id=?`,
+		todo.Task, todo.Done, todo.Priority, todo.Category, todo.DueDate, todo.DuePhrase, todo.Recurrence,
+		nullableID(todo.ParentID), now.Format(time.RFC3339), completedAt(todo), todo.ID,
 	)
+	if err != nil {
+		return err
+	}
+	if todo.Done != prev.Done {
+		_, err = applyDoneChange(q, todo, prev.Done)
+	}
 	return err
 }
 
-func MarkTodoDone(id int64, done bool) error {
-	now := time.Now()
-	_, err := db.Exec(`UPDATE todos SET done=?, updated_at=? WHERE id=?`, done, now.Format(time.RFC3339), id)
-	return err
+// MarkTodoDone sets a todo's done state. Completing a todo completes its
+// subtasks and reopening one reopens its parents. Completing a recurring
+// todo creates the next occurrence, which is returned; otherwise it is nil.
+// Reopening it again withdraws that occurrence. A todo with pending
+// prerequisites can't be completed unless force is set; a *BlockedError
+// says what it is waiting on.
+func MarkTodoDone(id int64, done, force bool) (*Todo, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	next, err := markTodoDone(tx, id, done, force)
+	if err != nil {
+		return nil, err
+	}
+	return next, tx.Commit()
+}
+
+func markTodoDone(q sqlRunner, id int64, done, force bool) (*Todo, error) {
+	prev, err := getTodo(q, id)
+	if err != nil {
+		return nil, err
+	}
+	if done && !prev.Done && !force {
+		if err := checkNotBlocked(q, id); err != nil {
+			return nil, err
+		}
+	}
+	if done != prev.Done {
+		now := time.Now().Format(time.RFC3339)
+		completed := ""
+		if done {
+			completed = now
+		}
+		if _, err := q.Exec(`UPDATE todos SET done=?, updated_at=?, completed_at=? WHERE id=?`, done, now, completed, id); err != nil {
+			return nil, err
+		}
+	}
+	updated := *prev
+	updated.Done = done
+	return applyDoneChange(q, &updated, prev.Done)
+}
+
+// applyDoneChange carries out the side effects of todo's done state having
+// been set, wasDone being its state before
+func applyDoneChange(q sqlRunner, todo *Todo, wasDone bool) (*Todo, error) {
+	if !todo.Done && wasDone {
+		if err := withdrawReopenedOccurrences(q, todo.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := cascadeDone(q, todo.ID, todo.Done); err != nil {
+		return nil, err
+	}
+	if todo.Done && !wasDone {
+		return spawnNextOccurrence(q, todo)
+	}
+	return nil, nil
+}
+
+// spawnNextOccurrence creates the next instance of a completed recurring
+// todo. The rule moves to the new todo, so un-completing and completing
+// the old one again doesn't spawn a second copy.
+func spawnNextOccurrence(q sqlRunner, done *Todo) (*Todo, error) {
+	rule, err := ParseRecurrence(done.Recurrence)
+	if err != nil || rule == nil {
+		return nil, err
+	}
+	rule = rule.anchored(done.DueDate)
+	next, err := createTodo(q, &Todo{
+		Task:       done.Task,
+		Priority:   done.Priority,
+		Category:   done.Category,
+		DueDate:    rule.NextDue(done.DueDate, time.Now()),
+		Recurrence: rule.String(),
+		ParentID:   done.ParentID,
+		Context:    done.Context,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := copySubtasks(q, done.ID, next.ID); err != nil {
+		return nil, err
+	}
+	if _, err := q.Exec(`UPDATE todos SET recurs_from=? WHERE id=?`, done.ID, next.ID); err != nil {
+		return nil, err
+	}
+	_, err = q.Exec(`UPDATE todos SET recurrence='' WHERE id=?`, done.ID)
+	return next, err
+}
+
+// withdrawReopenedOccurrences undoes spawnNextOccurrence for a todo about
+// to be reopened and for the done ancestors that reopen with it: each
+// pending occurrence is deleted and its rule moves back. An occurrence
+// that has been completed itself is left alone.
+func withdrawReopenedOccurrences(q sqlRunner, id int64) error {
+	rows, err := q.Query(todoAncestry+`
+		SELECT n.id, n.recurs_from, n.recurrence FROM todos n
+		WHERE n.done = FALSE AND (n.recurs_from = ? OR n.recurs_from IN (
+			SELECT a.ancestor FROM ancestry a JOIN todos t ON t.id = a.ancestor
+			WHERE a.id = ? AND t.done))`, id, id)
+	if err != nil {
+		return err
+	}
+	type occurrence struct {
+		id, from int64
+		rule     string
+	}
+	var found []occurrence
+	for rows.Next() {
+		var o occurrence
+		if err := rows.Scan(&o.id, &o.from, &o.rule); err != nil {
+			rows.Close()
+			return err
+		}
+		found = append(found, o)
+	}
+	rows.Close()
+
+	for _, o := range found {
+		if _, err := q.Exec(`DELETE FROM todos WHERE id=?`, o.id); err != nil {
+			return err
+		}
+		if _, err := q.Exec(`UPDATE todos SET recurrence=? WHERE id=?`, o.rule, o.from); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func DeleteTodo(id int64) error {
@@ -187,3 +440,39 @@ func GetCategories() ([]string, error) {
 	}
 	return categories, nil
 }
+
+// todoColumns is the column list scanTodo expects
+const todoColumns = `id, task, done, priority, category, due_date, due_phrase, recurrence, parent_id, source_id, context, created_at, updated_at, completed_at`
+
+func scanTodo(row rowScanner) (*Todo, error) {
+	var t Todo
+	var createdAt, updatedAt, completedAt string
+	var priority string
+	var parentID sql.NullInt64
+	err := row.Scan(&t.ID, &t.Task, &t.Done, &priority, &t.Category, &t.DueDate, &t.DuePhrase, &t.Recurrence, &parentID, &t.SourceID, &t.Context, &createdAt, &updatedAt, &completedAt)
+	if err != nil {
+		return nil, err
+	}
+	t.ParentID = parentID.Int64
+	t.Priority = Priority(priority)
+	t.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	t.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
+	t.CompletedAt, _ = time.Parse(time.RFC3339, completedAt)
+	return &t, nil
+}
+
+// completedAt is the stored completion time: empty while pending
+func completedAt(t *Todo) string {
+	if !t.Done || t.CompletedAt.IsZero() {
+		return ""
+	}
+	return t.CompletedAt.Format(time.RFC3339)
+}
+
+// nullableID stores 0 as NULL for optional foreign keys
+func nullableID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// openTestDB points the package at a fresh, migrated database that is
+// removed when the test ends
+func openTestDB(t *testing.T) {
+	t.Helper()
+	dbFlag = filepath.Join(t.TempDir(), "test.db")
+	if err := InitDB(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		CloseDB()
+		dbFlag = ""
+	})
+}
+
+// pendingTasks returns the tasks of every pending todo
+func pendingTasks(t *testing.T) []string {
+	t.Helper()
+	todos, err := GetTodos(TodoFilter{Status: "pending"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tasks []string
+	for _, todo := range todos {
+		tasks = append(tasks, todo.Task)
+	}
+	return tasks
+}
+
+func TestReopenRecurringTodoWithdrawsOccurrence(t *testing.T) {
+	openTestDB(t)
+
+	water, err := CreateTodo(&Todo{Task: "water plants", Recurrence: "daily"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateTodo(&Todo{Task: "fern", ParentID: water.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := MarkTodoDone(water.ID, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == nil {
+		t.Fatal("completing a recurring todo spawned no occurrence")
+	}
+	if got := pendingTasks(t); len(got) != 2 {
+		t.Fatalf("pending after completing = %v, want the next occurrence and its subtask", got)
+	}
+
+	if _, err := MarkTodoDone(water.ID, false, false); err != nil {
+		t.Fatal(err)
+	}
+	// Reopening doesn't reopen subtasks, so only the original is pending
+	if got := pendingTasks(t); len(got) != 1 || got[0] != "water plants" {
+		t.Errorf("pending after reopening = %v, want only the original", got)
+	}
+	if _, err := GetTodo(next.ID); err != sql.ErrNoRows {
+		t.Errorf("spawned occurrence still exists (err %v)", err)
+	}
+	reopened, err := GetTodo(water.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Recurrence != "daily" {
+		t.Errorf("reopened todo recurrence = %q, want the rule back", reopened.Recurrence)
+	}
+
+	// Completing it again spawns exactly one new occurrence
+	if _, err := MarkTodoDone(water.ID, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingTasks(t); len(got) != 2 {
+		t.Errorf("pending after completing again = %v, want one occurrence and its subtask", got)
+	}
+}
+
+func TestReopenSubtaskWithdrawsParentOccurrence(t *testing.T) {
+	openTestDB(t)
+
+	review, err := CreateTodo(&Todo{Task: "weekly review", Recurrence: "weekly"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox, err := CreateTodo(&Todo{Task: "empty inbox", ParentID: review.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MarkTodoDone(review.ID, true, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening the subtask reopens the parent, which takes back its rule
+	inbox.Done = false
+	if err := UpdateTodo(inbox, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := pendingTasks(t); len(got) != 2 {
+		t.Errorf("pending = %v, want only the reopened review and its subtask", got)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"database/sql"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// trackingParams are query parameters that identify the share, not the content
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "msclkid": true, "yclid": true,
+	"mc_cid": true, "mc_eid": true, "igshid": true, "igsh": true, "si": true,
+	"_hsenc": true, "_hsmi": true, "ref_src": true, "ref_url": true,
+	"feature": true, "share_id": true, "is_from_webapp": true, "sender_device": true,
+}
+
+// stripTrackingParams removes utm_* and known share-tracking parameters
+// and sorts what remains so parameter order doesn't matter
+func stripTrackingParams(u *url.URL) {
+	q := u.Query()
+	for key := range q {
+		lower := strings.ToLower(key)
+		if strings.HasPrefix(lower, "utm_") || trackingParams[lower] {
+			q.Del(key)
+		}
+	}
+	// x.com appends ?s=NN (share source) and ?t=... to every shared link
+	if hostMatches(u.Host, "twitter.com", "x.com") {
+		q.Del("s")
+		q.Del("t")
+	}
+	u.RawQuery = q.Encode()
+}
+
+// backfillCanonicalURLs fills canonical_url for existing items (migration 8).
+// Only the oldest item of each duplicate group gets the canonical URL so the
+// unique index can be built; `vault item dedupe` merges the rest.
+func backfillCanonicalURLs(tx *sql.Tx) error {
+	if _, err := tx.Exec(`ALTER TABLE vault_items ADD COLUMN canonical_url TEXT DEFAULT ''`); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, url FROM vault_items WHERE url != '' ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	updates := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var u string
+		rows.Scan(&id, &u)
+		canonical := CanonicalizeURL(u)
+		if !seen[canonical] {
+			seen[canonical] = true
+			updates[id] = canonical
+		}
+	}
+	rows.Close()
+
+	for id, canonical := range updates {
+		if _, err := tx.Exec(`UPDATE vault_items SET canonical_url=? WHERE id=?`, canonical, id); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`CREATE UNIQUE INDEX idx_vault_canonical_url ON vault_items(canonical_url) WHERE canonical_url != ''`)
+	return err
+}
+
+// GetVaultItemByCanonicalURL finds the item already saved under a canonical URL
+func GetVaultItemByCanonicalURL(canonical string) (*VaultItem, error) {
+	row := db.QueryRow(`SELECT `+vaultItemColumns("")+` FROM vault_items WHERE canonical_url = ?`, canonical)
+	item, err := scanVaultItem(row)
+	if err != nil {
+		return nil, err
+	}
+	item.Tags, _ = GetTagsForItem(item.ID)
+	return item, nil
+}
+
+// DuplicateGroup is a set of items sharing a canonical URL. Keep is the
+// oldest item; the others get merged into it.
+type DuplicateGroup struct {
+	Canonical string
+	Keep      VaultItem
+	Dupes     []VaultItem
+}
+
+// FindDuplicates recomputes canonical URLs for every link and groups items
+// that collide
+func FindDuplicates() ([]DuplicateGroup, error) {
+	rows, err := db.Query(`SELECT ` + vaultItemColumns("") + ` FROM vault_items WHERE url != '' ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	byCanonical := map[string][]VaultItem{}
+	var order []string
+	for rows.Next() {
+		item, err := scanVaultItem(rows)
+		if err != nil {
+			continue
+		}
+		canonical := CanonicalizeURL(item.URL)
+		if _, ok := byCanonical[canonical]; !ok {
+			order = append(order, canonical)
+		}
+		byCanonical[canonical] = append(byCanonical[canonical], *item)
+	}
+	rows.Close()
+
+	var groups []DuplicateGroup
+	for _, canonical := range order {
+		items := byCanonical[canonical]
+		if len(items) < 2 {
+			continue
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+		groups = append(groups, DuplicateGroup{Canonical: canonical, Keep: items[0], Dupes: items[1:]})
+	}
+	return groups, nil
+}
+
+// MergeDuplicates folds each group's duplicates into the kept item: tags
+// are unioned, pinned wins, a missing snapshot is taken over, and the
+// duplicates are deleted. Canonical URLs of all links are refreshed.
+func MergeDuplicates(groups []DuplicateGroup) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Format(time.RFC3339)
+	for _, g := range groups {
+		for _, dupe := range g.Dupes {
+			stmts := []struct {
+				query string
+				args  []interface{}
+			}{
+				{`INSERT OR IGNORE INTO item_tags (item_id, tag_id) SELECT ?, tag_id FROM item_tags WHERE item_id = ?`, []interface{}{g.Keep.ID, dupe.ID}},
+				{`UPDATE vault_items SET pinned = TRUE WHERE id = ? AND (SELECT pinned FROM vault_items WHERE id = ?)`, []interface{}{g.Keep.ID, dupe.ID}},
+				{`UPDATE OR IGNORE snapshots SET item_id = ? WHERE item_id = ?`, []interface{}{g.Keep.ID, dupe.ID}},
+				{`DELETE FROM vault_items WHERE id = ?`, []interface{}{dupe.ID}},
+			}
+			for _, s := range stmts {
+				if _, err := tx.Exec(s.query, s.args...); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := tx.Exec(`UPDATE vault_items SET canonical_url = '', updated_at = ? WHERE canonical_url = ? AND id != ?`, now, g.Canonical, g.Keep.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`UPDATE vault_items SET canonical_url = ?, updated_at = ? WHERE id = ?`, g.Canonical, now, g.Keep.ID); err != nil {
+			return err
+		}
+	}
+
+	// Refresh canonical URLs left empty by the migration or computed by
+	// older canonicalization rules
+	rows, err := tx.Query(`SELECT id, url, canonical_url FROM vault_items WHERE url != ''`)
+	if err != nil {
+		return err
+	}
+	stale := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var u, current string
+		rows.Scan(&id, &u, &current)
+		if canonical := CanonicalizeURL(u); canonical != current {
+			stale[id] = canonical
+		}
+	}
+	rows.Close()
+	for id, canonical := range stale {
+		if _, err := tx.Exec(`UPDATE OR IGNORE vault_items SET canonical_url = ? WHERE id = ?`, canonical, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Task dependencies. A row in todo_deps says todo_id can't start until
+// depends_on is done; a todo is blocked while any of its prerequisites is
+// pending. Deleting either todo drops the dependency.
+
+// depsSchema creates the dependency table (migration 13)
+const depsSchema = `
+	CREATE TABLE todo_deps (
+		todo_id INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+		depends_on INTEGER NOT NULL REFERENCES todos(id) ON DELETE CASCADE,
+		created_at TEXT NOT NULL,
+		PRIMARY KEY (todo_id, depends_on)
+	);
+	CREATE INDEX idx_todo_deps_depends_on ON todo_deps(depends_on);
+	`
+
+var (
+	// errDepCycle is returned when a dependency would make a todo wait on itself
+	errDepCycle = errors.New("dependency would create a cycle")
+	errNoDep    = errors.New("todo not found")
+)
+
+// BlockedError is returned when completing a todo whose prerequisites are
+// still pending, unless the completion is forced
+type BlockedError struct {
+	ID        int64
+	BlockedBy []int64
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("todo #%d is blocked by %s", e.ID, formatIDs(e.BlockedBy))
+}
+
+// checkNotBlocked returns a *BlockedError if id has pending prerequisites
+func checkNotBlocked(q sqlRunner, id int64) error {
+	rows, err := q.Query(`
+		SELECT d.depends_on FROM todo_deps d JOIN todos p ON p.id = d.depends_on
+		WHERE d.todo_id = ? AND p.done = FALSE
+		ORDER BY d.depends_on`, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var pending []int64
+	for rows.Next() {
+		var on int64
+		if err := rows.Scan(&on); err != nil {
+			return err
+		}
+		pending = append(pending, on)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return &BlockedError{ID: id, BlockedBy: pending}
+	}
+	return nil
+}
+
+// AddDependency records that todoID is blocked until dependsOn is done
+func AddDependency(todoID, dependsOn int64) error {
+	for _, id := range []int64{todoID, dependsOn} {
+		if _, err := GetTodo(id); err == sql.ErrNoRows {
+			return errNoDep
+		} else if err != nil {
+			return err
+		}
+	}
+	if todoID == dependsOn {
+		return errDepCycle
+	}
+	// dependsOn must not already wait on todoID, directly or transitively
+	var found int
+	err := db.QueryRow(`
+		WITH RECURSIVE prereqs(id) AS (
+			SELECT depends_on FROM todo_deps WHERE todo_id = ?
+			UNION
+			SELECT d.depends_on FROM todo_deps d JOIN prereqs p ON d.todo_id = p.id
+		)
+		SELECT COUNT(*) FROM prereqs WHERE id = ?`, dependsOn, todoID).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found > 0 {
+		return errDepCycle
+	}
+	_, err = db.Exec(`INSERT OR IGNORE INTO todo_deps (todo_id, depends_on, created_at) VALUES (?, ?, ?)`,
+		todoID, dependsOn, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// RemoveDependency drops one dependency of todoID, or all of them when
+// dependsOn is 0. It returns how many were removed.
+func RemoveDependency(todoID, dependsOn int64) (int64, error) {
+	var res sql.Result
+	var err error
+	if dependsOn == 0 {
+		res, err = db.Exec(`DELETE FROM todo_deps WHERE todo_id = ?`, todoID)
+	} else {
+		res, err = db.Exec(`DELETE FROM todo_deps WHERE todo_id = ? AND depends_on = ?`, todoID, dependsOn)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// fillDeps sets BlockedBy and Blocks from the dependencies between pending
+// todos; finished prerequisites no longer block anything. Only the
+// dependencies touching the given todos are read.
+func fillDeps(q sqlRunner, todos []Todo) error {
+	blockedBy := map[int64][]int64{}
+	blocks := map[int64][]int64{}
+	seen := map[[2]int64]bool{} // a pair spanning two batches comes up twice
+	for start := 0; start < len(todos); start += progressBatch {
+		batch := todos[start:min(start+progressBatch, len(todos))]
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, len(batch))
+		for i, t := range batch {
+			placeholders[i] = "?"
+			args[i] = t.ID
+		}
+		in := strings.Join(placeholders, ",")
+		rows, err := q.Query(`
+			SELECT d.todo_id, d.depends_on FROM todo_deps d
+			JOIN todos p ON p.id = d.depends_on
+			JOIN todos t ON t.id = d.todo_id
+			WHERE p.done = FALSE AND t.done = FALSE
+				AND (d.todo_id IN (`+in+`) OR d.depends_on IN (`+in+`))`, append(args, args...)...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var todoID, dependsOn int64
+			if err := rows.Scan(&todoID, &dependsOn); err != nil {
+				rows.Close()
+				return err
+			}
+			if seen[[2]int64{todoID, dependsOn}] {
+				continue
+			}
+			seen[[2]int64{todoID, dependsOn}] = true
+			blockedBy[todoID] = append(blockedBy[todoID], dependsOn)
+			blocks[dependsOn] = append(blocks[dependsOn], todoID)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	for i := range todos {
+		todos[i].BlockedBy = append([]int64{}, blockedBy[todos[i].ID]...)
+		todos[i].Blocks = append([]int64{}, blocks[todos[i].ID]...)
+		sort.Slice(todos[i].BlockedBy, func(a, b int) bool { return todos[i].BlockedBy[a] < todos[i].BlockedBy[b] })
+		sort.Slice(todos[i].Blocks, func(a, b int) bool { return todos[i].Blocks[a] < todos[i].Blocks[b] })
+		todos[i].Blocked = len(todos[i].BlockedBy) > 0
+	}
+	return nil
+}
+
+// NextActionable picks the todo to work on next: pending, not blocked
+// (itself or through a parent) and without pending subtasks, which are the
+// actionable part. Overdue and due-today todos come first, then by
+// priority, due date and age.
+func NextActionable(todos []Todo, now time.Time) *Todo {
+	byID := map[int64]Todo{}
+	pendingChildren := map[int64]bool{}
+	for _, t := range todos {
+		byID[t.ID] = t
+		if !t.Done && t.ParentID != 0 {
+			pendingChildren[t.ParentID] = true
+		}
+	}
+	blocked := func(t Todo) bool {
+		for depth := 0; depth < len(todos); depth++ {
+			if t.Blocked {
+				return true
+			}
+			parent, ok := byID[t.ParentID]
+			if !ok {
+				return false
+			}
+			t = parent
+		}
+		return false
+	}
+
+	var candidates []Todo
+	for _, t := range todos {
+		if !t.Done && !pendingChildren[t.ID] && !blocked(t) {
+			candidates = append(candidates, t)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	endOfToday := startOfDay(now).AddDate(0, 0, 1)
+	urgent := func(t Todo) bool {
+		due, _, ok := parseDueDate(t.DueDate)
+		return ok && due.Before(endOfToday)
+	}
+	rank := map[Priority]int{PriorityHigh: 0, PriorityMedium: 1, PriorityLow: 2}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if ua, ub := urgent(a), urgent(b); ua != ub {
+			return ua
+		}
+		if rank[a.Priority] != rank[b.Priority] {
+			return rank[a.Priority] < rank[b.Priority]
+		}
+		if (a.DueDate == "") != (b.DueDate == "") {
+			return a.DueDate != ""
+		}
+		if a.DueDate != b.DueDate {
+			return a.DueDate < b.DueDate
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+	return &candidates[0]
+}
+
+// formatIDs renders todo IDs as "#3, #4"
+func formatIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = "#" + strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompletingBlockedTodo(t *testing.T) {
+	openTestDB(t)
+
+	add := func(task string) int64 {
+		t.Helper()
+		todo, err := CreateTodo(&Todo{Task: task})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return todo.ID
+	}
+	design, build, deploy := add("design"), add("build"), add("deploy")
+	for _, on := range []int64{design, build} {
+		if err := AddDependency(deploy, on); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := MarkTodoDone(deploy, true, false)
+	blocked, ok := err.(*BlockedError)
+	if !ok {
+		t.Fatalf("MarkTodoDone on a blocked todo: err = %v, want *BlockedError", err)
+	}
+	if want := []int64{design, build}; !reflect.DeepEqual(blocked.BlockedBy, want) {
+		t.Errorf("BlockedBy = %v, want %v", blocked.BlockedBy, want)
+	}
+
+	todo, _ := GetTodo(deploy)
+	todo.Done = true
+	if err := UpdateTodo(todo, false); err == nil {
+		t.Error("UpdateTodo completed a blocked todo")
+	}
+	if todo, _ := GetTodo(deploy); todo.Done {
+		t.Fatal("blocked todo was completed")
+	}
+
+	// Finished prerequisites no longer block
+	MarkTodoDone(design, true, false)
+	MarkTodoDone(build, true, false)
+	if _, err := MarkTodoDone(deploy, true, false); err != nil {
+		t.Errorf("completing once unblocked: %v", err)
+	}
+}
+
+func TestForceCompletesBlockedTodo(t *testing.T) {
+	openTestDB(t)
+
+	first, _ := CreateTodo(&Todo{Task: "first"})
+	second, _ := CreateTodo(&Todo{Task: "second"})
+	if err := AddDependency(second.ID, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MarkTodoDone(second.ID, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if todo, _ := GetTodo(second.ID); !todo.Done {
+		t.Error("forced completion did not complete the todo")
+	}
+}
+
+func TestFillDepsReadsOnlyGivenTodos(t *testing.T) {
+	openTestDB(t)
+	var ids []int64
+	for _, task := range []string{"a", "b", "c", "d"} {
+		todo, err := CreateTodo(&Todo{Task: task})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, todo.ID)
+	}
+	a, b, c, d := ids[0], ids[1], ids[2], ids[3]
+	AddDependency(b, a)
+	AddDependency(d, c)
+
+	tests := []struct {
+		ids               []int64
+		blockedBy, blocks [][]int64
+	}{
+		{[]int64{b}, [][]int64{{a}}, [][]int64{{}}},
+		{[]int64{a, c}, [][]int64{{}, {}}, [][]int64{{b}, {d}}},
+		{[]int64{a, b}, [][]int64{{}, {a}}, [][]int64{{b}, {}}},
+	}
+	for _, tt := range tests {
+		todos := make([]Todo, len(tt.ids))
+		for i, id := range tt.ids {
+			todos[i].ID = id
+		}
+		if err := fillDeps(db, todos); err != nil {
+			t.Fatal(err)
+		}
+		for i, todo := range todos {
+			if !reflect.DeepEqual(todo.BlockedBy, tt.blockedBy[i]) || !reflect.DeepEqual(todo.Blocks, tt.blocks[i]) {
+				t.Errorf("fillDeps(%v): todo %d blocked by %v, blocks %v; want %v, %v",
+					tt.ids, todo.ID, todo.BlockedBy, todo.Blocks, tt.blockedBy[i], tt.blocks[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Due dates. Input like "tomorrow 9am", "next fri", "in 3d" or
+// "2026-11-01" is normalized to dueDateLayout (all-day) or dueTimeLayout
+// (timed), both in local time so they sort as strings and work with
+// SQLite's date functions. The phrase the user typed is kept in due_phrase.
+
+const (
+	dueDateLayout = "2006-01-02"
+	dueTimeLayout = "2006-01-02T15:04"
+)
+
+// dueDateLayouts are the stored formats understood when reading a due
+// date back; RFC3339 and the space-separated form predate normalization
+var dueDateLayouts = []string{dueTimeLayout, dueDateLayout, time.RFC3339, "2006-01-02 15:04"}
+
+// parseDueDate reads a stored due date and reports which layout it used
+func parseDueDate(s string) (time.Time, string, bool) {
+	for _, layout := range dueDateLayouts {
+		if t, err := time.ParseInLocation(layout, strings.TrimSpace(s), time.Local); err == nil {
+			return t, layout, true
+		}
+	}
+	return time.Time{}, "", false
+}
+
+var (
+	dueTimePattern     = regexp.MustCompile(`(?:^|\s)(?:at\s+|@\s*)?(\d{1,2})(?::(\d{2}))?\s*(am|pm)$|(?:^|\s)(?:at\s+|@\s*)?(\d{1,2}):(\d{2})$`)
+	dueNamedTime       = map[string]int{"morning": 9, "noon": 12, "midday": 12, "afternoon": 15, "evening": 18, "tonight": 20}
+	dueRelativePattern = regexp.MustCompile(`^(?:in\s+|\+)(\d+)\s*(m|mins?|minutes?|h|hrs?|hours?|d|days?|w|wks?|weeks?|mo|months?|y|yrs?|years?)$`)
+	dueMonthDayPattern = regexp.MustCompile(`^([a-z]+)\s+(\d{1,2})(?:st|nd|rd|th)?(?:,?\s+(\d{4}))?$|^(\d{1,2})(?:st|nd|rd|th)?\s+([a-z]+)(?:,?\s+(\d{4}))?$`)
+)
+
+var monthNames = map[string]time.Month{
+	"jan": time.January, "january": time.January, "feb": time.February, "february": time.February,
+	"mar": time.March, "march": time.March, "apr": time.April, "april": time.April,
+	"may": time.May, "jun": time.June, "june": time.June, "jul": time.July, "july": time.July,
+	"aug": time.August, "august": time.August, "sep": time.September, "sept": time.September,
+	"september": time.September, "oct": time.October, "october": time.October,
+	"nov": time.November, "november": time.November, "dec": time.December, "december": time.December,
+}
+
+// NormalizeDueDate parses a due date phrase relative to now. It returns the
+// normalized date, or "" for empty input, and an error for anything it
+// can't understand (including impossible dates like 2025-13-45).
+//
+// Bare weekdays ("fri") mean the next such day, today included; "next fri"
+// is the one a week after that.
+func NormalizeDueDate(phrase string, now time.Time) (string, error) {
+	s := strings.Join(strings.Fields(strings.ToLower(phrase)), " ")
+	if s == "" {
+		return "", nil
+	}
+
+	// Already normalized, or a full timestamp
+	if t, layout, ok := parseDueDate(phrase); ok {
+		if layout == dueDateLayout {
+			return t.Format(dueDateLayout), nil
+		}
+		return t.In(time.Local).Format(dueTimeLayout), nil
+	}
+
+	// "in 3h" / "in 30m" are the only relative forms that carry a time
+	if m := dueRelativePattern.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch unit := m[2]; {
+		case unit == "m" || strings.HasPrefix(unit, "min"):
+			return now.Add(time.Duration(n) * time.Minute).Format(dueTimeLayout), nil
+		case strings.HasPrefix(unit, "h"):
+			return now.Add(time.Duration(n) * time.Hour).Format(dueTimeLayout), nil
+		}
+	}
+
+	datePart, hour, minute, hasTime, err := splitDueTime(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid due date %q: %v", phrase, err)
+	}
+
+	today := startOfDay(now)
+	var day time.Time
+	if datePart == "" {
+		// A time on its own is today, or tomorrow if it has already passed
+		day = today
+		if hasTime && time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location()).Before(now) {
+			day = day.AddDate(0, 0, 1)
+		}
+	} else {
+		var ok bool
+		day, ok = parseDueDay(datePart, today)
+		if !ok {
+			return "", fmt.Errorf("invalid due date %q (try tomorrow 9am, next fri, in 3d or 2026-11-01)", phrase)
+		}
+	}
+
+	if !hasTime {
+		return day.Format(dueDateLayout), nil
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location()).Format(dueTimeLayout), nil
+}
+
+// splitDueTime separates a trailing time ("9am", "at 14:30", "noon") from
+// the date part of a phrase
+func splitDueTime(s string) (string, int, int, bool, error) {
+	if s == "tonight" {
+		return "today", dueNamedTime[s], 0, true, nil
+	}
+	for name, hour := range dueNamedTime {
+		if s == name || strings.HasSuffix(s, " "+name) {
+			rest := strings.TrimSpace(strings.TrimSuffix(s, name))
+			return strings.TrimSpace(strings.TrimSuffix(rest, " at")), hour, 0, true, nil
+		}
+	}
+
+	m := dueTimePattern.FindStringSubmatchIndex(s)
+	if m == nil {
+		return s, 0, 0, false, nil
+	}
+	group := func(i int) string {
+		if m[2*i] < 0 {
+			return ""
+		}
+		return s[m[2*i]:m[2*i+1]]
+	}
+
+	var hour, minute int
+	if group(1) != "" {
+		hour, _ = strconv.Atoi(group(1))
+		minute, _ = strconv.Atoi(group(2))
+		if hour < 1 || hour > 12 {
+			return "", 0, 0, false, fmt.Errorf("hour %d out of range", hour)
+		}
+		if group(3) == "pm" && hour != 12 {
+			hour += 12
+		} else if group(3) == "am" && hour == 12 {
+			hour = 0
+		}
+	} else {
+		hour, _ = strconv.Atoi(group(4))
+		minute, _ = strconv.Atoi(group(5))
+		if hour > 23 {
+			return "", 0, 0, false, fmt.Errorf("hour %d out of range", hour)
+		}
+	}
+	if minute > 59 {
+		return "", 0, 0, false, fmt.Errorf("minute %d out of range", minute)
+	}
+	return strings.TrimSpace(s[:m[0]]), hour, minute, true, nil
+}
+
+// parseDueDay resolves the date part of a phrase to midnight of that day
+func parseDueDay(s string, today time.Time) (time.Time, bool) {
+	switch s {
+	case "today", "tod":
+		return today, true
+	case "tomorrow", "tmr", "tmrw", "tom":
+		return today.AddDate(0, 0, 1), true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	case "next week":
+		return nextWeekday(today.AddDate(0, 0, 1), time.Monday), true
+	case "next month":
+		return time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location()), true
+	case "end of week", "eow":
+		return nextWeekday(today, time.Friday), true
+	case "end of month", "eom":
+		return time.Date(today.Year(), today.Month()+1, 0, 0, 0, 0, 0, today.Location()), true
+	}
+
+	if t, err := time.ParseInLocation(dueDateLayout, s, today.Location()); err == nil {
+		return t, true
+	}
+
+	if m := dueRelativePattern.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch unit := m[2]; {
+		case strings.HasPrefix(unit, "d"):
+			return today.AddDate(0, 0, n), true
+		case strings.HasPrefix(unit, "w"):
+			return today.AddDate(0, 0, 7*n), true
+		case strings.HasPrefix(unit, "mo"):
+			return today.AddDate(0, n, 0), true
+		case strings.HasPrefix(unit, "y"):
+			return today.AddDate(n, 0, 0), true
+		}
+		return time.Time{}, false
+	}
+
+	// "fri", "this fri", "next fri"
+	words := strings.Fields(s)
+	if wds, ok := weekdayNames[words[len(words)-1]]; ok && len(wds) == 1 && len(words) <= 2 {
+		day := nextWeekday(today, wds[0])
+		switch {
+		case len(words) == 1, words[0] == "this", words[0] == "on":
+			return day, true
+		case words[0] == "next":
+			return day.AddDate(0, 0, 7), true
+		}
+		return time.Time{}, false
+	}
+
+	// "nov 1", "1 november 2026"; without a year the next such date
+	if m := dueMonthDayPattern.FindStringSubmatch(s); m != nil {
+		monthName, dayStr, yearStr := m[1], m[2], m[3]
+		if monthName == "" {
+			monthName, dayStr, yearStr = m[5], m[4], m[6]
+		}
+		month, ok := monthNames[monthName]
+		if !ok {
+			return time.Time{}, false
+		}
+		d, _ := strconv.Atoi(dayStr)
+		year := today.Year()
+		if yearStr != "" {
+			year, _ = strconv.Atoi(yearStr)
+		}
+		t := time.Date(year, month, d, 0, 0, 0, 0, today.Location())
+		if t.Day() != d {
+			return time.Time{}, false // e.g. feb 30
+		}
+		if yearStr == "" && t.Before(today) {
+			t = t.AddDate(1, 0, 0)
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// nextWeekday returns the first day on or after from that falls on wd
+func nextWeekday(from time.Time, wd time.Weekday) time.Time {
+	return from.AddDate(0, 0, (int(wd)-int(from.Weekday())+7)%7)
+}
+
+// ResolveDueDate normalizes user input and returns the date to store along
+// with the phrase to keep, which is empty when the input was already a date
+func ResolveDueDate(input string, now time.Time) (due, phrase string, err error) {
+	due, err = NormalizeDueDate(input, now)
+	if err != nil {
+		return "", "", err
+	}
+	input = strings.TrimSpace(input)
+	if input != due {
+		phrase = input
+	}
+	return due, phrase, nil
+}
+
+// FormatDue renders a stored due date for display, e.g. "Sat 17 Oct 09:00"
+func FormatDue(due string) string {
+	t, layout, ok := parseDueDate(due)
+	if !ok {
+		return due
+	}
+	format := "Mon 2 Jan"
+	if t.Year() != time.Now().Year() {
+		format += " 2006"
+	}
+	if layout != dueDateLayout {
+		format += " 15:04"
+	}
+	return t.Format(format)
+}
+
+// normalizeLegacyDueDates adds due_phrase and rewrites free-text due dates
+// (migration 11). Values that can't be parsed move to due_phrase so they
+// are not lost; relative phrases are resolved against the creation time.
+func normalizeLegacyDueDates(tx *sql.Tx) error {
+	if _, err := tx.Exec(`ALTER TABLE todos ADD COLUMN due_phrase TEXT DEFAULT ''`); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, due_date, created_at FROM todos WHERE due_date != ''`)
+	if err != nil {
+		return err
+	}
+	type fix struct {
+		id          int64
+		due, phrase string
+	}
+	var fixes []fix
+	for rows.Next() {
+		var id int64
+		var due string
+		var createdAt sql.NullString // the original schema allowed NULL
+		if err := rows.Scan(&id, &due, &createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		created, err := time.Parse(time.RFC3339, createdAt.String)
+		if err != nil {
+			created = time.Now()
+		}
+		normalized, phrase, err := ResolveDueDate(due, created.In(time.Local))
+		if err != nil {
+			normalized, phrase = "", due
+		}
+		if normalized != due {
+			fixes = append(fixes, fix{id, normalized, phrase})
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fixes {
+		if _, err := tx.Exec(`UPDATE todos SET due_date=?, due_phrase=? WHERE id=?`, f.due, f.phrase, f.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeDueDate(t *testing.T) {
+	// Friday 16 October 2026, mid-morning
+	now := time.Date(2026, 10, 16, 10, 30, 0, 0, time.Local)
+	tests := []struct {
+		phrase, want string
+		wantErr      bool
+	}{
+		{"", "", false},
+		{"today", "2026-10-16", false},
+		{"tomorrow 9am", "2026-10-17T09:00", false},
+		{"tmrw at 14:30", "2026-10-17T14:30", false},
+		{"tomorrow 12am", "2026-10-17T00:00", false},
+		{"9am", "2026-10-17T09:00", false}, // already past today
+		{"5pm", "2026-10-16T17:00", false},
+		{"noon", "2026-10-16T12:00", false},
+		{"tonight", "2026-10-16T20:00", false},
+		{"fri", "2026-10-16", false}, // bare weekdays include today
+		{"mon", "2026-10-19", false},
+		{"Next  FRI 6pm", "2026-10-23T18:00", false},
+		{"next week", "2026-10-19", false},
+		{"eow", "2026-10-16", false},
+		{"end of month", "2026-10-31", false},
+		{"next month", "2026-11-01", false},
+		{"in 3d", "2026-10-19", false},
+		{"in 2w", "2026-10-30", false},
+		{"+1mo", "2026-11-16", false},
+		{"in 30m", "2026-10-16T11:00", false},
+		{"in 3h", "2026-10-16T13:30", false},
+		{"nov 1", "2026-11-01", false},
+		{"oct 1", "2027-10-01", false}, // already past this year
+		{"1st november 2027", "2027-11-01", false},
+		{"2026-11-01", "2026-11-01", false},
+		{"2026-11-01T09:00", "2026-11-01T09:00", false},
+
+		{"2025-13-45", "", true},
+		{"feb 30", "", true},
+		{"blursday", "", true},
+		{"tomorrow 13pm", "", true},
+		{"today 10:75", "", true},
+		{"last fri", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeDueDate(tt.phrase, now)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeDueDate(%q) error = %v, wantErr %v", tt.phrase, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeDueDate(%q) = %q, want %q", tt.phrase, got, tt.want)
+		}
+	}
+}
+
+func TestResolveDueDateKeepsPhrase(t *testing.T) {
+	now := time.Date(2026, 10, 16, 10, 30, 0, 0, time.Local)
+	tests := []struct {
+		input, due, phrase string
+	}{
+		{"tomorrow", "2026-10-17", "tomorrow"},
+		{" 2026-11-01 ", "2026-11-01", ""},
+	}
+	for _, tt := range tests {
+		due, phrase, err := ResolveDueDate(tt.input, now)
+		if err != nil {
+			t.Fatalf("ResolveDueDate(%q): %v", tt.input, err)
+		}
+		if due != tt.due || phrase != tt.phrase {
+			t.Errorf("ResolveDueDate(%q) = %q, %q; want %q, %q", tt.input, due, phrase, tt.due, tt.phrase)
+		}
+	}
+}
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// `vault todo edit` and `vault item edit`: a todo or vault item is written
+// as a front-matter document (a small YAML subset of "key: value" lines
+// between --- markers, with an item's content as the body), opened in
+// $EDITOR, and applied when saved.
+// Flags make the same changes without an editor.
+
+// frontMatter is the parsed header of a document, keyed by field name
+type frontMatter map[string]string
+
+// yamlString quotes a value when plain YAML would misread it
+func yamlString(s string) string {
+	if s == "" {
+		return `""`
+	}
+	if strings.TrimSpace(s) != s || strings.ContainsAny(s, ":#[]{},&*!|>'\"%@`\n") ||
+		strings.ContainsAny(s[:1], "-?") {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "null", "~":
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// yamlList renders a flow sequence, e.g. [go, reading]
+func yamlList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, s := range items {
+		quoted[i] = yamlString(s)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// parseFrontMatter splits a document into its header fields and body.
+// Values may be plain, "double" or 'single' quoted; lists are written
+// [a, b] or as "- a" lines below the key.
+func parseFrontMatter(doc string) (frontMatter, string, error) {
+	lines := strings.Split(strings.ReplaceAll(doc, "\r\n", "\n"), "\n")
+	i := 0
+	for i < len(lines) && (strings.TrimSpace(lines[i]) == "" || strings.HasPrefix(strings.TrimSpace(lines[i]), "#")) {
+		i++
+	}
+	if i == len(lines) || strings.TrimSpace(lines[i]) != "---" {
+		return nil, "", errors.New("document must start with a --- line")
+	}
+
+	fields := frontMatter{}
+	listKey := ""
+	for i++; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "---" {
+			// itemDocument ends the body with a newline of its own
+			body := strings.Join(lines[i+1:], "\n")
+			return fields, strings.TrimSuffix(body, "\n"), nil
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") && listKey != "" {
+			item, err := yamlScalar(strings.TrimSpace(trimmed[2:]))
+			if err != nil {
+				return nil, "", fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if fields[listKey] != "" {
+				fields[listKey] += ","
+			}
+			fields[listKey] += item
+			continue
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, "", fmt.Errorf("line %d: expected \"key: value\"", i+1)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if _, dup := fields[key]; dup {
+			return nil, "", fmt.Errorf("line %d: %s is set twice", i+1, key)
+		}
+		listKey = ""
+		if value == "" {
+			listKey = key // a block list may follow
+			fields[key] = ""
+			continue
+		}
+		if strings.HasPrefix(value, "[") {
+			if !strings.HasSuffix(value, "]") {
+				return nil, "", fmt.Errorf("line %d: unterminated list", i+1)
+			}
+			var items []string
+			for _, part := range splitFlowList(value[1 : len(value)-1]) {
+				item, err := yamlScalar(part)
+				if err != nil {
+					return nil, "", fmt.Errorf("line %d: %w", i+1, err)
+				}
+				if item != "" {
+					items = append(items, item)
+				}
+			}
+			fields[key] = strings.Join(items, ",")
+			continue
+		}
+		v, err := yamlScalar(value)
+		if err != nil {
+			return nil, "", fmt.Errorf("line %d: %w", i+1, err)
+		}
+		fields[key] = v
+	}
+	return nil, "", errors.New("front matter isn't closed with a --- line")
+}
+
+// yamlScalar unquotes a scalar and drops a trailing comment
+func yamlScalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := closingQuote(s)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i++
+					continue
+				}
+				return strings.ReplaceAll(s[1:i], "''", "'"), nil
+			}
+		}
+		return "", fmt.Errorf("unterminated string %s", s)
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if s == "~" || s == "null" {
+		return "", nil
+	}
+	return s, nil
+}
+
+// closingQuote finds the end of a double-quoted string
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// splitFlowList splits "a, "b, c", d" on commas outside quotes
+func splitFlowList(s string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseBool reads a YAML boolean
+func parseBool(key, v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "true", "yes", "y", "on", "x":
+		return true, nil
+	case "false", "no", "n", "off", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("%s: expected true or false, got %q", key, v)
+}
+
+// checkFields rejects fields a document type doesn't have
+func checkFields(fields frontMatter, allowed ...string) error {
+	known := map[string]bool{}
+	for _, k := range allowed {
+		known[k] = true
+	}
+	for k := range fields {
+		if !known[k] {
+			return fmt.Errorf("unknown field %q (fields: %s)", k, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// todoDocument renders a todo for editing
+func todoDocument(t *Todo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Editing todo %d. Save and quit to apply; delete everything to cancel.\n", t.ID)
+	fmt.Fprintf(&b, "# due takes a date or a phrase (tomorrow, next fri 9am); parent is a todo id.\n")
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "task: %s\n", yamlString(t.Task))
+	fmt.Fprintf(&b, "done: %t\n", t.Done)
+	fmt.Fprintf(&b, "priority: %s\n", t.Priority)
+	fmt.Fprintf(&b, "category: %s\n", yamlString(t.Category))
+	due := t.DueDate
+	if due == "" {
+		due = t.DuePhrase
+	}
+	fmt.Fprintf(&b, "due: %s\n", yamlString(due))
+	fmt.Fprintf(&b, "recurrence: %s\n", yamlString(t.Recurrence))
+	if t.ParentID != 0 {
+		fmt.Fprintf(&b, "parent: %d\n", t.ParentID)
+	} else {
+		b.WriteString("parent: \"\"\n")
+	}
+	b.WriteString("---\n")
+	return b.String()
+}
+
+// applyTodoFields validates edited fields onto a copy of the todo
+func applyTodoFields(prev *Todo, fields frontMatter) (*Todo, error) {
+	if err := checkFields(fields, "task", "done", "priority", "category", "due", "recurrence", "parent"); err != nil {
+		return nil, err
+	}
+	t := *prev
+	var err error
+	for key, v := range fields {
+		switch key {
+		case "task":
+			if strings.TrimSpace(v) == "" {
+				return nil, errors.New("task can't be empty")
+			}
+			t.Task = strings.TrimSpace(v)
+		case "done":
+			if t.Done, err = parseBool(key, v); err != nil {
+				return nil, err
+			}
+		case "priority":
+			switch p := Priority(strings.ToLower(v)); p {
+			case PriorityLow, PriorityMedium, PriorityHigh:
+				t.Priority = p
+			case "":
+				t.Priority = PriorityMedium
+			default:
+				return nil, fmt.Errorf("priority: expected low, medium or high, got %q", v)
+			}
+		case "category":
+			t.Category = strings.TrimSpace(v)
+		case "due":
+			// Saving back the stored date keeps the phrase it came from
+			if v == prev.DueDate && v != "" || v == prev.DuePhrase && prev.DueDate == "" {
+				continue
+			}
+			if t.DueDate, t.DuePhrase, err = ResolveDueDate(v, time.Now()); err != nil {
+				return nil, fmt.Errorf("due: %w", err)
+			}
+		case "recurrence":
+			if t.Recurrence, err = NormalizeRecurrence(v); err != nil {
+				return nil, fmt.Errorf("recurrence: %w", err)
+			}
+		case "parent":
+			t.ParentID = 0
+			if v = strings.TrimPrefix(strings.TrimSpace(v), "#"); v != "" {
+				if t.ParentID, err = strconv.ParseInt(v, 10, 64); err != nil {
+					return nil, fmt.Errorf("parent: expected a todo id, got %q", v)
+				}
+			}
+		}
+	}
+	if err := checkParent(db, t.ID, t.ParentID); err != nil {
+		return nil, fmt.Errorf("parent: %w", err)
+	}
+	return &t, nil
+}
+
+// itemDocument renders a vault item for editing; the content is the body
+func itemDocument(item *VaultItem) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Editing vault item %d (%s). Save and quit to apply; delete everything to cancel.\n", item.ID, item.ContentType)
+	if item.URL != "" {
+		fmt.Fprintf(&b, "# url: %s\n", item.URL)
+	}
+	fmt.Fprintf(&b, "# The text after the second --- is the item's content.\n")
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", yamlString(item.Title))
+	tags := make([]string, len(item.Tags))
+	for i, t := range item.Tags {
+		tags[i] = t.Name
+	}
+	fmt.Fprintf(&b, "tags: %s\n", yamlList(tags))
+	fmt.Fprintf(&b, "pinned: %t\n", item.Pinned)
+	fmt.Fprintf(&b, "archived: %t\n", item.Archived)
+	b.WriteString("---\n")
+	if item.Content != "" {
+		b.WriteString(item.Content)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// itemEdit is a validated change to a vault item
+type itemEdit struct {
+	item *VaultItem
+	tags []string // nil leaves the tags alone
+}
+
+func applyItemFields(prev *VaultItem, fields frontMatter, body string) (*itemEdit, error) {
+	if err := checkFields(fields, "title", "tags", "pinned", "archived"); err != nil {
+		return nil, err
+	}
+	item := *prev
+	edit := &itemEdit{item: &item}
+	var err error
+	for key, v := range fields {
+		switch key {
+		case "title":
+			item.Title = strings.TrimSpace(v)
+		case "tags":
+			edit.tags = []string{}
+			for _, tag := range strings.Split(v, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					edit.tags = append(edit.tags, tag)
+				}
+			}
+		case "pinned":
+			if item.Pinned, err = parseBool(key, v); err != nil {
+				return nil, err
+			}
+		case "archived":
+			if item.Archived, err = parseBool(key, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	item.Content = body
+	if item.ContentType == ContentTypeNote && strings.TrimSpace(item.Content) == "" {
+		return nil, errors.New("a note needs some content")
+	}
+	return edit, nil
+}
+
+func saveItemEdit(edit *itemEdit) error {
+	if err := UpdateVaultItem(edit.item.ID, edit.item); err != nil {
+		return err
+	}
+	if edit.tags != nil {
+		return SetItemTags(edit.item.ID, edit.tags)
+	}
+	return nil
+}
+
+// editInEditor opens doc in the user's editor until apply accepts it. It
+// returns false if the user cancelled or changed nothing.
+func editInEditor(doc string, apply func(edited string) error) (bool, error) {
+	f, err := os.CreateTemp("", "vault-edit-*.md")
+	if err != nil {
+		return false, err
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	current := doc
+	for {
+		if err := os.WriteFile(path, []byte(current), 0600); err != nil {
+			return false, err
+		}
+		if err := runEditor(path); err != nil {
+			return false, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		edited := string(data)
+		if strings.TrimSpace(edited) == "" || edited == doc {
+			return false, nil
+		}
+
+		err = apply(edited)
+		if err == nil {
+			return true, nil
+		}
+		fmt.Println("Error:", err)
+		if !confirm("Edit again?") {
+			return false, nil
+		}
+		current = "# Error: " + err.Error() + "\n" + stripErrorComments(edited)
+	}
+}
+
+// stripErrorComments drops the error lines added by a previous attempt
+func stripErrorComments(doc string) string {
+	for strings.HasPrefix(doc, "# Error: ") {
+		_, doc, _ = strings.Cut(doc, "\n")
+	}
+	return doc
+}
+
+// runEditor runs $VISUAL or $EDITOR (default vi) on a file. The variable
+// may carry arguments, e.g. "code --wait".
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %q: %w", editor, err)
+	}
+	return nil
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to yes
+func confirm(question string) bool {
+	fmt.Printf("%s [Y/n] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// handleEditTodo edits a todo in $EDITOR, or sets the fields given as flags
+func handleEditTodo(a *cmdArgs) {
+	id, ok := a.ID()
+	if !ok {
+		return
+	}
+	editTodo(id, a.Has("--force"), flagFields(a, map[string]string{
+		"--task": "task", "-p": "priority", "-c": "category", "-d": "due",
+		"-r": "recurrence", "--under": "parent",
+	}, map[string][2]string{
+		"--done": {"done", "true"}, "--undone": {"done", "false"},
+	}))
+}
+
+// handleEditItem edits a vault item in $EDITOR, or sets the fields given as
+// flags; --content replaces the body
+func handleEditItem(a *cmdArgs) {
+	id, ok := a.ID()
+	if !ok {
+		return
+	}
+	fields := flagFields(a, map[string]string{"--title": "title", "-t": "tags"}, map[string][2]string{
+		"--pin": {"pinned", "true"}, "--unpin": {"pinned", "false"},
+		"--archive": {"archived", "true"}, "--unarchive": {"archived", "false"},
+	})
+	var body *string
+	if a.Has("--content") {
+		content := a.Value("--content")
+		body = &content
+	}
+	editItem(id, fields, body)
+}
+
+// flagFields maps the given flags onto document fields. toggles are
+// boolean flags that set a field to a fixed value.
+func flagFields(a *cmdArgs, flags map[string]string, toggles map[string][2]string) frontMatter {
+	fields := frontMatter{}
+	for flag, key := range flags {
+		if a.Has(flag) {
+			fields[key] = a.Value(flag)
+		}
+	}
+	for flag, t := range toggles {
+		if a.Has(flag) {
+			fields[t[0]] = t[1]
+		}
+	}
+	return fields
+}
+
+func editTodo(id int64, force bool, fields frontMatter) {
+	prev, err := GetTodo(id)
+	if err != nil {
+		fmt.Println("Todo not found")
+		return
+	}
+
+	var updated *Todo
+	if len(fields) > 0 {
+		updated, err = applyTodoFields(prev, fields)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	} else {
+		changed, err := editInEditor(todoDocument(prev), func(doc string) error {
+			fields, _, err := parseFrontMatter(doc)
+			if err != nil {
+				return err
+			}
+			updated, err = applyTodoFields(prev, fields)
+			return err
+		})
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if !changed {
+			fmt.Println("No changes")
+			return
+		}
+	}
+
+	if err := UpdateTodo(updated, force); err != nil {
+		fmt.Println("Error:", err)
+		if _, blocked := err.(*BlockedError); blocked {
+			fmt.Println("  Use --force to complete it anyway")
+		}
+		return
+	}
+	fmt.Printf("Updated: [%d] %s\n", updated.ID, updated.Task)
+}
+
+func editItem(id int64, fields frontMatter, body *string) {
+	prev, err := GetVaultItem(id)
+	if err != nil {
+		fmt.Println("Item not found")
+		return
+	}
+
+	var edit *itemEdit
+	if len(fields) > 0 || body != nil {
+		content := prev.Content
+		if body != nil {
+			content = *body
+		}
+		edit, err = applyItemFields(prev, fields, content)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	} else {
+		changed, err := editInEditor(itemDocument(prev), func(doc string) error {
+			fields, body, err := parseFrontMatter(doc)
+			if err != nil {
+				return err
+			}
+			edit, err = applyItemFields(prev, fields, body)
+			return err
+		})
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if !changed {
+			fmt.Println("No changes")
+			return
+		}
+	}
+
+	if err := saveItemEdit(edit); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	title := edit.item.Title
+	if title == "" {
+		title = edit.item.MetaTitle
+	}
+	fmt.Printf("Updated: [%d] %s\n", id, title)
+}
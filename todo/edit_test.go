@@ -0,0 +1,159 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestYamlStringRoundTrip(t *testing.T) {
+	values := []string{
+		"plain words",
+		"",
+		`say "hi"`,
+		"it's",
+		"C# and #hashtags",
+		"key: value",
+		"- leading dash",
+		"? question",
+		"true",
+		"null",
+		"  padded  ",
+		"tab\there",
+		"[not a list]",
+		"50% done, maybe",
+		"naïve café",
+		`back\slash`,
+	}
+	for _, v := range values {
+		doc := "---\nvalue: " + yamlString(v) + "\n---\n"
+		fields, _, err := parseFrontMatter(doc)
+		if err != nil {
+			t.Errorf("%q written as %s: %v", v, yamlString(v), err)
+			continue
+		}
+		if got := fields["value"]; got != v {
+			t.Errorf("%q written as %s reads back as %q", v, yamlString(v), got)
+		}
+	}
+}
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name, doc string
+		fields    frontMatter
+		body      string
+		wantErr   bool
+	}{
+		{
+			name:   "comments and quotes",
+			doc:    "# header\n\n---\ntitle: Go # a comment\nsingle: 'it''s: #1'\ndouble: \"a \\\"b\\\" # c\"\nempty: ~\n---\n",
+			fields: frontMatter{"title": "Go", "single": "it's: #1", "double": `a "b" # c`, "empty": ""},
+		},
+		{
+			name:   "flow and block lists",
+			doc:    "---\nTags: [go, \"a b\", 'c']\nmore:\n  - x\n  - \"- y\"\n---\n",
+			fields: frontMatter{"tags": "go,a b,c", "more": "x,- y"},
+		},
+		{
+			name:   "body keeps its own newlines",
+			doc:    "---\ntitle: t\n---\n\nfirst\n\nlast\n\n",
+			fields: frontMatter{"title": "t"},
+			body:   "\nfirst\n\nlast\n",
+		},
+		{name: "no opening marker", doc: "title: t\n---\n", wantErr: true},
+		{name: "not closed", doc: "---\ntitle: t\n", wantErr: true},
+		{name: "set twice", doc: "---\na: 1\nA: 2\n---\n", wantErr: true},
+		{name: "unterminated string", doc: "---\na: \"open\n---\n", wantErr: true},
+		{name: "unterminated list", doc: "---\na: [x, y\n---\n", wantErr: true},
+		{name: "not key value", doc: "---\njust text\n---\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		fields, body, err := parseFrontMatter(tt.doc)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: no error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(fields, tt.fields) || body != tt.body {
+			t.Errorf("%s: got %v, body %q; want %v, body %q", tt.name, fields, body, tt.fields, tt.body)
+		}
+	}
+}
+
+func TestTodoDocumentRoundTrip(t *testing.T) {
+	openTestDB(t)
+	prev := &Todo{
+		ID:         7,
+		Task:       `- fix "quoted": thing # now`,
+		Priority:   PriorityHigh,
+		Category:   "C#",
+		DueDate:    "2026-10-20T09:00",
+		DuePhrase:  "tue 9am",
+		Recurrence: "every mon,wed",
+	}
+	fields, _, err := parseFrontMatter(todoDocument(prev))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := applyTodoFields(prev, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, prev) {
+		t.Errorf("unchanged document gives\n%+v, want\n%+v", *got, *prev)
+	}
+
+	fields["priority"], fields["done"], fields["due"] = "low", "yes", "2026-11-01"
+	if got, err = applyTodoFields(prev, fields); err != nil {
+		t.Fatal(err)
+	}
+	if got.Priority != PriorityLow || !got.Done || got.DueDate != "2026-11-01" || got.DuePhrase != "" {
+		t.Errorf("edited fields not applied: %+v", *got)
+	}
+
+	for _, bad := range []frontMatter{{"task": " "}, {"priority": "urgent"}, {"done": "maybe"}, {"colour": "red"}, {"parent": "abc"}} {
+		if _, err := applyTodoFields(prev, bad); err == nil {
+			t.Errorf("applyTodoFields(%v): no error", bad)
+		}
+	}
+}
+
+func TestItemDocumentRoundTrip(t *testing.T) {
+	for _, content := range []string{"", "one line", "ends with a newline\n", "--- not a marker\n# not a comment\n\n"} {
+		prev := &VaultItem{
+			ID:          3,
+			ContentType: ContentTypeArticle,
+			Title:       "Tom's: \"notes\" #1",
+			Content:     content,
+			Tags:        []Tag{{Name: "go"}, {Name: "-dash"}, {Name: "c#"}},
+			Pinned:      true,
+		}
+		fields, body, err := parseFrontMatter(itemDocument(prev))
+		if err != nil {
+			t.Fatal(err)
+		}
+		edit, err := applyItemFields(prev, fields, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if edit.item.Title != prev.Title || edit.item.Content != content || !edit.item.Pinned || edit.item.Archived {
+			t.Errorf("content %q: got title %q, content %q, pinned %v, archived %v",
+				content, edit.item.Title, edit.item.Content, edit.item.Pinned, edit.item.Archived)
+		}
+		if want := []string{"go", "-dash", "c#"}; !reflect.DeepEqual(edit.tags, want) {
+			t.Errorf("content %q: tags %v, want %v", content, edit.tags, want)
+		}
+	}
+
+	note := &VaultItem{ContentType: ContentTypeNote, Content: "x"}
+	fields, body, _ := parseFrontMatter(strings.Replace(itemDocument(note), "x\n", "  \n", 1))
+	if _, err := applyItemFields(note, fields, body); err == nil {
+		t.Error("emptied note accepted")
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Background metadata fetching. Saving a link records the item right away
+// with meta_status "pending" and queues a job; workers fetch metadata,
+// thumbnails and snapshots later, retrying with exponential backoff.
+
+// Metadata fetch states stored in vault_items.meta_status
+const (
+	MetaStatusPending = "pending"
+	MetaStatusOK      = "ok"
+	MetaStatusFailed  = "failed"
+)
+
+const (
+	maxFetchAttempts = 5
+	fetchBackoffBase = 30 * time.Second
+	fetchBackoffMax  = time.Hour
+	fetchJobStale    = 5 * time.Minute // running jobs older than this were abandoned
+	fetchPollEvery   = 5 * time.Second
+)
+
+// fetchQueueSchema adds the job table and per-item fetch state (migration 6)
+const fetchQueueSchema = `
+	ALTER TABLE vault_items ADD COLUMN meta_status TEXT DEFAULT 'ok';
+	ALTER TABLE vault_items ADD COLUMN meta_error TEXT DEFAULT '';
+	ALTER TABLE vault_items ADD COLUMN meta_attempts INTEGER DEFAULT 0;
+
+	CREATE TABLE fetch_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		item_id INTEGER NOT NULL UNIQUE,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT DEFAULT '',
+		keep_html BOOLEAN DEFAULT FALSE,
+		run_after TEXT NOT NULL,
+		locked_at TEXT DEFAULT '',
+		created_at TEXT NOT NULL,
+		updated_at TEXT NOT NULL,
+		FOREIGN KEY (item_id) REFERENCES vault_items(id) ON DELETE CASCADE
+	);
+
+	CREATE INDEX idx_fetch_jobs_status ON fetch_jobs(status, run_after);
+	`
+
+// FetchJob is a queued metadata fetch for one vault item
+type FetchJob struct {
+	ID       int64
+	ItemID   int64
+	Attempts int
+	KeepHTML bool
+}
+
+// fetchWake nudges in-process workers when a job is queued
+var fetchWake = make(chan struct{}, 1)
+
+// queueTime formats t for run_after and locked_at. Those are compared as
+// strings, so they are always UTC; local offsets sort wrongly across a DST
+// or time zone change.
+func queueTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// EnqueueFetch queues (or re-queues) a metadata fetch for an item and
+// marks the item pending. Attempts start again from zero.
+func EnqueueFetch(itemID int64, keepHTML bool) error {
+	now := time.Now()
+	_, err := db.Exec(`
+		INSERT INTO fetch_jobs (item_id, status, attempts, last_error, keep_html, run_after, created_at, updated_at)
+		VALUES (?, 'pending', 0, '', ?, ?, ?, ?)
+		ON CONFLICT(item_id) DO UPDATE SET
+			status='pending', attempts=0, last_error='', keep_html=excluded.keep_html,
+			run_after=excluded.run_after, locked_at='', updated_at=excluded.updated_at`,
+		itemID, keepHTML, queueTime(now), now.Format(time.RFC3339), now.Format(time.RFC3339),
+	)
+	if err != nil {
+		return err
+	}
+	if err := setMetaStatus(itemID, MetaStatusPending, "", 0); err != nil {
+		return err
+	}
+
+	select {
+	case fetchWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// EnqueueFailedFetches re-queues every item whose fetch gave up
+func EnqueueFailedFetches() (int, error) {
+	rows, err := db.Query(`SELECT id FROM vault_items WHERE meta_status = ?`, MetaStatusFailed)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := EnqueueFetch(id, false); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
+// ClaimFetchJob atomically takes the next due job, including jobs whose
+// worker died mid-run. It returns sql.ErrNoRows when nothing is due.
+func ClaimFetchJob() (*FetchJob, error) {
+	now := time.Now()
+	var job FetchJob
+	err := db.QueryRow(`
+		UPDATE fetch_jobs SET status='running', locked_at=?, updated_at=?
+		WHERE id = (
+			SELECT id FROM fetch_jobs
+			WHERE (status='pending' AND run_after <= ?)
+			   OR (status='running' AND locked_at < ?)
+			ORDER BY run_after LIMIT 1
+		)
+		RETURNING id, item_id, attempts, keep_html`,
+		queueTime(now), now.Format(time.RFC3339),
+		queueTime(now), queueTime(now.Add(-fetchJobStale)),
+	).Scan(&job.ID, &job.ItemID, &job.Attempts, &job.KeepHTML)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// completeFetchJob removes a finished job
+func completeFetchJob(job *FetchJob) error {
+	if _, err := db.Exec(`DELETE FROM fetch_jobs WHERE id=?`, job.ID); err != nil {
+		return err
+	}
+	return setMetaStatus(job.ItemID, MetaStatusOK, "", job.Attempts+1)
+}
+
+// failFetchJob records an error and either schedules a retry with
+// exponential backoff or gives up after maxFetchAttempts
+func failFetchJob(job *FetchJob, fetchErr error) error {
+	attempts := job.Attempts + 1
+	now := time.Now()
+
+	status := MetaStatusPending
+	jobStatus := "pending"
+	if attempts >= maxFetchAttempts {
+		status = MetaStatusFailed
+		jobStatus = "failed"
+	}
+
+	_, err := db.Exec(`UPDATE fetch_jobs SET status=?, attempts=?, last_error=?, run_after=?, locked_at='', updated_at=? WHERE id=?`,
+		jobStatus, attempts, fetchErr.Error(),
+		queueTime(now.Add(fetchBackoff(attempts))), now.Format(time.RFC3339), job.ID)
+	if err != nil {
+		return err
+	}
+	return setMetaStatus(job.ItemID, status, fetchErr.Error(), attempts)
+}
+
+// fetchBackoff doubles the wait after each failed attempt
+func fetchBackoff(attempts int) time.Duration {
+	d := fetchBackoffBase
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= fetchBackoffMax {
+			return fetchBackoffMax
+		}
+	}
+	return d
+}
+
+func setMetaStatus(itemID int64, status, errMsg string, attempts int) error {
+	_, err := db.Exec(`UPDATE vault_items SET meta_status=?, meta_error=?, meta_attempts=? WHERE id=?`,
+		status, errMsg, attempts, itemID)
+	return err
+}
+
+// RunFetchJob fetches metadata, thumbnail and (for articles) a readable
+// snapshot for the job's item
+func RunFetchJob(job *FetchJob) error {
+	item, err := GetVaultItem(job.ItemID)
+	if err == sql.ErrNoRows {
+		_, err = db.Exec(`DELETE FROM fetch_jobs WHERE id=?`, job.ID)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Short links are followed here rather than at save time so saving
+	// never blocks. A link that turns out to be saved already is merged
+	// into that item, which makes this job redundant.
+	if item.OriginalURL == "" && IsShortLink(item.URL) {
+		resolved, err := ResolveShortLink(item.URL)
+		if err != nil {
+			return failFetchJob(job, err)
+		}
+		// ProviderFor is nil only when the target isn't an http(s) URL,
+		// e.g. a shortener sending phones to a tg:// or intent:// link;
+		// the short link is kept then
+		if resolved != item.URL && ProviderFor(resolved) != nil {
+			item.OriginalURL = item.URL
+			item.URL = resolved
+			item.ContentType = DetectContentType(resolved)
+			updated, err := UpdateVaultItemURL(item)
+			if err != nil {
+				return err
+			}
+			if updated.Duplicate {
+				_, err = db.Exec(`DELETE FROM fetch_jobs WHERE id=?`, job.ID)
+				return err
+			}
+		}
+	}
+
+	meta, fetchErr := FetchMetadata(item.URL, item.ContentType)
+	if fetchErr != nil {
+		return failFetchJob(job, fetchErr)
+	}
+
+	item.MetaTitle = meta.Title
+	item.MetaDescription = meta.Description
+	item.MetaThumbnail = meta.Thumbnail
+	item.MetaAuthor = meta.Author
+	item.MetaSiteName = meta.SiteName
+	item.MetaPublishedAt = meta.PublishedAt
+	item.MetaCanonical = meta.CanonicalURL
+	item.MetaFavicon = meta.Favicon
+	item.MetaReadingTime = meta.ReadingTime
+	cacheItemThumbnail(item)
+	if err := UpdateVaultItemMeta(item); err != nil {
+		return err
+	}
+
+	// A missing snapshot is not worth retrying the whole fetch for
+	if item.ContentType == ContentTypeArticle {
+		CaptureSnapshot(item, job.KeepHTML)
+	}
+
+	return completeFetchJob(job)
+}
+
+// RunPendingFetches works through every job that is currently due and
+// returns how many were processed
+func RunPendingFetches(onJob func(job *FetchJob, err error)) int {
+	count := 0
+	for {
+		job, err := ClaimFetchJob()
+		if err != nil {
+			return count
+		}
+		err = RunFetchJob(job)
+		if onJob != nil {
+			onJob(job, err)
+		}
+		count++
+	}
+}
+
+// nextFetchDue returns when the next queued job can be claimed: the
+// earliest pending run_after, or when a running job counts as abandoned.
+// ok is false when the queue is empty.
+func nextFetchDue() (next time.Time, ok bool, err error) {
+	var pending, running sql.NullString
+	err = db.QueryRow(`SELECT
+		(SELECT MIN(run_after) FROM fetch_jobs WHERE status='pending'),
+		(SELECT MIN(locked_at) FROM fetch_jobs WHERE status='running')`).Scan(&pending, &running)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if t, err := time.Parse(time.RFC3339, pending.String); pending.Valid && err == nil {
+		next, ok = t, true
+	}
+	if t, err := time.Parse(time.RFC3339, running.String); running.Valid && err == nil {
+		if t = t.Add(fetchJobStale); !ok || t.Before(next) {
+			next, ok = t, true
+		}
+	}
+	return next, ok, nil
+}
+
+// RunFetchWorker processes jobs until ctx is cancelled, sleeping until the
+// next one is due. Jobs queued by other processes are picked up within
+// fetchPollEvery. With drain it returns once the queue is empty.
+func RunFetchWorker(ctx context.Context, drain bool, onJob func(job *FetchJob, err error)) error {
+	stopBeat := beatFetchWorker()
+	defer stopBeat()
+	for {
+		RunPendingFetches(onJob)
+		next, ok, err := nextFetchDue()
+		if err != nil {
+			return err
+		}
+		if !ok && drain {
+			return nil
+		}
+		wait := fetchPollEvery
+		if ok {
+			wait = min(max(time.Until(next), 0), wait)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-fetchWake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// fetchWorkerFile is touched every fetchPollEvery while a worker runs for
+// the database, so spawnFetchWorker can tell one is already around
+func fetchWorkerFile() string {
+	return strings.TrimSuffix(dbPath, filepath.Ext(dbPath)) + ".worker"
+}
+
+// beatFetchWorker keeps fetchWorkerFile fresh until the returned function
+// is called, which removes it unless another worker has taken it over
+func beatFetchWorker() (stop func()) {
+	file, pid := fetchWorkerFile(), []byte(strconv.Itoa(os.Getpid()))
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(fetchPollEvery)
+		defer ticker.Stop()
+		for {
+			os.WriteFile(file, pid, 0644)
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		if data, err := os.ReadFile(file); err == nil && bytes.Equal(data, pid) {
+			os.Remove(file)
+		}
+	}
+}
+
+// fetchWorkerRunning reports whether some process's worker has beaten
+// recently
+func fetchWorkerRunning() bool {
+	info, err := os.Stat(fetchWorkerFile())
+	return err == nil && time.Since(info.ModTime()) < 3*fetchPollEvery
+}
+
+// logFetchError prints failed fetch attempts
+func logFetchError(job *FetchJob, err error) {
+	if err != nil {
+		fmt.Printf("fetch job %d (item %d): %v\n", job.ID, job.ItemID, err)
+	}
+}
+
+// StartFetchWorkers runs n workers until ctx is cancelled. Workers poll for
+// due jobs and wake immediately when EnqueueFetch is called in-process.
+func StartFetchWorkers(ctx context.Context, n int) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := RunFetchWorker(ctx, false, logFetchError); err != nil {
+				fmt.Println("fetch worker:", err)
+			}
+		}()
+	}
+	return &wg
+}
+
+// spawnFetchWorker starts a detached `vault worker --drain` process so the
+// CLI can return immediately while metadata is fetched in the background;
+// it stays around for retries and exits when the queue is empty. Nothing
+// is started while another worker (or the server) already polls the queue.
+func spawnFetchWorker() error {
+	if fetchWorkerRunning() {
+		return nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, "--db", dbPath, "worker", "--drain")
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
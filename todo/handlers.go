@@ -1,10 +1,12 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func handleAPITodos(w http.ResponseWriter, r *http.Request) {
@@ -17,6 +19,14 @@ func handleAPITodos(w http.ResponseWriter, r *http.Request) {
 			Priority: r.URL.Query().Get("priority"),
 			Category: r.URL.Query().Get("category"),
 			Search:   r.URL.Query().Get("search"),
+			Due:      r.URL.Query().Get("due"),
+			Context:  r.URL.Query().Get("context"),
+		}
+		if filter.Due != "" {
+			if _, _, err := dueFilterClause(filter.Due, time.Now()); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 		}
 		todos, err := GetTodos(filter)
 		if err != nil {
@@ -30,10 +40,13 @@ func handleAPITodos(w http.ResponseWriter, r *http.Request) {
 
 	case "POST":
 		var input struct {
-			Task     string `json:"task"`
-			Priority string `json:"priority"`
-			Category string `json:"category"`
-			DueDate  string `json:"due_date"`
+			Task       string `json:"task"`
+			Priority   string `json:"priority"`
+			Category   string `json:"category"`
+			DueDate    string `json:"due_date"`
+			Recurrence string `json:"recurrence"`
+			ParentID   int64  `json:"parent_id"`
+			Context    string `json:"context"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -43,11 +56,30 @@ func handleAPITodos(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Task is required", http.StatusBadRequest)
 			return
 		}
-		priority := Priority(input.Priority)
-		if priority == "" {
-			priority = PriorityMedium
+		recurrence, err := NormalizeRecurrence(input.Recurrence)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		due, phrase, err := ResolveDueDate(input.DueDate, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		todo, err := CreateTodo(&Todo{
+			Task:       input.Task,
+			Priority:   Priority(input.Priority),
+			Category:   input.Category,
+			DueDate:    due,
+			DuePhrase:  phrase,
+			Recurrence: recurrence,
+			ParentID:   input.ParentID,
+			Context:    strings.TrimSpace(input.Context),
+		})
+		if err == errNoParent {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		todo, err := CreateTodo(input.Task, priority, input.Category, input.DueDate)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -82,17 +114,65 @@ func handleAPITodo(w http.ResponseWriter, r *http.Request) {
 
 	case "PUT":
 		var input struct {
-			Task     string `json:"task"`
-			Done     bool   `json:"done"`
-			Priority string `json:"priority"`
-			Category string `json:"category"`
-			DueDate  string `json:"due_date"`
+			Task       string `json:"task"`
+			Done       bool   `json:"done"`
+			Priority   string `json:"priority"`
+			Category   string `json:"category"`
+			DueDate    string `json:"due_date"`
+			Recurrence string `json:"recurrence"`
+			ParentID   *int64 `json:"parent_id"` // omitted keeps the parent, 0 detaches
+			Force      bool   `json:"force"`     // complete even if blocked
 		}
 		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
-		err := UpdateTodo(id, input.Task, input.Done, Priority(input.Priority), input.Category, input.DueDate)
+		recurrence, err := NormalizeRecurrence(input.Recurrence)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		due, phrase, err := ResolveDueDate(input.DueDate, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		prev, err := GetTodo(id)
+		if err != nil {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		// Saving back the stored date keeps the phrase it came from
+		if prev.DueDate == due && phrase == "" {
+			phrase = prev.DuePhrase
+		}
+		parentID := prev.ParentID
+		if input.ParentID != nil {
+			parentID = *input.ParentID
+		}
+		err = UpdateTodo(&Todo{
+			ID:         id,
+			Task:       input.Task,
+			Done:       input.Done,
+			Priority:   Priority(input.Priority),
+			Category:   input.Category,
+			DueDate:    due,
+			DuePhrase:  phrase,
+			Recurrence: recurrence,
+			ParentID:   parentID,
+		}, input.Force)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		if err == errNoParent || err == errSubtaskCycle {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, blocked := err.(*BlockedError); blocked {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -101,16 +181,29 @@ func handleAPITodo(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(todo)
 
 	case "PATCH":
-		// Quick toggle done status
+		// Quick toggle done status; a blocked todo needs "force"
 		var input struct {
-			Done *bool `json:"done"`
+			Done  *bool `json:"done"`
+			Force bool  `json:"force"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
 		if input.Done != nil {
-			MarkTodoDone(id, *input.Done)
+			_, err := MarkTodoDone(id, *input.Done, input.Force)
+			if _, blocked := err.(*BlockedError); blocked {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			if err == sql.ErrNoRows {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 		}
 		todo, _ := GetTodo(id)
 		json.NewEncoder(w).Encode(todo)
@@ -128,6 +221,37 @@ func handleAPITodo(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleAPIAgenda returns pending todos grouped by due day, as shown by
+// `vault agenda`
+func handleAPIAgenda(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	days := 7
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAgendaDays {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	todos, err := GetTodos(TodoFilter{
+		Status:   "pending",
+		Category: r.URL.Query().Get("category"),
+		Context:  r.URL.Query().Get("context"),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	groups := BuildAgenda(todos, time.Now(), days)
+	if groups == nil {
+		groups = []AgendaGroup{}
+	}
+	json.NewEncoder(w).Encode(groups)
+}
+
 func handleAPICategories(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	categories, err := GetCategories()
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTML is parsed with golang.org/x/net/html, which follows the HTML5
+// parsing rules for entities, raw-text elements and malformed markup.
+// This file adapts its tokens and tree to the small htmlToken and htmlNode
+// types the metadata, redirect and readability code work with.
+
+type htmlTokenType int
+
+const (
+	textToken htmlTokenType = iota
+	startTagToken
+	endTagToken
+	commentToken
+)
+
+type htmlToken struct {
+	Type        htmlTokenType
+	Tag         string
+	Attrs       map[string]string
+	Text        string
+	SelfClosing bool
+}
+
+// rawTextTags hold content that is not parsed as markup
+var rawTextTags = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true,
+}
+
+var voidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// htmlTokenizer streams the tokens of a document
+type htmlTokenizer struct {
+	z *html.Tokenizer
+}
+
+func newHTMLTokenizer(src string) *htmlTokenizer {
+	return &htmlTokenizer{z: html.NewTokenizer(strings.NewReader(src))}
+}
+
+// Next returns the next token, or false at end of input. Doctypes are
+// skipped and a self-closing tag is a start tag with SelfClosing set.
+func (t *htmlTokenizer) Next() (htmlToken, bool) {
+	for {
+		switch tt := t.z.Next(); tt {
+		case html.ErrorToken:
+			return htmlToken{}, false
+		case html.TextToken:
+			return htmlToken{Type: textToken, Text: string(t.z.Text())}, true
+		case html.CommentToken:
+			return htmlToken{Type: commentToken, Text: string(t.z.Text())}, true
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := t.z.Token()
+			return htmlToken{Type: startTagToken, Tag: tok.Data, Attrs: attrMap(tok.Attr),
+				SelfClosing: tt == html.SelfClosingTagToken}, true
+		case html.EndTagToken:
+			name, _ := t.z.TagName()
+			return htmlToken{Type: endTagToken, Tag: string(name)}, true
+		}
+	}
+}
+
+// attrMap indexes attributes by name; the first of a repeated one wins,
+// as in browsers
+func attrMap(attrs []html.Attribute) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for _, a := range attrs {
+		if _, ok := m[a.Key]; !ok {
+			m[a.Key] = a.Val
+		}
+	}
+	return m
+}
+
+// htmlNode is an element or text node in a parsed document
+type htmlNode struct {
+	Tag      string // empty for text nodes
+	Attrs    map[string]string
+	Text     string
+	Parent   *htmlNode
+	Children []*htmlNode
+}
+
+func (n *htmlNode) IsText() bool {
+	return n.Tag == ""
+}
+
+func (n *htmlNode) Attr(name string) string {
+	if n.Attrs == nil {
+		return ""
+	}
+	return n.Attrs[name]
+}
+
+func (n *htmlNode) appendChild(c *htmlNode) {
+	c.Parent = n
+	n.Children = append(n.Children, c)
+}
+
+// remove detaches n from its parent
+func (n *htmlNode) remove() {
+	if n.Parent == nil {
+		return
+	}
+	siblings := n.Parent.Children
+	for i, c := range siblings {
+		if c == n {
+			n.Parent.Children = append(siblings[:i:i], siblings[i+1:]...)
+			break
+		}
+	}
+	n.Parent = nil
+}
+
+// Walk visits n and its descendants depth-first. Returning false from fn
+// skips the node's children.
+func (n *htmlNode) Walk(fn func(*htmlNode) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, c := range append([]*htmlNode(nil), n.Children...) {
+		c.Walk(fn)
+	}
+}
+
+// Find returns the first element with the given tag
+func (n *htmlNode) Find(tag string) *htmlNode {
+	var found *htmlNode
+	n.Walk(func(c *htmlNode) bool {
+		if found != nil {
+			return false
+		}
+		if c.Tag == tag {
+			found = c
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// FindAll returns every element with the given tag
+func (n *htmlNode) FindAll(tag string) []*htmlNode {
+	var found []*htmlNode
+	n.Walk(func(c *htmlNode) bool {
+		if c.Tag == tag {
+			found = append(found, c)
+		}
+		return true
+	})
+	return found
+}
+
+// TextContent returns the concatenated text of n with whitespace collapsed
+func (n *htmlNode) TextContent() string {
+	var sb strings.Builder
+	n.Walk(func(c *htmlNode) bool {
+		if c.Tag == "script" || c.Tag == "style" {
+			return false
+		}
+		if c.IsText() {
+			sb.WriteString(c.Text)
+			sb.WriteByte(' ')
+		}
+		return true
+	})
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// blockTags are elements laid out as their own block by renderReadableText
+var blockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"div": true, "dl": true, "fieldset": true, "figure": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "header": true, "hr": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true, "ul": true,
+}
+
+// parseHTML builds a tree from src. The returned root is a synthetic
+// "#document" element; comments and the doctype are dropped.
+func parseHTML(src string) *htmlNode {
+	root := &htmlNode{Tag: "#document"}
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		return root
+	}
+	for c := doc.FirstChild; c != nil; c = c.NextSibling {
+		appendHTMLNode(root, c)
+	}
+	return root
+}
+
+// appendHTMLNode converts n and its descendants under parent
+func appendHTMLNode(parent *htmlNode, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		parent.appendChild(&htmlNode{Text: n.Data})
+	case html.ElementNode:
+		node := &htmlNode{Tag: n.Data, Attrs: attrMap(n.Attr)}
+		parent.appendChild(node)
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			appendHTMLNode(node, c)
+		}
+	}
+}
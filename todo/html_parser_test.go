@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestExtractPageMetadata(t *testing.T) {
+	base, _ := url.Parse("https://example.com/posts/1")
+	tests := []struct {
+		name, src string
+		want      URLMetadata
+	}{
+		{
+			name: "entities",
+			src:  `<title>Tom &amp; Jerry&nbsp;&#8212; cartoons</title><meta name="description" content="Cats &lt;3 mice">`,
+			want: URLMetadata{Title: "Tom & Jerry — cartoons", Description: "Cats <3 mice"},
+		},
+		{
+			name: "markup inside script is text",
+			src:  `<script>document.write("<meta property='og:title' content='fake'>")</script><meta property="og:title" content="Real">`,
+			want: URLMetadata{Title: "Real"},
+		},
+		{
+			name: "uppercase, unquoted and self-closing",
+			src:  `<HEAD><META NAME=Description CONTENT=short><link rel="canonical" href="/a"/></HEAD>`,
+			want: URLMetadata{Description: "short", CanonicalURL: "https://example.com/a"},
+		},
+		{
+			name: "first of a repeated attribute",
+			src:  `<meta property="og:title" property="x" content="One" content="Two">`,
+			want: URLMetadata{Title: "One"},
+		},
+		{
+			name: "unterminated comment hides the rest",
+			src:  `<meta property="og:title" content="Seen"><!-- <meta name="author" content="Hidden">`,
+			want: URLMetadata{Title: "Seen"},
+		},
+	}
+	for _, tt := range tests {
+		got := extractPageMetadata(tt.src, base)
+		got.ReadingTime, got.Favicon = 0, ""
+		if *got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestParseHTML(t *testing.T) {
+	tests := []struct {
+		src, body string
+	}{
+		{`<p>one<p>two<div>three</div>`, "one two three"},
+		{`<ul><li>a<li>b</ul><table><tr><td>c<td>d</table>`, "a b c d"},
+		{`<b>bold <i>both</b> italic</i>`, "bold both italic"},
+		{`<p>x</p><script>if (a < b) { y() }</script><style>p{}</style>`, "x"},
+		{`<textarea><b>not bold</b></textarea>`, "<b>not bold</b>"},
+		{`a &lt; b &amp;&amp; c &gt; d`, "a < b && c > d"},
+	}
+	for _, tt := range tests {
+		body := parseHTML(tt.src).Find("body")
+		if body == nil {
+			t.Errorf("parseHTML(%q): no body", tt.src)
+			continue
+		}
+		if got := body.TextContent(); got != tt.body {
+			t.Errorf("parseHTML(%q) body text = %q, want %q", tt.src, got, tt.body)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// iCalendar (RFC 5545) feed of pending todos with a due date. Each todo is
+// written as a VEVENT on its due date, which every calendar shows; VTODOs
+// for task-aware clients are opt-in, since a client that reads both would
+// show every todo twice. UIDs derive from the todo ID so clients update
+// entries in place instead of duplicating them.
+
+const icsTimeLayout = "20060102T150405Z"
+
+// CalendarKinds selects the components written by BuildCalendar
+type CalendarKinds struct {
+	Todos, Events bool
+}
+
+// ParseCalendarKinds reads a ?type= or --type value: event (the default),
+// todo, or all for both
+func ParseCalendarKinds(s string) (CalendarKinds, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "event", "vevent":
+		return CalendarKinds{Events: true}, nil
+	case "todo", "vtodo":
+		return CalendarKinds{Todos: true}, nil
+	case "all", "both":
+		return CalendarKinds{Todos: true, Events: true}, nil
+	}
+	return CalendarKinds{}, fmt.Errorf("invalid calendar type %q (use event, todo or all)", s)
+}
+
+// onCalendar reports whether BuildCalendar writes t: it must be pending
+// and have a due date
+func onCalendar(t Todo) bool {
+	_, _, ok := parseDueDate(t.DueDate)
+	return !t.Done && ok
+}
+
+// Entries counts the components BuildCalendar writes for todos
+func (k CalendarKinds) Entries(todos []Todo) int {
+	perTodo := 0
+	if k.Todos {
+		perTodo++
+	}
+	if k.Events {
+		perTodo++
+	}
+	n := 0
+	for _, t := range todos {
+		if onCalendar(t) {
+			n += perTodo
+		}
+	}
+	return n
+}
+
+// BuildCalendar renders pending, dated todos as a VCALENDAR
+func BuildCalendar(todos []Todo, kinds CalendarKinds, now time.Time) []byte {
+	var b icsWriter
+	b.line("BEGIN:VCALENDAR")
+	b.line("VERSION:2.0")
+	b.line("PRODID:-//vault//todos//EN")
+	b.line("CALSCALE:GREGORIAN")
+	b.prop("X-WR-CALNAME", "Vault todos")
+
+	stamp := now.UTC().Format(icsTimeLayout)
+	for _, t := range todos {
+		if !onCalendar(t) {
+			continue
+		}
+		due, layout, _ := parseDueDate(t.DueDate)
+		allDay := layout == dueDateLayout
+
+		if kinds.Todos {
+			b.line("BEGIN:VTODO")
+			b.line(fmt.Sprintf("UID:todo-%d@vault", t.ID))
+			b.line("DTSTAMP:" + stamp)
+			writeTodoProps(&b, t)
+			if allDay {
+				b.line("DUE;VALUE=DATE:" + due.Format("20060102"))
+			} else {
+				b.line("DUE:" + due.UTC().Format(icsTimeLayout))
+			}
+			b.line("STATUS:NEEDS-ACTION")
+			b.line("END:VTODO")
+		}
+
+		if kinds.Events {
+			b.line("BEGIN:VEVENT")
+			b.line(fmt.Sprintf("UID:todo-%d-due@vault", t.ID))
+			b.line("DTSTAMP:" + stamp)
+			writeTodoProps(&b, t)
+			if allDay {
+				b.line("DTSTART;VALUE=DATE:" + due.Format("20060102"))
+				b.line("DTEND;VALUE=DATE:" + due.AddDate(0, 0, 1).Format("20060102"))
+			} else {
+				b.line("DTSTART:" + due.UTC().Format(icsTimeLayout))
+				b.line("DURATION:PT30M")
+			}
+			b.line("TRANSP:TRANSPARENT")
+			b.line("END:VEVENT")
+		}
+	}
+
+	b.line("END:VCALENDAR")
+	return b.Bytes()
+}
+
+// writeTodoProps writes the properties shared by both components
+func writeTodoProps(b *icsWriter, t Todo) {
+	b.prop("SUMMARY", t.Task)
+	var desc []string
+	if t.DuePhrase != "" {
+		desc = append(desc, "Due: "+t.DuePhrase)
+	}
+	if t.Recurrence != "" {
+		desc = append(desc, "Repeats: "+t.Recurrence)
+	}
+	if t.SubtasksTotal > 0 {
+		desc = append(desc, fmt.Sprintf("Subtasks: %d/%d done", t.SubtasksDone, t.SubtasksTotal))
+	}
+	if len(desc) > 0 {
+		b.prop("DESCRIPTION", strings.Join(desc, "\n"))
+	}
+	if t.Category != "" {
+		b.prop("CATEGORIES", t.Category)
+	}
+	switch t.Priority {
+	case PriorityHigh:
+		b.line("PRIORITY:1")
+	case PriorityLow:
+		b.line("PRIORITY:9")
+	default:
+		b.line("PRIORITY:5")
+	}
+	if !t.CreatedAt.IsZero() {
+		b.line("CREATED:" + t.CreatedAt.UTC().Format(icsTimeLayout))
+	}
+	if !t.UpdatedAt.IsZero() {
+		b.line("LAST-MODIFIED:" + t.UpdatedAt.UTC().Format(icsTimeLayout))
+	}
+}
+
+// icsWriter writes CRLF-terminated content lines folded at 75 octets
+type icsWriter struct {
+	bytes.Buffer
+}
+
+func (w *icsWriter) line(s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	w.WriteString(s + "\r\n")
+}
+
+// prop writes a TEXT property, escaped per RFC 5545 3.3.11
+func (w *icsWriter) prop(name, value string) {
+	value = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+	w.line(name + ":" + value)
+}
+
+// filterCategories keeps todos in any of the given categories; none keeps all
+func filterCategories(todos []Todo, categories []string) []Todo {
+	if len(categories) == 0 {
+		return todos
+	}
+	want := map[string]bool{}
+	for _, c := range categories {
+		want[strings.ToLower(c)] = true
+	}
+	var kept []Todo
+	for _, t := range todos {
+		if want[strings.ToLower(t.Category)] {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// handleCalendarICS serves /calendar.ics. ?category= (repeatable or comma
+// separated) limits the feed; ?type=todo writes VTODOs instead of events
+// and ?type=all writes both.
+func handleCalendarICS(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var categories []string
+	for _, v := range q["category"] {
+		for _, c := range strings.Split(v, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				categories = append(categories, c)
+			}
+		}
+	}
+	kinds, err := ParseCalendarKinds(q.Get("type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	todos, err := GetTodos(TodoFilter{Status: "pending"})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="vault.ics"`)
+	w.Write(BuildCalendar(filterCategories(todos, categories), kinds, time.Now()))
+}
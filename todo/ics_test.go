@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestICSPropEscaping(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"plain", "SUMMARY:plain\r\n"},
+		{`a\b`, `SUMMARY:a\\b` + "\r\n"},
+		{"milk; eggs, bread", `SUMMARY:milk\; eggs\, bread` + "\r\n"},
+		{"line one\nline two\r\nthree", `SUMMARY:line one\nline two\nthree` + "\r\n"},
+	}
+	for _, tt := range tests {
+		var w icsWriter
+		w.prop("SUMMARY", tt.value)
+		if got := w.String(); got != tt.want {
+			t.Errorf("prop(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestICSLineFolding(t *testing.T) {
+	tests := []struct {
+		name, line string
+	}{
+		{"short", "SUMMARY:short"},
+		{"exactly 75", "SUMMARY:" + strings.Repeat("x", 67)},
+		{"ascii", "SUMMARY:" + strings.Repeat("abcdefghij", 20)},
+		{"multibyte", "SUMMARY:" + strings.Repeat("日本語のタスク", 12)},
+	}
+	for _, tt := range tests {
+		var w icsWriter
+		w.line(tt.line)
+		out := w.String()
+		if !strings.HasSuffix(out, "\r\n") {
+			t.Errorf("%s: not CRLF terminated: %q", tt.name, out)
+		}
+		physical := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+		for i, p := range physical {
+			if len(p) > 75 {
+				t.Errorf("%s: line %d is %d octets: %q", tt.name, i, len(p), p)
+			}
+			if i > 0 && !strings.HasPrefix(p, " ") {
+				t.Errorf("%s: continuation %d doesn't start with a space: %q", tt.name, i, p)
+			}
+		}
+		// Unfolding restores the line, with no rune split across lines
+		if got := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", ""); got != tt.line {
+			t.Errorf("%s: unfolded to %q", tt.name, got)
+		}
+	}
+}
+
+func TestBuildCalendarKinds(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	todos := []Todo{
+		{ID: 1, Task: "pay rent", DueDate: "2026-11-01", Priority: PriorityHigh},
+		{ID: 2, Task: "standup", DueDate: "2026-10-19T09:30", Priority: PriorityMedium},
+		{ID: 3, Task: "undated", Priority: PriorityMedium},
+		{ID: 4, Task: "finished", DueDate: "2026-10-10", Done: true},
+	}
+	tests := []struct {
+		kind           string
+		events, vtodos int
+	}{
+		{"", 2, 0}, // events by default
+		{"event", 2, 0},
+		{"todo", 0, 2},
+		{"all", 2, 2},
+	}
+	for _, tt := range tests {
+		kinds, err := ParseCalendarKinds(tt.kind)
+		if err != nil {
+			t.Fatalf("ParseCalendarKinds(%q): %v", tt.kind, err)
+		}
+		cal := string(BuildCalendar(todos, kinds, now))
+		if got := strings.Count(cal, "BEGIN:VEVENT"); got != tt.events {
+			t.Errorf("type %q: %d VEVENTs, want %d", tt.kind, got, tt.events)
+		}
+		if got := strings.Count(cal, "BEGIN:VTODO"); got != tt.vtodos {
+			t.Errorf("type %q: %d VTODOs, want %d", tt.kind, got, tt.vtodos)
+		}
+		if got := kinds.Entries(todos); got != tt.events+tt.vtodos {
+			t.Errorf("type %q: Entries = %d, want %d", tt.kind, got, tt.events+tt.vtodos)
+		}
+	}
+	if _, err := ParseCalendarKinds("journal"); err == nil {
+		t.Error("ParseCalendarKinds accepted an unknown type")
+	}
+
+	cal := string(BuildCalendar(todos, CalendarKinds{Events: true}, now))
+	for _, want := range []string{
+		"UID:todo-1-due@vault\r\n",
+		"DTSTART;VALUE=DATE:20261101\r\nDTEND;VALUE=DATE:20261102\r\n",
+		"DTSTART:" + time.Date(2026, 10, 19, 9, 30, 0, 0, time.Local).UTC().Format(icsTimeLayout) + "\r\n",
+		"PRIORITY:1\r\n",
+	} {
+		if !strings.Contains(cal, want) {
+			t.Errorf("calendar is missing %q:\n%s", want, cal)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Todo import. Two JSON shapes are accepted: the pre-SQLite todos.json
+// ([{"id","task","done"}]) and this tool's own export (`vault todo export`,
+// GET /api/todos). Every imported todo stores a source id so importing the
+// same file again skips what is already there.
+
+// importRecord covers both formats; legacy records only fill ID, Task and Done
+type importRecord struct {
+	ID          int64   `json:"id"`
+	Task        string  `json:"task"`
+	Done        bool    `json:"done"`
+	Priority    string  `json:"priority"`
+	Category    string  `json:"category"`
+	DueDate     string  `json:"due_date"`
+	DuePhrase   string  `json:"due_phrase"`
+	Recurrence  string  `json:"recurrence"`
+	ParentID    int64   `json:"parent_id"`
+	BlockedBy   []int64 `json:"blocked_by"`
+	SourceID    string  `json:"source_id"`
+	Context     string  `json:"context"`
+	CreatedAt   string  `json:"created_at"`
+	CompletedAt string  `json:"completed_at"`
+}
+
+// ImportSummary reports what an import did
+type ImportSummary struct {
+	Format   string // "legacy todos.json" or "vault export"
+	Imported int
+	Done     int // imported todos that were already done
+	Skipped  int // already imported
+	Warnings []string
+}
+
+// sourceID identifies a record across imports. Legacy ids are only unique
+// within their file, so the task text is part of the key.
+func (r importRecord) sourceID() string {
+	if r.SourceID != "" {
+		return r.SourceID
+	}
+	if r.CreatedAt != "" {
+		return fmt.Sprintf("vault:%d:%s", r.ID, r.CreatedAt)
+	}
+	sum := sha256.Sum256([]byte(r.Task))
+	return fmt.Sprintf("legacy:%d:%s", r.ID, hex.EncodeToString(sum[:4]))
+}
+
+// ImportTodosJSON imports todos from either JSON format. Subtask links and
+// dependencies in an export are restored between the imported todos.
+func ImportTodosJSON(data []byte) (*ImportSummary, error) {
+	var records []importRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("not a todo JSON array: %w", err)
+	}
+
+	summary := &ImportSummary{Format: "legacy todos.json"}
+	for _, r := range records {
+		if r.CreatedAt != "" {
+			summary.Format = "vault export"
+			break
+		}
+	}
+
+	// Old id -> id in this database, for parents and dependencies
+	ids := map[int64]int64{}
+	var created []importRecord
+	for i, r := range records {
+		label := fmt.Sprintf("record %d", i+1)
+		if r.ID != 0 {
+			label = "#" + strconv.FormatInt(r.ID, 10)
+		}
+		if strings.TrimSpace(r.Task) == "" {
+			summary.Warnings = append(summary.Warnings, label+": no task, skipped")
+			continue
+		}
+
+		if existing, err := findImported(r); err != nil {
+			return summary, err
+		} else if existing != 0 {
+			ids[r.ID] = existing
+			summary.Skipped++
+			continue
+		}
+
+		todo := &Todo{
+			Task:     r.Task,
+			Done:     r.Done,
+			Category: r.Category,
+			Context:  r.Context,
+			SourceID: r.sourceID(),
+		}
+		switch Priority(r.Priority) {
+		case PriorityLow, PriorityMedium, PriorityHigh:
+			todo.Priority = Priority(r.Priority)
+		case "":
+		default:
+			summary.Warnings = append(summary.Warnings, fmt.Sprintf("%s: unknown priority %q, using medium", label, r.Priority))
+		}
+		if at, err := time.Parse(time.RFC3339, r.CreatedAt); err == nil {
+			todo.CreatedAt = at
+		}
+		if at, err := time.Parse(time.RFC3339, r.CompletedAt); err == nil {
+			todo.CompletedAt = at
+		}
+		if r.DueDate != "" {
+			due, phrase, err := ResolveDueDate(r.DueDate, time.Now())
+			if err != nil {
+				// Keep what was written, like the due date migration does
+				due, phrase = "", r.DueDate
+				summary.Warnings = append(summary.Warnings, fmt.Sprintf("%s: unreadable due date %q kept as a note", label, r.DueDate))
+			}
+			todo.DueDate = due
+			todo.DuePhrase = phrase
+			if r.DuePhrase != "" {
+				todo.DuePhrase = r.DuePhrase
+			}
+		}
+		if r.Recurrence != "" {
+			rule, err := NormalizeRecurrence(r.Recurrence)
+			if err != nil {
+				summary.Warnings = append(summary.Warnings, fmt.Sprintf("%s: %v, imported without it", label, err))
+			}
+			todo.Recurrence = rule
+		}
+
+		if _, err := CreateTodo(todo); err != nil {
+			return summary, fmt.Errorf("%s: %w", label, err)
+		}
+		ids[r.ID] = todo.ID
+		created = append(created, r)
+		summary.Imported++
+		if todo.Done {
+			summary.Done++
+		}
+	}
+
+	for _, r := range created {
+		id := ids[r.ID]
+		if r.ParentID != 0 {
+			parent, ok := ids[r.ParentID]
+			if !ok {
+				summary.Warnings = append(summary.Warnings, fmt.Sprintf("#%d: parent #%d not in the file, imported at the top level", r.ID, r.ParentID))
+			} else if err := setTodoParent(id, parent); err != nil {
+				summary.Warnings = append(summary.Warnings, fmt.Sprintf("#%d: %v", r.ID, err))
+			}
+		}
+		for _, on := range r.BlockedBy {
+			if prereq, ok := ids[on]; ok {
+				if err := AddDependency(id, prereq); err != nil {
+					summary.Warnings = append(summary.Warnings, fmt.Sprintf("#%d: dependency on #%d: %v", r.ID, on, err))
+				}
+			}
+		}
+	}
+	return summary, nil
+}
+
+// findImported returns the id of a todo this record was already imported
+// as, or that it was exported from when an export comes back to the same
+// database; 0 if there is none
+func findImported(r importRecord) (int64, error) {
+	var id int64
+	err := db.QueryRow(`SELECT id FROM todos WHERE source_id = ?`, r.sourceID()).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	if r.CreatedAt == "" || r.ID == 0 {
+		return 0, nil
+	}
+	at, err := time.Parse(time.RFC3339, r.CreatedAt)
+	if err != nil {
+		return 0, nil
+	}
+	if t, err := GetTodo(r.ID); err == nil && t.Task == r.Task && t.CreatedAt.Equal(at.Truncate(time.Second)) {
+		return t.ID, nil
+	}
+	return 0, nil
+}
+
+// setTodoParent moves a todo under another one
+func setTodoParent(id, parentID int64) error {
+	if err := checkParent(db, id, parentID); err != nil {
+		return err
+	}
+	_, err := db.Exec(`UPDATE todos SET parent_id = ? WHERE id = ?`, nullableID(parentID), id)
+	return err
+}
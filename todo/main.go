@@ -1,160 +1,115 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func main() {
-	if err := InitDB(); err != nil {
-		fmt.Println("Error initializing database:", err)
+	args, err := parseGlobalFlags(os.Args[1:])
+	if err != nil {
+		fmt.Println("Error:", err)
 		os.Exit(1)
 	}
-	defer CloseDB()
+	runCLI(args, InitDB)
+}
 
-	if len(os.Args) < 2 {
-		printVaultUsage()
-		return
+// Todo CLI handlers
+func handleAdd(a *cmdArgs) {
+	task := a.Text()
+	priority := PriorityMedium
+	if a.Has("-p") {
+		priority = Priority(a.Value("-p"))
+	}
+	category := a.Value("-c")
+	var parentID int64
+	if a.Has("--under") {
+		id, err := strconv.ParseInt(a.Value("--under"), 10, 64)
+		if err != nil {
+			fmt.Println("Invalid parent ID")
+			return
+		}
+		parentID = id
 	}
 
-	cmd := os.Args[1]
-
-	// Vault commands
-	switch cmd {
-	case "save":
-		handleVaultSave()
-		return
-	case "note":
-		handleVaultNote()
-		return
-	case "random", "resurface":
-		handleVaultRandom()
-		return
-	case "pin":
-		handleVaultPin(true)
-		return
-	case "unpin":
-		handleVaultPin(false)
-		return
-	case "archive":
-		handleVaultArchive(true)
-		return
-	case "unarchive":
-		handleVaultArchive(false)
-		return
-	case "tags":
-		handleVaultTags()
-		return
-	case "tag":
-		handleVaultSetTags()
-		return
-	case "items":
-		handleVaultList()
+	if task == "" {
+		a.Usage()
 		return
 	}
 
-	// Todo commands (backwards compatible)
-	switch cmd {
-	case "add":
-		handleAdd()
-	case "list", "ls":
-		handleList()
-	case "done":
-		handleDone()
-	case "undone":
-		handleUndone()
-	case "rm", "remove":
-		handleRemove()
-	case "clear":
-		handleClear()
-	case "server":
-		startServer()
-	default:
-		printVaultUsage()
+	recurrence, err := NormalizeRecurrence(a.Value("-r"))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
 	}
-}
 
-// Todo CLI handlers
-func handleAdd() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: vault add <task> [-p priority] [-c category] [-d due-date]")
+	due, phrase, err := ResolveDueDate(a.Value("-d"), time.Now())
+	if err != nil {
+		fmt.Println("Error:", err)
 		return
 	}
 
-	args := os.Args[2:]
-	task := ""
-	priority := PriorityMedium
-	category := ""
-	dueDate := ""
-
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "-p":
-			if i+1 < len(args) {
-				priority = Priority(args[i+1])
-				i++
-			}
-		case "-c":
-			if i+1 < len(args) {
-				category = args[i+1]
-				i++
-			}
-		case "-d":
-			if i+1 < len(args) {
-				dueDate = args[i+1]
-				i++
-			}
-		default:
-			if task == "" {
-				task = args[i]
-			} else {
-				task += " " + args[i]
-			}
+	// Subtasks share their parent's category unless given one; CreateTodo
+	// gives them its context so they are listed together
+	var parent *Todo
+	context := ""
+	if parentID != 0 {
+		parent, err = GetTodo(parentID)
+		if err != nil {
+			fmt.Println("Parent todo not found")
+			return
 		}
+		if category == "" {
+			category = parent.Category
+		}
+	} else {
+		context = todoContext(a)
 	}
 
-	if task == "" {
-		fmt.Println("Please provide a task")
-		return
-	}
-
-	todo, err := CreateTodo(task, priority, category, dueDate)
+	todo, err := CreateTodo(&Todo{
+		Task:       task,
+		Priority:   priority,
+		Category:   category,
+		DueDate:    due,
+		DuePhrase:  phrase,
+		Recurrence: recurrence,
+		ParentID:   parentID,
+		Context:    context,
+	})
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
 	}
 	fmt.Printf("Added: [%d] %s\n", todo.ID, todo.Task)
+	if parent != nil {
+		fmt.Printf("  Under: [%d] %s\n", parent.ID, parent.Task)
+	}
 	if category != "" {
 		fmt.Printf("  Category: %s\n", category)
 	}
-	if dueDate != "" {
-		fmt.Printf("  Due: %s\n", dueDate)
+	if todo.DueDate != "" {
+		fmt.Printf("  Due: %s\n", FormatDue(todo.DueDate))
+	}
+	if recurrence != "" {
+		fmt.Printf("  Repeats: %s\n", recurrence)
+	}
+	if todo.Context != "" {
+		fmt.Printf("  Context: %s\n", todo.Context)
 	}
 }
 
-func handleList() {
-	filter := TodoFilter{}
-
-	for i := 2; i < len(os.Args); i++ {
-		switch os.Args[i] {
-		case "-s":
-			if i+1 < len(os.Args) {
-				filter.Status = os.Args[i+1]
-				i++
-			}
-		case "-p":
-			if i+1 < len(os.Args) {
-				filter.Priority = os.Args[i+1]
-				i++
-			}
-		case "-c":
-			if i+1 < len(os.Args) {
-				filter.Category = os.Args[i+1]
-				i++
-			}
-		}
+func handleList(a *cmdArgs) {
+	filter := TodoFilter{
+		Status:   a.Value("-s"),
+		Priority: a.Value("-p"),
+		Category: a.Value("-c"),
+		Due:      a.Value("--due"),
+		Context:  todoContext(a),
 	}
 
 	todos, err := GetTodos(filter)
@@ -164,81 +119,402 @@ func handleList() {
 	}
 
 	if len(todos) == 0 {
-		fmt.Println("No todos yet. Add one with: vault add <task>")
+		if filter.Context != "" {
+			fmt.Printf("No todos in %s yet. Add one with: vault todo add <task>\n", filter.Context)
+			fmt.Println("  (--all shows every context)")
+			return
+		}
+		fmt.Println("No todos yet. Add one with: vault todo add <task>")
 		return
 	}
 
 	fmt.Println()
-	for _, t := range todos {
-		status := " "
-		if t.Done {
-			status = "x"
+	for _, row := range todoTree(todos) {
+		fmt.Printf("  %s\n", todoLine(row))
+	}
+	fmt.Println()
+	if filter.Context != "" {
+		fmt.Printf("  %s\n\n", contextNote(filter.Context))
+	}
+}
+
+// todoLine renders one row of the todo tree, e.g. "├─ [ ]! 3. task [work]"
+func todoLine(row todoTreeRow) string {
+	t := row.Todo
+	status := " "
+	if t.Done {
+		status = "x"
+	}
+	priorityIcon := ""
+	switch t.Priority {
+	case PriorityHigh:
+		priorityIcon = "!"
+	case PriorityLow:
+		priorityIcon = "-"
+	}
+	extra := ""
+	if t.Category != "" {
+		extra += fmt.Sprintf(" [%s]", t.Category)
+	}
+	if t.DueDate != "" {
+		extra += fmt.Sprintf(" (due: %s)", FormatDue(t.DueDate))
+	} else if t.DuePhrase != "" {
+		extra += fmt.Sprintf(" (due: %q?)", t.DuePhrase)
+	}
+	if t.Recurrence != "" {
+		extra += fmt.Sprintf(" ↻ %s", t.Recurrence)
+	}
+	if t.SubtasksTotal > 0 {
+		extra += fmt.Sprintf(" (%d/%d done)", t.SubtasksDone, t.SubtasksTotal)
+	}
+	if t.Blocked {
+		extra += fmt.Sprintf(" ⛔ blocked by %s", formatIDs(t.BlockedBy))
+	}
+	return fmt.Sprintf("%s[%s]%s %d. %s%s", row.Prefix, status, priorityIcon, t.ID, t.Task, extra)
+}
+
+func handleAgenda(a *cmdArgs) {
+	days := 7
+	filter := TodoFilter{Status: "pending", Category: a.Value("-c"), Context: todoContext(a)}
+	if a.Has("--days") {
+		n, err := strconv.Atoi(a.Value("--days"))
+		if err != nil || n < 1 || n > maxAgendaDays {
+			fmt.Printf("Invalid --days value: use 1 to %d\n", maxAgendaDays)
+			return
 		}
-		priorityIcon := ""
-		switch t.Priority {
-		case PriorityHigh:
-			priorityIcon = "!"
-		case PriorityLow:
-			priorityIcon = "-"
+		days = n
+	}
+
+	todos, err := GetTodos(filter)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	groups := BuildAgenda(todos, time.Now(), days)
+	if len(groups) == 0 {
+		fmt.Println("Nothing pending. Add a todo with: vault todo add <task> -d tomorrow")
+		return
+	}
+
+	for _, g := range groups {
+		fmt.Println()
+		heading := g.Label
+		if g.Label == "Today" || g.Label == "Tomorrow" {
+			heading += " - " + FormatDue(g.Date)
 		}
-		extra := ""
-		if t.Category != "" {
-			extra += fmt.Sprintf(" [%s]", t.Category)
+		if g.Overdue {
+			fmt.Printf("\033[1;31m%s\033[0m\n", heading)
+		} else {
+			fmt.Printf("\033[1m%s\033[0m\n", heading)
 		}
-		if t.DueDate != "" {
-			extra += fmt.Sprintf(" (due: %s)", t.DueDate)
+
+		for _, t := range g.Todos {
+			priorityIcon := " "
+			switch t.Priority {
+			case PriorityHigh:
+				priorityIcon = "!"
+			case PriorityLow:
+				priorityIcon = "-"
+			}
+			// Day groups already name the day, so only a time is worth showing
+			when := ""
+			if due, layout, ok := parseDueDate(t.DueDate); ok {
+				if g.Date == "" {
+					when = "  " + FormatDue(t.DueDate)
+				} else if layout != dueDateLayout {
+					when = "  " + due.Format("15:04")
+				}
+			}
+			extra := ""
+			if t.Category != "" {
+				extra += fmt.Sprintf(" [%s]", t.Category)
+			}
+			if t.Recurrence != "" {
+				extra += " ↻"
+			}
+			line := fmt.Sprintf("  %s %d. %s%s%s", priorityIcon, t.ID, t.Task, when, extra)
+			if g.Overdue {
+				line = "\033[31m" + line + "\033[0m"
+			}
+			fmt.Println(line)
 		}
-		fmt.Printf("  [%s]%s %d. %s%s\n", status, priorityIcon, t.ID, t.Task, extra)
 	}
 	fmt.Println()
+	if filter.Context != "" {
+		fmt.Printf("%s\n\n", contextNote(filter.Context))
+	}
 }
 
-func handleDone() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: vault done <id>")
+func handleDone(a *cmdArgs) {
+	id, ok := a.ID()
+	if !ok {
 		return
 	}
-	id, err := strconv.ParseInt(os.Args[2], 10, 64)
+	todo, err := GetTodo(id)
 	if err != nil {
-		fmt.Println("Invalid ID")
+		fmt.Println("Todo not found")
 		return
 	}
-	todo, err := GetTodo(id)
+	next, err := MarkTodoDone(id, true, a.Has("--force"))
 	if err != nil {
-		fmt.Println("Todo not found")
+		fmt.Println("Error:", err)
+		if _, blocked := err.(*BlockedError); blocked {
+			fmt.Println("  Use --force to complete it anyway")
+		}
 		return
 	}
-	MarkTodoDone(id, true)
 	fmt.Printf("Done: [%d] %s\n", id, todo.Task)
+	if next != nil {
+		fmt.Printf("Next: [%d] due %s (%s)\n", next.ID, FormatDue(next.DueDate), next.Recurrence)
+	}
+	for _, waiting := range todo.Blocks {
+		if t, err := GetTodo(waiting); err == nil && !t.Blocked {
+			fmt.Printf("Unblocked: [%d] %s\n", t.ID, t.Task)
+		}
+	}
 }
 
-func handleUndone() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: vault undone <id>")
+func handleUndone(a *cmdArgs) {
+	id, ok := a.ID()
+	if !ok {
 		return
 	}
-	id, err := strconv.ParseInt(os.Args[2], 10, 64)
+	todo, err := GetTodo(id)
 	if err != nil {
-		fmt.Println("Invalid ID")
+		fmt.Println("Todo not found")
+		return
+	}
+	if _, err := MarkTodoDone(id, false, false); err != nil {
+		fmt.Println("Error:", err)
 		return
 	}
+	fmt.Printf("Undone: [%d] %s\n", id, todo.Task)
+}
+
+func handleBlock(a *cmdArgs) {
+	id, ok := a.ID()
+	if !ok {
+		return
+	}
+	if a.Value("--on") == "" {
+		a.Usage()
+		return
+	}
+	for _, field := range strings.Split(a.Value("--on"), ",") {
+		on, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+		if err != nil {
+			fmt.Println("Invalid ID:", field)
+			return
+		}
+		if err := AddDependency(id, on); err != nil {
+			fmt.Printf("Error: %d on %d: %v\n", id, on, err)
+			return
+		}
+	}
 	todo, err := GetTodo(id)
 	if err != nil {
-		fmt.Println("Todo not found")
+		fmt.Println("Error:", err)
 		return
 	}
-	MarkTodoDone(id, false)
-	fmt.Printf("Undone: [%d] %s\n", id, todo.Task)
+	if todo.Blocked {
+		fmt.Printf("Blocked: [%d] %s\n  Waiting on: %s\n", todo.ID, todo.Task, formatIDs(todo.BlockedBy))
+	} else {
+		fmt.Printf("Recorded: [%d] %s (its prerequisites are already done)\n", todo.ID, todo.Task)
+	}
+}
+
+func handleUnblock(a *cmdArgs) {
+	id, ok := a.ID()
+	if !ok {
+		return
+	}
+	var on int64
+	if a.Has("--on") {
+		var err error
+		on, err = strconv.ParseInt(a.Value("--on"), 10, 64)
+		if err != nil {
+			fmt.Println("Invalid ID")
+			return
+		}
+	}
+	n, err := RemoveDependency(id, on)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if n == 0 {
+		fmt.Println("No matching dependency")
+		return
+	}
+	fmt.Printf("Unblocked: [%d] (%d dependency(s) removed)\n", id, n)
+}
+
+// handleNext suggests the single most useful todo to work on now
+func handleNext(a *cmdArgs) {
+	filter := TodoFilter{Status: "pending", Category: a.Value("-c"), Context: todoContext(a)}
+
+	todos, err := GetTodos(filter)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	next := NextActionable(todos, time.Now())
+	if next == nil {
+		if len(todos) == 0 {
+			fmt.Println("Nothing pending. Add one with: vault todo add <task>")
+		} else {
+			fmt.Println("Everything pending is blocked. See: vault todo list")
+		}
+		return
+	}
+
+	fmt.Printf("[%d] %s\n", next.ID, next.Task)
+	if next.Priority != PriorityMedium {
+		fmt.Printf("  Priority: %s\n", next.Priority)
+	}
+	if next.Category != "" {
+		fmt.Printf("  Category: %s\n", next.Category)
+	}
+	if next.DueDate != "" {
+		fmt.Printf("  Due: %s\n", FormatDue(next.DueDate))
+	}
+	if len(next.Blocks) > 0 {
+		fmt.Printf("  Unblocks: %s\n", formatIDs(next.Blocks))
+	}
 }
 
-func handleRemove() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: vault rm <id>")
+func handleImport(a *cmdArgs) {
+	file, format := a.Arg(0), a.Value("--format")
+	if file == "" {
+		a.Usage()
 		return
 	}
-	id, err := strconv.ParseInt(os.Args[2], 10, 64)
+	if format == "" {
+		format = "json"
+		if strings.HasSuffix(strings.ToLower(file), ".txt") {
+			format = "todotxt"
+		}
+	}
+
+	data, err := readInputFile(file)
 	if err != nil {
-		fmt.Println("Invalid ID")
+		fmt.Println("Error:", err)
+		return
+	}
+	var summary *ImportSummary
+	switch format {
+	case "json":
+		summary, err = ImportTodosJSON(data)
+	case "todotxt":
+		summary, err = ImportTodoTxt(data)
+	default:
+		fmt.Printf("Unknown format %q (use json or todotxt)\n", format)
+		return
+	}
+	if summary != nil {
+		for _, w := range summary.Warnings {
+			fmt.Println("Warning:", w)
+		}
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Imported %d todos from %s (%s)\n", summary.Imported, file, summary.Format)
+	if summary.Done > 0 {
+		fmt.Printf("  Already done: %d\n", summary.Done)
+	}
+	if summary.Skipped > 0 {
+		fmt.Printf("  Skipped %d already imported\n", summary.Skipped)
+	}
+}
+
+// handleExport writes every todo as JSON (the format `vault todo import` reads)
+// or todo.txt, or the pending dated ones as an iCalendar file of events
+// (--type todo or all for VTODOs)
+func handleExport(a *cmdArgs) {
+	output, format := a.Value("-o"), a.Value("--format")
+	if format == "" {
+		format = "json"
+	}
+	kinds, err := ParseCalendarKinds(a.Value("--type"))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	filter := TodoFilter{Category: a.Value("-c")}
+
+	todos, err := GetTodos(filter)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	var data []byte
+	count, noun := len(todos), "todos"
+	switch format {
+	case "json":
+		if todos == nil {
+			todos = []Todo{}
+		}
+		data, err = json.MarshalIndent(todos, "", "  ")
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		data = append(data, '\n')
+	case "todotxt":
+		data = ExportTodoTxt(todos)
+	case "ics":
+		data = BuildCalendar(todos, kinds, time.Now())
+		count, noun = kinds.Entries(todos), "calendar entries"
+	default:
+		fmt.Printf("Unknown format %q (use json, todotxt or ics)\n", format)
+		return
+	}
+
+	if output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Exported %d %s to %s\n", count, noun, output)
+}
+
+// handleSync reconciles the vault with an external todo list
+func handleSync(a *cmdArgs) {
+	file := a.Arg(1)
+	if a.Arg(0) != "todotxt" || file == "" {
+		a.Usage()
+		return
+	}
+	summary, err := SyncTodoTxt(file)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	for _, c := range summary.Conflicts {
+		fmt.Println("Conflict:", c)
+	}
+	fmt.Printf("Synced %s\n", file)
+	fmt.Printf("  Vault: %d added, %d updated, %d deleted\n", summary.Added, summary.Updated, summary.Deleted)
+	fmt.Printf("  File:  %d added, %d updated, %d removed\n", summary.LinesAdded, summary.LinesUpdated, summary.LinesRemoved)
+}
+
+// readInputFile reads a file, or stdin for "-"
+func readInputFile(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func handleRemove(a *cmdArgs) {
+	id, ok := a.ID()
+	if !ok {
 		return
 	}
 	todo, err := GetTodo(id)
@@ -248,12 +524,12 @@ func handleRemove() {
 	}
 	DeleteTodo(id)
 	fmt.Printf("Removed: [%d] %s\n", id, todo.Task)
+	if todo.SubtasksTotal > 0 {
+		fmt.Printf("  and %d subtask(s)\n", todo.SubtasksTotal)
+	}
 }
 
-func handleClear() {
+func handleClear(*cmdArgs) {
 	ClearTodos()
 	fmt.Println("All todos cleared")
 }
-
-// Ignore unused import warning for strings
-var _ = strings.TrimSpace
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Thumbnail cache: remote thumbnails are downloaded at save time, shrunk,
+// and stored content-addressed next to the database so the web UI never
+// depends on CDNs that expire or block hot-linking.
+
+const (
+	maxThumbDownload = 10 * 1024 * 1024
+	maxThumbRaw      = 2 * 1024 * 1024 // undecodable formats are kept as-is up to this size
+	maxThumbPixels   = 24 << 20        // larger sources are refused before decoding
+	maxThumbWidth    = 640
+	maxThumbHeight   = 640
+	thumbQuality     = 82
+)
+
+var mediaHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// errImageTooLarge is returned for images whose dimensions exceed
+// maxThumbPixels: a small file can claim enough pixels to exhaust memory
+// when decoded
+var errImageTooLarge = errors.New("image dimensions too large")
+
+// backgroundColor matches the card background in static/style.css
+var backgroundColor = color.RGBA{0x16, 0x21, 0x3e, 0xff}
+
+// mediaDir is the cache directory for the open database, e.g. ~/.todo.media
+func mediaDir() string {
+	return strings.TrimSuffix(dbPath, filepath.Ext(dbPath)) + ".media"
+}
+
+// mediaPath returns where a cached file with the given hash lives
+func mediaPath(hash string) string {
+	return filepath.Join(mediaDir(), hash[:2], hash)
+}
+
+// CacheThumbnail downloads a remote image, resizes it and stores it in the
+// media cache. It returns the content hash used to serve it from /media/.
+func CacheThumbnail(remoteURL string) (string, error) {
+	if !strings.HasPrefix(remoteURL, "http://") && !strings.HasPrefix(remoteURL, "https://") {
+		return "", fmt.Errorf("unsupported thumbnail URL %q", remoteURL)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", remoteURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Vault/1.0)")
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("fetching thumbnail: %s", resp.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxThumbDownload+1))
+	if err != nil {
+		return "", err
+	}
+	if len(raw) > maxThumbDownload {
+		return "", fmt.Errorf("thumbnail larger than %d bytes", maxThumbDownload)
+	}
+
+	data, err := shrinkImage(raw)
+	if err != nil {
+		// Formats the standard library can't decode (e.g. WebP) are kept
+		// verbatim as long as they are images and reasonably small
+		if errors.Is(err, errImageTooLarge) || !strings.HasPrefix(http.DetectContentType(raw), "image/") || len(raw) > maxThumbRaw {
+			return "", err
+		}
+		data = raw
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	path := mediaPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return hash, nil
+}
+
+// cacheItemThumbnail fills item.ThumbHash from its remote thumbnail,
+// leaving it empty if the download fails
+func cacheItemThumbnail(item *VaultItem) {
+	if item.MetaThumbnail == "" {
+		return
+	}
+	if hash, err := CacheThumbnail(item.MetaThumbnail); err == nil {
+		item.ThumbHash = hash
+	}
+}
+
+// shrinkImage decodes an image, scales it to fit the thumbnail bounds and
+// re-encodes it as JPEG. The header is checked before decoding so oversized
+// images are refused without allocating their pixels.
+func shrinkImage(raw []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxThumbPixels {
+		return nil, fmt.Errorf("%w: %dx%d", errImageTooLarge, cfg.Width, cfg.Height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return nil, fmt.Errorf("empty image")
+	}
+
+	scale := 1.0
+	if w > maxThumbWidth {
+		scale = float64(maxThumbWidth) / float64(w)
+	}
+	if float64(h)*scale > maxThumbHeight {
+		scale = float64(maxThumbHeight) / float64(h)
+	}
+
+	dst := src
+	if scale < 1 {
+		dst = scaleDown(src, int(float64(w)*scale+0.5), int(float64(h)*scale+0.5))
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flatten(dst), &jpeg.Options{Quality: thumbQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleDown resizes src to w x h by averaging the source pixels that fall
+// into each destination pixel. The source is converted to RGBA once (draw
+// has fast paths for the decoders' image types) and then read directly.
+func scaleDown(src image.Image, w, h int) *image.RGBA {
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	b := src.Bounds()
+	rgba, ok := src.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(b)
+		draw.Draw(rgba, b, src, b.Min, draw.Src)
+	}
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0 := y * sh / h
+		y1 := max((y+1)*sh/h, y0+1)
+		for x := 0; x < w; x++ {
+			x0 := x * sw / w
+			x1 := max((x+1)*sw/w, x0+1)
+
+			var sum [4]uint64
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[rgba.PixOffset(b.Min.X+x0, b.Min.Y+sy):]
+				for i := 0; i < (x1-x0)*4; i += 4 {
+					sum[0] += uint64(row[i])
+					sum[1] += uint64(row[i+1])
+					sum[2] += uint64(row[i+2])
+					sum[3] += uint64(row[i+3])
+				}
+			}
+			n := uint64((x1 - x0) * (y1 - y0))
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// flatten composites transparent images onto the UI background colour,
+// since JPEG has no alpha channel
+func flatten(src image.Image) image.Image {
+	b := src.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+	draw.Draw(dst, b, src, b.Min, draw.Over)
+	return dst
+}
+
+// handleMedia serves cached thumbnails. Files are content-addressed, so
+// they never change and can be cached forever.
+func handleMedia(w http.ResponseWriter, r *http.Request) {
+	hash := strings.TrimPrefix(r.URL.Path, "/media/")
+	if !mediaHashPattern.MatchString(hash) {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(mediaPath(hash))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	f.Seek(0, io.SeekStart)
+
+	stat, _ := f.Stat()
+	w.Header().Set("Content-Type", http.DetectContentType(head[:n]))
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+hash+`"`)
+	http.ServeContent(w, r, "", stat.ModTime(), f)
+}
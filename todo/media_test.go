@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// pngHeader returns a PNG that is only a signature and an IHDR chunk
+// claiming w x h pixels
+func pngHeader(w, h uint32) []byte {
+	var ihdr [13]byte
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	ihdr[8], ihdr[9] = 8, 2 // 8-bit RGB
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr[:]...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestShrinkImageRefusesHugeDimensions(t *testing.T) {
+	_, err := shrinkImage(pngHeader(100000, 100000))
+	if !errors.Is(err, errImageTooLarge) {
+		t.Fatalf("shrinkImage(100000x100000 header) error = %v, want errImageTooLarge", err)
+	}
+}
+
+func TestShrinkImageScalesDown(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 1280, 320))
+	for y := 0; y < 320; y++ {
+		for x := 0; x < 1280; x++ {
+			c := color.NRGBA{200, 40, 40, 255}
+			if x >= 640 {
+				c = color.NRGBA{40, 40, 200, 255}
+			}
+			src.SetNRGBA(x, y, c)
+		}
+	}
+	var raw bytes.Buffer
+	if err := png.Encode(&raw, src); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := shrinkImage(raw.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != maxThumbWidth || b.Dy() != 160 {
+		t.Fatalf("thumbnail is %dx%d, want %dx160", b.Dx(), b.Dy(), maxThumbWidth)
+	}
+	// JPEG is lossy, so only check each half kept its dominant channel
+	left := color.RGBAModel.Convert(img.At(100, 80)).(color.RGBA)
+	right := color.RGBAModel.Convert(img.At(540, 80)).(color.RGBA)
+	if left.R < 150 || left.B > 90 || right.B < 150 || right.R > 90 {
+		t.Errorf("colours not kept: left %v, right %v", left, right)
+	}
+}
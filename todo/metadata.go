@@ -1,196 +1,297 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
-	"net/http"
+	"math"
 	"net/url"
-	"regexp"
 	"strings"
 	"time"
+
+	"golang.org/x/net/html/charset"
 )
 
 type URLMetadata struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Thumbnail   string `json:"thumbnail"`
-	Author      string `json:"author"`
-	SiteName    string `json:"site_name"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Thumbnail    string `json:"thumbnail"`
+	Author       string `json:"author"`
+	SiteName     string `json:"site_name"`
+	PublishedAt  string `json:"published_at"` // RFC 3339 when parseable
+	CanonicalURL string `json:"canonical_url"`
+	Favicon      string `json:"favicon"`
+	ReadingTime  int    `json:"reading_time"` // minutes
 }
 
-// FetchMetadata fetches metadata for a URL based on content type
-func FetchMetadata(urlStr string, contentType ContentType) *URLMetadata {
+// wordsPerMinute is the reading speed used for reading-time estimates
+const wordsPerMinute = 230
+
+// FetchMetadata fetches metadata for a URL using the provider registered
+// for its content type. An error means the fetch is worth retrying.
+func FetchMetadata(urlStr string, contentType ContentType) (*URLMetadata, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	switch contentType {
-	case ContentTypeYouTube:
-		return fetchYouTubeMetadata(ctx, urlStr)
-	case ContentTypeTikTok:
-		return fetchTikTokMetadata(ctx, urlStr)
-	case ContentTypeTweet:
-		return fetchTwitterMetadata(ctx, urlStr)
-	case ContentTypeArticle:
-		return fetchGenericMetadata(ctx, urlStr)
-	default:
-		return &URLMetadata{}
+	p := providerForType(contentType)
+	if p == nil {
+		return &URLMetadata{}, nil
 	}
+	return p.Fetch(ctx, urlStr)
 }
 
-// fetchYouTubeMetadata uses YouTube oEmbed API (no API key needed)
-func fetchYouTubeMetadata(ctx context.Context, urlStr string) *URLMetadata {
-	oembedURL := fmt.Sprintf("https://www.youtube.com/oembed?url=%s&format=json", url.QueryEscape(urlStr))
+// pageMeta collects candidate values while tokenizing; the first value
+// seen for a key wins
+type pageMeta map[string]string
 
-	req, _ := http.NewRequestWithContext(ctx, "GET", oembedURL, nil)
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fetchGenericMetadata(ctx, urlStr)
+func (m pageMeta) set(key, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
 	}
-	defer resp.Body.Close()
-
-	var data struct {
-		Title        string `json:"title"`
-		AuthorName   string `json:"author_name"`
-		ThumbnailURL string `json:"thumbnail_url"`
+	if _, ok := m[key]; !ok {
+		m[key] = value
 	}
-	json.NewDecoder(resp.Body).Decode(&data)
+}
 
-	return &URLMetadata{
-		Title:     data.Title,
-		Author:    data.AuthorName,
-		Thumbnail: data.ThumbnailURL,
-		SiteName:  "YouTube",
+// first returns the first non-empty value among keys
+func (m pageMeta) first(keys ...string) string {
+	for _, k := range keys {
+		if v := m[k]; v != "" {
+			return v
+		}
 	}
+	return ""
 }
 
-// fetchTikTokMetadata uses TikTok oEmbed API
-func fetchTikTokMetadata(ctx context.Context, urlStr string) *URLMetadata {
-	oembedURL := fmt.Sprintf("https://www.tiktok.com/oembed?url=%s", url.QueryEscape(urlStr))
+// extractPageMetadata reads Open Graph, Twitter Card, standard meta tags,
+// <link> elements and JSON-LD from an HTML document. Relative URLs are
+// resolved against base.
+func extractPageMetadata(src string, base *url.URL) *URLMetadata {
+	m := pageMeta{}
+	var ldBlocks []string
+	words := 0
+	inBody := false
 
-	req, _ := http.NewRequestWithContext(ctx, "GET", oembedURL, nil)
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fetchGenericMetadata(ctx, urlStr)
-	}
-	defer resp.Body.Close()
+	z := newHTMLTokenizer(src)
+	var rawFor string // element whose raw text comes next: title, ld+json script
+	for {
+		tok, ok := z.Next()
+		if !ok {
+			break
+		}
+		switch tok.Type {
+		case startTagToken:
+			rawFor = ""
+			switch tok.Tag {
+			case "meta":
+				key := strings.ToLower(firstNonEmpty(tok.Attrs["property"], tok.Attrs["name"], tok.Attrs["itemprop"]))
+				if key != "" {
+					m.set(key, tok.Attrs["content"])
+				}
+				if cs := tok.Attrs["charset"]; cs != "" {
+					m.set("charset", cs)
+				}
+			case "link":
+				rels := strings.Fields(strings.ToLower(tok.Attrs["rel"]))
+				for _, rel := range rels {
+					m.set("link:"+rel, tok.Attrs["href"])
+				}
+			case "title":
+				rawFor = "title"
+			case "script":
+				if strings.Contains(strings.ToLower(tok.Attrs["type"]), "ld+json") {
+					rawFor = "ld+json"
+				}
+			case "time":
+				if tok.Attrs["pubdate"] != "" || tok.Attrs["itemprop"] == "datePublished" {
+					m.set("time:published", tok.Attrs["datetime"])
+				}
+			case "body":
+				inBody = true
+			}
+			if rawTextTags[tok.Tag] && rawFor == "" {
+				rawFor = "skip"
+			}
 
-	var data struct {
-		Title        string `json:"title"`
-		AuthorName   string `json:"author_name"`
-		ThumbnailURL string `json:"thumbnail_url"`
-	}
-	json.NewDecoder(resp.Body).Decode(&data)
+		case textToken:
+			switch rawFor {
+			case "title":
+				m.set("title", strings.Join(strings.Fields(tok.Text), " "))
+			case "ld+json":
+				ldBlocks = append(ldBlocks, tok.Text)
+			case "skip":
+			default:
+				if inBody {
+					words += len(strings.Fields(tok.Text))
+				}
+			}
+			rawFor = ""
 
-	return &URLMetadata{
-		Title:     data.Title,
-		Author:    data.AuthorName,
-		Thumbnail: data.ThumbnailURL,
-		SiteName:  "TikTok",
+		case endTagToken:
+			rawFor = ""
+		}
 	}
-}
 
-// fetchTwitterMetadata - Twitter limits API access, use syndication endpoint
-func fetchTwitterMetadata(ctx context.Context, urlStr string) *URLMetadata {
-	tweetID := ExtractTweetID(urlStr)
-	if tweetID == "" {
-		return &URLMetadata{Title: "Tweet", SiteName: "Twitter/X"}
+	for _, block := range ldBlocks {
+		readJSONLD(block, m)
 	}
 
-	// Try syndication API
-	syndicationURL := fmt.Sprintf("https://cdn.syndication.twimg.com/tweet-result?id=%s&token=a", tweetID)
-	req, _ := http.NewRequestWithContext(ctx, "GET", syndicationURL, nil)
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return &URLMetadata{Title: "Tweet", SiteName: "Twitter/X"}
+	meta := &URLMetadata{
+		Title:       m.first("og:title", "twitter:title", "ld:headline", "title"),
+		Description: m.first("og:description", "twitter:description", "description", "ld:description"),
+		Thumbnail: resolveURL(base, m.first("og:image:secure_url", "og:image", "og:image:url",
+			"twitter:image", "twitter:image:src", "ld:image")),
+		Author:   m.first("ld:author", "author", "article:author", "twitter:creator"),
+		SiteName: m.first("og:site_name", "ld:publisher", "application-name"),
+		PublishedAt: normalizeDate(m.first("article:published_time", "ld:datePublished",
+			"datepublished", "time:published", "date", "pubdate")),
+		CanonicalURL: resolveURL(base, m.first("link:canonical", "og:url")),
+		Favicon:      resolveURL(base, m.first("link:icon", "link:apple-touch-icon")),
 	}
-	defer resp.Body.Close()
 
-	var data struct {
-		Text string `json:"text"`
-		User struct {
-			Name       string `json:"name"`
-			ScreenName string `json:"screen_name"`
-		} `json:"user"`
+	// article:author is often a profile URL rather than a name
+	if strings.HasPrefix(meta.Author, "http://") || strings.HasPrefix(meta.Author, "https://") {
+		meta.Author = firstNonEmpty(m["ld:author"], m["author"], m["twitter:creator"])
 	}
-	json.NewDecoder(resp.Body).Decode(&data)
-
-	title := data.Text
-	if len(title) > 100 {
-		title = title[:97] + "..."
+	if meta.Favicon == "" && base != nil {
+		meta.Favicon = resolveURL(base, "/favicon.ico")
 	}
-
-	author := ""
-	if data.User.ScreenName != "" {
-		author = "@" + data.User.ScreenName
+	if words > 0 {
+		meta.ReadingTime = int(math.Ceil(float64(words) / wordsPerMinute))
 	}
+	return meta
+}
 
-	return &URLMetadata{
-		Title:       title,
-		Description: data.Text,
-		Author:      author,
-		SiteName:    "Twitter/X",
-	}
+// jsonLDArticleTypes are schema.org types whose fields describe the page
+var jsonLDArticleTypes = map[string]bool{
+	"Article": true, "NewsArticle": true, "BlogPosting": true, "TechArticle": true,
+	"Report": true, "ScholarlyArticle": true, "WebPage": true, "VideoObject": true,
+	"SocialMediaPosting": true, "Recipe": true,
 }
 
-// fetchGenericMetadata scrapes Open Graph meta tags
-func fetchGenericMetadata(ctx context.Context, urlStr string) *URLMetadata {
-	req, _ := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Vault/1.0)")
+// readJSONLD pulls article fields out of a JSON-LD block, which may be a
+// single object, an array, or an object with an @graph
+func readJSONLD(block string, m pageMeta) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(block)), &data); err != nil {
+		return
+	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return &URLMetadata{}
+	var visit func(v interface{})
+	visit = func(v interface{}) {
+		switch node := v.(type) {
+		case []interface{}:
+			for _, n := range node {
+				visit(n)
+			}
+		case map[string]interface{}:
+			if graph, ok := node["@graph"]; ok {
+				visit(graph)
+			}
+			if !hasJSONLDType(node["@type"]) {
+				return
+			}
+			m.set("ld:headline", firstNonEmpty(jsonLDString(node["headline"]), jsonLDString(node["name"])))
+			m.set("ld:description", jsonLDString(node["description"]))
+			m.set("ld:image", jsonLDString(node["image"]))
+			m.set("ld:thumbnail", jsonLDString(node["thumbnailUrl"]))
+			m.set("ld:author", jsonLDString(node["author"]))
+			m.set("ld:publisher", jsonLDString(node["publisher"]))
+			m.set("ld:datePublished", firstNonEmpty(jsonLDString(node["datePublished"]), jsonLDString(node["uploadDate"])))
+		}
 	}
-	defer resp.Body.Close()
+	visit(data)
+}
 
-	// Read first 100KB only
-	body, _ := io.ReadAll(io.LimitReader(resp.Body, 100*1024))
-	html := string(body)
+func hasJSONLDType(t interface{}) bool {
+	switch v := t.(type) {
+	case string:
+		return jsonLDArticleTypes[v]
+	case []interface{}:
+		for _, s := range v {
+			if str, ok := s.(string); ok && jsonLDArticleTypes[str] {
+				return true
+			}
+		}
+	}
+	return false
+}
 
-	meta := &URLMetadata{}
+// jsonLDString flattens the common JSON-LD value shapes (string, object
+// with name/url, array of either) to a single string
+func jsonLDString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case map[string]interface{}:
+		return firstNonEmpty(jsonLDString(val["name"]), jsonLDString(val["url"]), jsonLDString(val["@id"]))
+	case []interface{}:
+		for _, item := range val {
+			if s := jsonLDString(item); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
 
-	// Extract Open Graph tags
-	meta.Title = extractMetaContent(html, "og:title")
-	if meta.Title == "" {
-		meta.Title = extractTitle(html)
+// normalizeDate converts common date formats to RFC 3339, returning the
+// input unchanged when it can't be parsed
+func normalizeDate(s string) string {
+	if s == "" {
+		return ""
 	}
-	meta.Description = extractMetaContent(html, "og:description")
-	if meta.Description == "" {
-		meta.Description = extractMetaContent(html, "description")
+	layouts := []string{
+		time.RFC3339, "2006-01-02T15:04:05Z0700", "2006-01-02T15:04:05",
+		"2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02",
+		time.RFC1123Z, time.RFC1123,
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339)
+		}
 	}
-	meta.Thumbnail = extractMetaContent(html, "og:image")
-	meta.SiteName = extractMetaContent(html, "og:site_name")
-	meta.Author = extractMetaContent(html, "author")
+	return s
+}
 
-	return meta
+func resolveURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	return u.String()
 }
 
-func extractMetaContent(html, property string) string {
-	patterns := []string{
-		fmt.Sprintf(`<meta[^>]+property="%s"[^>]+content="([^"]*)"`, property),
-		fmt.Sprintf(`<meta[^>]+content="([^"]*)"[^>]+property="%s"`, property),
-		fmt.Sprintf(`<meta[^>]+name="%s"[^>]+content="([^"]*)"`, property),
-		fmt.Sprintf(`<meta[^>]+content="([^"]*)"[^>]+name="%s"`, property),
-	}
-	for _, pattern := range patterns {
-		re := regexp.MustCompile(pattern)
-		if matches := re.FindStringSubmatch(html); len(matches) > 1 {
-			return strings.TrimSpace(matches[1])
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
 		}
 	}
 	return ""
 }
 
-func extractTitle(html string) string {
-	re := regexp.MustCompile(`<title[^>]*>([^<]+)</title>`)
-	if matches := re.FindStringSubmatch(html); len(matches) > 1 {
-		return strings.TrimSpace(matches[1])
+// decodeHTML converts a page body to UTF-8. The encoding comes from a
+// byte order mark, the Content-Type header or a <meta> declaration, found
+// the way browsers do; an undeclared page is UTF-8 if it is valid UTF-8
+// and Windows-1252 otherwise.
+func decodeHTML(body []byte, contentType string) string {
+	r, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return string(body)
 	}
-	return ""
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		return string(body)
+	}
+	return string(decoded)
 }
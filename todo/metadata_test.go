@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeHTML(t *testing.T) {
+	tests := []struct {
+		name, contentType, body, want string
+	}{
+		{"utf-8", "text/html; charset=utf-8", "<p>naïve 日本</p>", "<p>naïve 日本</p>"},
+		{"undeclared utf-8", "text/html", "<p>naïve</p>", "<p>naïve</p>"},
+		{"undeclared windows-1252", "", "caf\xe9 \x93x\x94", "café “x”"},
+		{"latin-1 header", "text/html; charset=ISO-8859-1", "caf\xe9", "café"},
+		{"shift_jis meta", "text/html", `<meta charset="Shift_JIS"><p>` + "\x93\xfa\x96\x7b", "日本"},
+		{"gbk header", "text/html; charset=GBK", "\xd6\xd0\xce\xc4", "中文"},
+		{"euc-kr http-equiv", "", `<meta http-equiv="Content-Type" content="text/html; charset=euc-kr">` + "\xc7\xd1\xb1\xb9", "한국"},
+		{"koi8-r header", "text/html; charset=koi8-r", "\xf0\xd2\xc9\xd7\xc5\xd4", "Привет"},
+		{"utf-8 bom beats header", "text/html; charset=windows-1252", "\xef\xbb\xbfna\xc3\xafve", "naïve"},
+	}
+	for _, tt := range tests {
+		if got := decodeHTML([]byte(tt.body), tt.contentType); !strings.HasSuffix(got, tt.want) {
+			t.Errorf("%s: decodeHTML = %q, want it to end in %q", tt.name, got, tt.want)
+		}
+	}
+}
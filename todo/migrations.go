@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is a single forward-only schema change. Versions must be
+// contiguous and never reordered once released.
+type migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+}
+
+// migrations lists every schema change in order. Append new entries at the end.
+var migrations = []migration{
+	{1, "create todos", execSQL(todoSchema)},
+	{2, "create vault tables", execSQL(vaultSchema)},
+	{3, "full-text search index", execSQL(vaultFTSSchema)},
+	{4, "create snapshots", execSQL(snapshotSchema)},
+	{5, "add thumbnail hash", execSQL(`ALTER TABLE vault_items ADD COLUMN thumb_hash TEXT DEFAULT ''`)},
+	{6, "metadata fetch queue", execSQL(fetchQueueSchema)},
+	{7, "extended page metadata", execSQL(`
+		ALTER TABLE vault_items ADD COLUMN meta_published_at TEXT DEFAULT '';
+		ALTER TABLE vault_items ADD COLUMN meta_canonical_url TEXT DEFAULT '';
+		ALTER TABLE vault_items ADD COLUMN meta_favicon TEXT DEFAULT '';
+		ALTER TABLE vault_items ADD COLUMN meta_reading_time INTEGER DEFAULT 0;
+	`)},
+	{8, "canonical URLs for duplicate detection", backfillCanonicalURLs},
+	{9, "original URL of resolved short links", execSQL(`ALTER TABLE vault_items ADD COLUMN original_url TEXT DEFAULT ''`)},
+	{10, "recurring todos", execSQL(`ALTER TABLE todos ADD COLUMN recurrence TEXT DEFAULT ''`)},
+	{11, "normalized due dates", normalizeLegacyDueDates},
+	{12, "subtasks", execSQL(subtaskSchema)},
+	{13, "task dependencies", execSQL(depsSchema)},
+	{14, "import source ids", execSQL(`
+		ALTER TABLE todos ADD COLUMN source_id TEXT DEFAULT '';
+		CREATE UNIQUE INDEX idx_todos_source_id ON todos(source_id) WHERE source_id != '';
+	`)},
+	{15, "todo.txt sync state", execSQL(todotxtSyncSchema)},
+	{16, "todo contexts", execSQL(`
+		ALTER TABLE todos ADD COLUMN context TEXT DEFAULT '';
+		CREATE INDEX idx_todos_context ON todos(context);
+	`)},
+	{17, "code comment scan state", execSQL(codeCommentSchema)},
+	{18, "fetch queue times in UTC", execSQL(`
+		UPDATE fetch_jobs SET run_after = strftime('%Y-%m-%dT%H:%M:%SZ', run_after) WHERE run_after != '';
+		UPDATE fetch_jobs SET locked_at = strftime('%Y-%m-%dT%H:%M:%SZ', locked_at) WHERE locked_at != '';
+	`)},
+	{19, "recurring todo occurrence links", execSQL(`ALTER TABLE todos ADD COLUMN recurs_from INTEGER REFERENCES todos(id) ON DELETE SET NULL`)},
+	{20, "todo completion times", execSQL(`
+		ALTER TABLE todos ADD COLUMN completed_at TEXT DEFAULT '';
+		UPDATE todos SET completed_at = updated_at WHERE done;
+	`)},
+	{21, "code comment state per scan root", execSQL(codeCommentKeySchema)},
+}
+
+// execSQL wraps a plain SQL script as a migration step
+func execSQL(stmt string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(stmt)
+		return err
+	}
+}
+
+// LatestSchemaVersion is the newest schema this binary understands
+func LatestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func ensureSchemaVersionTable() error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	);`)
+	return err
+}
+
+// IsVersioned reports whether the database has a schema_version table,
+// i.e. whether migrations have ever been applied to it
+func IsVersioned() (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`).Scan(&n)
+	return n > 0, err
+}
+
+// CurrentSchemaVersion returns the highest applied migration version, 0
+// for an unversioned database. It only reads.
+func CurrentSchemaVersion() (int, error) {
+	if versioned, err := IsVersioned(); err != nil || !versioned {
+		return 0, err
+	}
+	var version sql.NullInt64
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// Migrate applies all pending migrations, each in its own transaction.
+// It refuses to touch a database written by a newer binary.
+func Migrate() error {
+	if err := ensureSchemaVersionTable(); err != nil {
+		return err
+	}
+	current, err := CurrentSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d); please upgrade vault", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		if err := applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.Up(tx); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.Version, m.Name, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrationStatus describes one migration and whether it has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// GetMigrationStatus lists known migrations alongside their applied state.
+// An unversioned database has none applied; the table isn't created.
+func GetMigrationStatus() ([]MigrationStatus, error) {
+	applied := map[int]time.Time{}
+	versioned, err := IsVersioned()
+	if err != nil {
+		return nil, err
+	}
+	if versioned {
+		rows, err := db.Query(`SELECT version, applied_at FROM schema_version`)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var version int
+			var appliedAt string
+			if err := rows.Scan(&version, &appliedAt); err != nil {
+				return nil, err
+			}
+			applied[version], _ = time.Parse(time.RFC3339, appliedAt)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	var statuses []MigrationStatus
+	for _, m := range migrations {
+		at, ok := applied[m.Version]
+		statuses = append(statuses, MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: at,
+		})
+	}
+	return statuses, nil
+}
@@ -12,14 +12,25 @@ const (
 )
 
 type Todo struct {
-	ID        int64     `json:"id"`
-	Task      string    `json:"task"`
-	Done      bool      `json:"done"`
-	Priority  Priority  `json:"priority"`
-	Category  string    `json:"category"`
-	DueDate   string    `json:"due_date"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            int64     `json:"id"`
+	Task          string    `json:"task"`
+	Done          bool      `json:"done"`
+	Priority      Priority  `json:"priority"`
+	Category      string    `json:"category"`
+	DueDate       string    `json:"due_date"`   // 2006-01-02 or 2006-01-02T15:04, local time
+	DuePhrase     string    `json:"due_phrase"` // what the user typed, e.g. "next fri"
+	Recurrence    string    `json:"recurrence"` // e.g. "every mon,wed", see ParseRecurrence
+	ParentID      int64     `json:"parent_id,omitempty"`
+	SubtasksDone  int       `json:"subtasks_done"` // roll-up over all nested subtasks
+	SubtasksTotal int       `json:"subtasks_total"`
+	BlockedBy     []int64   `json:"blocked_by"` // pending prerequisites
+	Blocks        []int64   `json:"blocks"`     // pending todos waiting on this one
+	Blocked       bool      `json:"blocked"`
+	SourceID      string    `json:"source_id,omitempty"` // where an imported todo came from
+	Context       string    `json:"context"`             // tmux session or git repo it was added in, see currentContext
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	CompletedAt   time.Time `json:"completed_at"` // zero while pending
 }
 
 type TodoFilter struct {
@@ -27,8 +38,18 @@ type TodoFilter struct {
 	Priority string // all, low, medium, high
 	Category string
 	Search   string
+	Due      string // overdue, today, this-week, no-date
+	Context  string // this context plus todos without one
 }
 
+// Due filter modes for TodoFilter.Due
+const (
+	DueOverdue  = "overdue"
+	DueToday    = "today"
+	DueThisWeek = "this-week"
+	DueNoDate   = "no-date"
+)
+
 // Vault types (new)
 type ContentType string
 
@@ -45,19 +66,43 @@ type VaultItem struct {
 	ContentType     ContentType `json:"content_type"`
 	Title           string      `json:"title"`
 	Content         string      `json:"content"`
-	URL             string      `json:"url"`
+	URL             string      `json:"url"`           // resolved destination
+	OriginalURL     string      `json:"original_url"`  // short link as saved, if it was resolved
+	CanonicalURL    string      `json:"canonical_url"` // duplicate detection key, see CanonicalizeURL
 	MetaTitle       string      `json:"meta_title"`
 	MetaDescription string      `json:"meta_description"`
 	MetaThumbnail   string      `json:"meta_thumbnail"`
 	MetaAuthor      string      `json:"meta_author"`
 	MetaSiteName    string      `json:"meta_site_name"`
+	MetaPublishedAt string      `json:"meta_published_at"`
+	MetaCanonical   string      `json:"meta_canonical_url"`
+	MetaFavicon     string      `json:"meta_favicon"`
+	MetaReadingTime int         `json:"meta_reading_time"` // minutes
+	ThumbHash       string      `json:"thumb_hash"`
+	MetaStatus      string      `json:"meta_status"` // pending, ok, failed
+	MetaError       string      `json:"meta_error"`
+	MetaAttempts    int         `json:"meta_attempts"`
 	Pinned          bool        `json:"pinned"`
 	Archived        bool        `json:"archived"`
 	Tags            []Tag       `json:"tags"`
+	Snippet         string      `json:"snippet,omitempty"`
+	Duplicate       bool        `json:"duplicate,omitempty"` // set when a save matched an existing item
 	CreatedAt       time.Time   `json:"created_at"`
 	UpdatedAt       time.Time   `json:"updated_at"`
 }
 
+// Snapshot is an offline readable copy of a saved page
+type Snapshot struct {
+	ItemID    int64     `json:"item_id"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Byline    string    `json:"byline"`
+	Text      string    `json:"text"`
+	HTML      string    `json:"html,omitempty"`
+	WordCount int       `json:"word_count"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
 type Tag struct {
 	ID        int64     `json:"id"`
 	Name      string    `json:"name"`
@@ -70,7 +115,7 @@ type VaultFilter struct {
 	TagNames    []string
 	Pinned      *bool
 	Archived    *bool
-	Search      string
+	Search      string // full-text query: "exact phrase" go* -python
 	Limit       int
 	Offset      int
 }
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// `vault pick`: a fuzzy finder over pending todos and vault items, meant
+// to run in a tmux popup (see `vault tmux install`). Enter marks a todo
+// done or opens an item's link; Ctrl-Y pastes the selection into the pane
+// the popup was opened from.
+
+// pickEntry is one row of the picker
+type pickEntry struct {
+	Kind  string // "todo" or "item"
+	ID    int64
+	Label string // what is shown and matched
+	URL   string
+	Paste string // text sent to the pane by Ctrl-Y
+}
+
+// pickMatch is an entry that matched the query
+type pickMatch struct {
+	entry     *pickEntry
+	score     int
+	positions []int // matched rune offsets in the label, for highlighting
+}
+
+// loadPickEntries reads pending todos and/or unarchived items
+func loadPickEntries(todos, items bool) ([]pickEntry, error) {
+	var entries []pickEntry
+	if todos {
+		list, err := GetTodos(TodoFilter{Status: "pending"})
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range list {
+			label := "[ ] " + t.Task
+			if t.Category != "" {
+				label += " @" + t.Category
+			}
+			if t.DueDate != "" {
+				label += " (due " + FormatDue(t.DueDate) + ")"
+			}
+			entries = append(entries, pickEntry{Kind: "todo", ID: t.ID, Label: label, Paste: t.Task})
+		}
+	}
+	if items {
+		list, err := GetVaultItems(VaultFilter{})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			title := firstNonEmpty(item.MetaTitle, item.Title, truncateStr(item.Content, 80))
+			label := getTypeIcon(item.ContentType) + " " + title
+			for _, tag := range item.Tags {
+				label += " #" + tag.Name
+			}
+			paste := firstNonEmpty(item.URL, item.Content)
+			entries = append(entries, pickEntry{Kind: "item", ID: item.ID, Label: label, URL: item.URL, Paste: paste})
+		}
+	}
+	return entries, nil
+}
+
+// fuzzyMatch reports whether every rune of query appears in text in order
+// (case-insensitively). Consecutive runs and word starts score higher,
+// gaps lower.
+func fuzzyMatch(query, text string) (score int, positions []int, ok bool) {
+	q := []rune(strings.ToLower(query))
+	if len(q) == 0 {
+		return 0, nil, true
+	}
+	t := []rune(strings.ToLower(text))
+	qi, last := 0, -1
+	for i, r := range t {
+		if qi == len(q) {
+			break
+		}
+		if r != q[qi] {
+			continue
+		}
+		switch {
+		case last == i-1:
+			score += 8
+		case last >= 0:
+			score -= min(i-last-1, 5)
+		}
+		if i == 0 || !unicode.IsLetter(t[i-1]) && !unicode.IsDigit(t[i-1]) {
+			score += 6
+		}
+		positions = append(positions, i)
+		last = i
+		qi++
+	}
+	if qi < len(q) {
+		return 0, nil, false
+	}
+	return score, positions, true
+}
+
+// filterPick ranks the entries matching query; ties keep list order
+func filterPick(entries []pickEntry, query string) []pickMatch {
+	var matches []pickMatch
+	for i := range entries {
+		if score, pos, ok := fuzzyMatch(query, entries[i].Label); ok {
+			matches = append(matches, pickMatch{entry: &entries[i], score: score, positions: pos})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	return matches
+}
+
+// pickAction is what the user chose to do with the selection
+type pickAction int
+
+const (
+	pickCancel pickAction = iota
+	pickDefault
+	pickPaste
+)
+
+// runPicker shows the picker until an entry is chosen or it is cancelled
+func runPicker(entries []pickEntry) (*pickEntry, pickAction, error) {
+	term, err := openTerminal()
+	if err != nil {
+		return nil, pickCancel, err
+	}
+	defer term.Close()
+
+	query := []rune{}
+	selected, offset := 0, 0
+	matches := filterPick(entries, "")
+	for {
+		rows, cols := term.size()
+		listRows := max(rows-2, 1)
+		if selected < offset {
+			offset = selected
+		}
+		if selected >= offset+listRows {
+			offset = selected - listRows + 1
+		}
+		drawPicker(term, string(query), matches, selected, offset, listRows, cols, len(entries))
+
+		k, err := term.readKey()
+		if err != nil {
+			return nil, pickCancel, err
+		}
+		switch {
+		case k.code == keyEsc || k.code == keyCtrl && (k.r == 'c' || k.r == 'g' || k.r == 'q'):
+			return nil, pickCancel, nil
+		case k.code == keyEnter:
+			if len(matches) > 0 {
+				return matches[selected].entry, pickDefault, nil
+			}
+		case k.code == keyCtrl && k.r == 'y':
+			if len(matches) > 0 {
+				return matches[selected].entry, pickPaste, nil
+			}
+		case k.code == keyUp || k.code == keyCtrl && (k.r == 'p' || k.r == 'k'):
+			selected = max(selected-1, 0)
+		case k.code == keyDown || k.code == keyTab || k.code == keyCtrl && (k.r == 'n' || k.r == 'j'):
+			selected = min(selected+1, max(len(matches)-1, 0))
+		case k.code == keyPageUp:
+			selected = max(selected-listRows, 0)
+		case k.code == keyPageDown:
+			selected = min(selected+listRows, max(len(matches)-1, 0))
+		case k.code == keyBackspace:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				matches, selected, offset = filterPick(entries, string(query)), 0, 0
+			}
+		case k.code == keyCtrl && k.r == 'u':
+			query = query[:0]
+			matches, selected, offset = filterPick(entries, ""), 0, 0
+		case k.code == keyRune && unicode.IsPrint(k.r):
+			query = append(query, k.r)
+			matches, selected, offset = filterPick(entries, string(query)), 0, 0
+		}
+	}
+}
+
+// drawPicker redraws the whole screen: the prompt, the matches and a
+// footer with the keys
+func drawPicker(term *terminal, query string, matches []pickMatch, selected, offset, listRows, cols, total int) {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	counter := fmt.Sprintf(" %d/%d", len(matches), total)
+	b.WriteString("\x1b[1;36m> \x1b[0m" + fitWidth(query, cols-len(counter)-3) + "\x1b[90m" + counter + "\x1b[0m\r\n")
+
+	for i := offset; i < len(matches) && i < offset+listRows; i++ {
+		m := matches[i]
+		if i == selected {
+			b.WriteString("\x1b[7m")
+		}
+		hit := map[int]bool{}
+		for _, p := range m.positions {
+			hit[p] = true
+		}
+		runes := []rune(fitWidth(m.entry.Label, cols-1))
+		for j, r := range runes {
+			if hit[j] {
+				b.WriteString("\x1b[1;33m" + string(r) + "\x1b[22;39m")
+			} else {
+				b.WriteRune(r)
+			}
+		}
+		b.WriteString("\x1b[K\x1b[0m\r\n")
+	}
+
+	b.WriteString(fmt.Sprintf("\x1b[%d;1H\x1b[90m%s\x1b[0m", listRows+2,
+		fitWidth("enter: done/open · ctrl-y: paste · esc: quit", cols-1)))
+	term.write(b.String())
+}
+
+// openURL opens a link in the default browser
+func openURL(url string) error {
+	name := "xdg-open"
+	if runtime.GOOS == "darwin" {
+		name = "open"
+	}
+	cmd := exec.Command(name, url)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// pasteToPane types text into a tmux pane (the active one if pane is "")
+// without pressing Enter. Outside tmux the text is printed instead.
+func pasteToPane(pane, text string) error {
+	if os.Getenv("TMUX") == "" {
+		fmt.Println(text)
+		return nil
+	}
+	args := []string{"send-keys", "-l"}
+	if pane != "" {
+		args = append(args, "-t", pane)
+	}
+	return exec.Command("tmux", append(args, "--", text)...).Run()
+}
+
+// notify shows a message in the tmux status line, or prints it
+func notify(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	// display-message expands formats, so a literal # is doubled
+	if os.Getenv("TMUX") != "" && exec.Command("tmux", "display-message", "--", strings.ReplaceAll(msg, "#", "##")).Run() == nil {
+		return
+	}
+	fmt.Println(msg)
+}
+
+func handlePick(a *cmdArgs) {
+	todos, items := a.Has("--todos"), a.Has("--items")
+	if !todos && !items {
+		todos, items = true, true
+	}
+	entries, err := loadPickEntries(todos, items)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if len(entries) == 0 {
+		fmt.Println("Nothing to pick")
+		return
+	}
+
+	entry, action, err := runPicker(entries)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	switch {
+	case action == pickCancel:
+	case action == pickPaste || entry.Kind == "item" && entry.URL == "":
+		if err := pasteToPane(a.Value("--pane"), entry.Paste); err != nil {
+			notify("vault: paste failed: %v", err)
+		}
+	case entry.Kind == "item":
+		if err := openURL(entry.URL); err != nil {
+			notify("vault: could not open %s: %v", entry.URL, err)
+		}
+	default:
+		next, err := MarkTodoDone(entry.ID, true, false)
+		if err != nil {
+			notify("vault: %v", err)
+			return
+		}
+		if next != nil {
+			notify("Done: [%d] %s (next due %s)", entry.ID, entry.Paste, FormatDue(next.DueDate))
+		} else {
+			notify("Done: [%d] %s", entry.ID, entry.Paste)
+		}
+	}
+}
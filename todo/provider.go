@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MetadataProvider knows how to recognise and describe links from one site.
+// Adding a site means adding one provider_<site>.go file that registers
+// itself in init().
+type MetadataProvider interface {
+	// Name identifies the provider, e.g. "youtube"
+	Name() string
+	// Match reports whether the provider handles this URL
+	Match(u *url.URL) bool
+	// ContentType is the type assigned to matching URLs
+	ContentType() ContentType
+	// Fetch retrieves metadata. An error means the fetch is worth retrying.
+	Fetch(ctx context.Context, urlStr string) (*URLMetadata, error)
+	// Canonicalize returns the preferred form of a matching URL
+	Canonicalize(u *url.URL) string
+}
+
+var (
+	providers       []MetadataProvider
+	genericProvider MetadataProvider = articleProvider{}
+)
+
+// RegisterProvider adds a site-specific provider. Providers are consulted
+// in registration order; the generic article provider is always last.
+func RegisterProvider(p MetadataProvider) {
+	providers = append(providers, p)
+}
+
+// ProviderFor returns the provider for a URL, falling back to the generic
+// article provider. It returns nil for input that isn't an http(s) URL.
+func ProviderFor(urlStr string) MetadataProvider {
+	u, err := url.Parse(strings.TrimSpace(urlStr))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil
+	}
+	for _, p := range providers {
+		if p.Match(u) {
+			return p
+		}
+	}
+	return genericProvider
+}
+
+// providerForType returns the provider that produces a content type
+func providerForType(ct ContentType) MetadataProvider {
+	for _, p := range providers {
+		if p.ContentType() == ct {
+			return p
+		}
+	}
+	if ct == genericProvider.ContentType() {
+		return genericProvider
+	}
+	return nil
+}
+
+// CanonicalizeURL returns the form of a URL used for duplicate detection:
+// tracking parameters stripped, host lowercased, then the provider's own
+// rules applied. Input that isn't a URL is returned unchanged.
+func CanonicalizeURL(urlStr string) string {
+	p := ProviderFor(urlStr)
+	if p == nil {
+		return urlStr
+	}
+	u, _ := url.Parse(strings.TrimSpace(urlStr))
+	u.Host = strings.ToLower(u.Host)
+	u.Host = strings.TrimSuffix(strings.TrimSuffix(u.Host, ":80"), ":443")
+	u.Fragment = ""
+	stripTrackingParams(u)
+	return p.Canonicalize(u)
+}
+
+// hostMatches reports whether host is domain or a subdomain of it
+func hostMatches(host string, domains ...string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchOEmbed queries an oEmbed endpoint, falling back to scraping the page
+// when the endpoint is unavailable
+func fetchOEmbed(ctx context.Context, endpoint, urlStr, siteName string) (*URLMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fetchGenericMetadata(ctx, urlStr)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fetchGenericMetadata(ctx, urlStr)
+	}
+
+	var data struct {
+		Title        string `json:"title"`
+		AuthorName   string `json:"author_name"`
+		ThumbnailURL string `json:"thumbnail_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("decoding oEmbed response: %w", err)
+	}
+
+	return &URLMetadata{
+		Title:     data.Title,
+		Author:    data.AuthorName,
+		Thumbnail: data.ThumbnailURL,
+		SiteName:  siteName,
+	}, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// articleProvider is the fallback for any web page: it scrapes Open Graph
+// tags. It is not registered; ProviderFor returns it when nothing else matches.
+type articleProvider struct{}
+
+func (articleProvider) Name() string { return "article" }
+
+func (articleProvider) ContentType() ContentType { return ContentTypeArticle }
+
+func (articleProvider) Match(u *url.URL) bool { return true }
+
+func (articleProvider) Fetch(ctx context.Context, urlStr string) (*URLMetadata, error) {
+	return fetchGenericMetadata(ctx, urlStr)
+}
+
+// Canonicalize lowercases the host and drops the fragment
+func (articleProvider) Canonicalize(u *url.URL) string {
+	c := *u
+	c.Host = strings.ToLower(c.Host)
+	c.Fragment = ""
+	return c.String()
+}
+
+// fetchGenericMetadata scrapes Open Graph meta tags
+func fetchGenericMetadata(ctx context.Context, urlStr string) (*URLMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Vault/1.0)")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("fetching %s: %s", urlStr, resp.Status)
+	}
+
+	// Metadata lives in <head>; the rest is only needed for reading time
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 512*1024))
+	if err != nil {
+		return nil, err
+	}
+	meta := extractPageMetadata(decodeHTML(body, resp.Header.Get("Content-Type")), resp.Request.URL)
+
+	return meta, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestCanonicalizeURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		// Articles: host case, default ports, fragments and tracking
+		{"https://Example.COM/Post?b=2&a=1", "https://example.com/Post?a=1&b=2"},
+		{"https://example.com:443/post#comments", "https://example.com/post"},
+		{"http://example.com:80/post", "http://example.com/post"},
+		{"https://example.com/post?utm_source=x&UTM_Medium=y&id=7&fbclid=abc", "https://example.com/post?id=7"},
+		{"https://example.com/post?gclid=1&si=2", "https://example.com/post"},
+		{"  https://example.com/post  ", "https://example.com/post"},
+
+		// Provider rules
+		{"https://youtu.be/dQw4w9WgXcQ?si=share", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://m.youtube.com/watch?v=dQw4w9WgXcQ&feature=share&t=10", "https://www.youtube.com/watch?v=dQw4w9WgXcQ"},
+		{"https://www.youtube.com/shorts/abc123DEF45", "https://www.youtube.com/watch?v=abc123DEF45"},
+		{"https://twitter.com/someone/status/1234567890?s=20&t=xyz", "https://x.com/i/status/1234567890"},
+		{"https://mobile.x.com/someone/status/1234567890", "https://x.com/i/status/1234567890"},
+		{"http://tiktok.com/@user/video/42?is_from_webapp=1&lang=en", "https://www.tiktok.com/@user/video/42"},
+
+		// Not a URL: unchanged
+		{"just a note", "just a note"},
+	}
+	for _, tt := range tests {
+		if got := CanonicalizeURL(tt.in); got != tt.want {
+			t.Errorf("CanonicalizeURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHostMatches(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"x.com", true},
+		{"mobile.X.com.", true},
+		{"twitter.com", true},
+		{"notx.com", false},
+		{"x.com.evil.example", false},
+	}
+	for _, tt := range tests {
+		if got := hostMatches(tt.host, "twitter.com", "x.com"); got != tt.want {
+			t.Errorf("hostMatches(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
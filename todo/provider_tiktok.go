@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// tiktokProvider handles tiktok.com videos and vm.tiktok.com short links
+type tiktokProvider struct{}
+
+func init() {
+	RegisterProvider(tiktokProvider{})
+}
+
+func (tiktokProvider) Name() string { return "tiktok" }
+
+func (tiktokProvider) ContentType() ContentType { return ContentTypeTikTok }
+
+func (tiktokProvider) Match(u *url.URL) bool {
+	return hostMatches(u.Host, "tiktok.com")
+}
+
+// Fetch uses the TikTok oEmbed API
+func (tiktokProvider) Fetch(ctx context.Context, urlStr string) (*URLMetadata, error) {
+	endpoint := fmt.Sprintf("https://www.tiktok.com/oembed?url=%s", url.QueryEscape(urlStr))
+	return fetchOEmbed(ctx, endpoint, urlStr, "TikTok")
+}
+
+// Canonicalize drops the query string, which only carries share tracking.
+// Short links (vm./vt.tiktok.com) keep their host since the path is a code.
+func (tiktokProvider) Canonicalize(u *url.URL) string {
+	c := *u
+	c.Scheme = "https"
+	if !hostMatches(u.Host, "vm.tiktok.com", "vt.tiktok.com") {
+		c.Host = "www.tiktok.com"
+	}
+	c.RawQuery = ""
+	c.Fragment = ""
+	return c.String()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+var (
+	tweetPathPattern = regexp.MustCompile(`^/(\w+)/status/(\d+)`)
+	tweetIDPattern   = regexp.MustCompile(`/status/(\d+)`)
+)
+
+// twitterProvider handles tweet links on twitter.com and x.com
+type twitterProvider struct{}
+
+func init() {
+	RegisterProvider(twitterProvider{})
+}
+
+func (twitterProvider) Name() string { return "twitter" }
+
+func (twitterProvider) ContentType() ContentType { return ContentTypeTweet }
+
+func (twitterProvider) Match(u *url.URL) bool {
+	return hostMatches(u.Host, "twitter.com", "x.com") && tweetPathPattern.MatchString(u.Path)
+}
+
+// Fetch uses the syndication endpoint, since Twitter limits API access
+func (twitterProvider) Fetch(ctx context.Context, urlStr string) (*URLMetadata, error) {
+	tweetID := ExtractTweetID(urlStr)
+	if tweetID == "" {
+		return &URLMetadata{Title: "Tweet", SiteName: "Twitter/X"}, nil
+	}
+
+	syndicationURL := fmt.Sprintf("https://cdn.syndication.twimg.com/tweet-result?id=%s&token=a", tweetID)
+	req, err := http.NewRequestWithContext(ctx, "GET", syndicationURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return nil, fmt.Errorf("syndication API: %s", resp.Status)
+	}
+
+	var data struct {
+		Text string `json:"text"`
+		User struct {
+			Name       string `json:"name"`
+			ScreenName string `json:"screen_name"`
+		} `json:"user"`
+	}
+	json.NewDecoder(resp.Body).Decode(&data)
+
+	title := data.Text
+	if len(title) > 100 {
+		title = title[:97] + "..."
+	}
+
+	author := ""
+	if data.User.ScreenName != "" {
+		author = "@" + data.User.ScreenName
+	}
+
+	return &URLMetadata{
+		Title:       title,
+		Description: data.Text,
+		Author:      author,
+		SiteName:    "Twitter/X",
+	}, nil
+}
+
+// Canonicalize keys tweets by ID alone, since the same tweet is reachable
+// under twitter.com, x.com and any spelling of the username
+func (twitterProvider) Canonicalize(u *url.URL) string {
+	id := ExtractTweetID(u.Path)
+	if id == "" {
+		return u.String()
+	}
+	return "https://x.com/i/status/" + id
+}
+
+// ExtractTweetID extracts tweet ID from Twitter/X URLs
+func ExtractTweetID(urlStr string) string {
+	matches := tweetIDPattern.FindStringSubmatch(urlStr)
+	if len(matches) > 1 {
+		return matches[1]
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// youtubeProvider handles youtube.com watch/shorts links and youtu.be
+type youtubeProvider struct{}
+
+func init() {
+	RegisterProvider(youtubeProvider{})
+}
+
+func (youtubeProvider) Name() string { return "youtube" }
+
+func (youtubeProvider) ContentType() ContentType { return ContentTypeYouTube }
+
+func (youtubeProvider) Match(u *url.URL) bool {
+	switch {
+	case hostMatches(u.Host, "youtu.be"):
+		return strings.Trim(u.Path, "/") != ""
+	case hostMatches(u.Host, "youtube.com"):
+		return (u.Path == "/watch" && u.Query().Get("v") != "") || strings.HasPrefix(u.Path, "/shorts/")
+	}
+	return false
+}
+
+// Fetch uses the YouTube oEmbed API (no API key needed)
+func (youtubeProvider) Fetch(ctx context.Context, urlStr string) (*URLMetadata, error) {
+	endpoint := fmt.Sprintf("https://www.youtube.com/oembed?url=%s&format=json", url.QueryEscape(urlStr))
+	return fetchOEmbed(ctx, endpoint, urlStr, "YouTube")
+}
+
+func (youtubeProvider) Canonicalize(u *url.URL) string {
+	if id := ExtractYouTubeID(u.String()); id != "" {
+		return "https://www.youtube.com/watch?v=" + id
+	}
+	return u.String()
+}
+
+// ExtractYouTubeID extracts video ID from YouTube URLs
+func ExtractYouTubeID(urlStr string) string {
+	// Handle youtube.com/watch?v=ID
+	if strings.Contains(urlStr, "youtube.com/watch") {
+		u, _ := url.Parse(urlStr)
+		return u.Query().Get("v")
+	}
+	// Handle youtu.be/ID
+	if strings.Contains(urlStr, "youtu.be/") {
+		parts := strings.Split(urlStr, "youtu.be/")
+		if len(parts) > 1 {
+			id := strings.Split(parts[1], "?")[0]
+			return strings.TrimSuffix(id, "/")
+		}
+	}
+	// Handle youtube.com/shorts/ID
+	if strings.Contains(urlStr, "/shorts/") {
+		parts := strings.Split(urlStr, "/shorts/")
+		if len(parts) > 1 {
+			return strings.Split(parts[1], "?")[0]
+		}
+	}
+	return ""
+}
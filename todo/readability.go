@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Readability-style main content extraction for offline snapshots
+
+const maxSnapshotBytes = 5 * 1024 * 1024
+
+var (
+	unlikelyPattern = regexp.MustCompile(`(?i)ad-|ads|advert|banner|breadcrumb|combx|comment|community|cookie|disqus|footer|header|menu|modal|nav|newsletter|popup|promo|related|remark|rss|share|shoutbox|sidebar|social|sponsor|subscribe|tags|toolbar|widget`)
+	positivePattern = regexp.MustCompile(`(?i)article|body|content|entry|hentry|main|page|post|story|text|blog`)
+)
+
+// stripTags never contain readable article content
+var stripTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "nav": true,
+	"header": true, "footer": true, "aside": true, "form": true,
+	"iframe": true, "svg": true, "button": true, "select": true,
+	"input": true, "textarea": true, "object": true, "embed": true,
+	"canvas": true, "template": true,
+}
+
+// FetchSnapshot downloads a page and extracts its readable content
+func FetchSnapshot(urlStr string) (*Snapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Vault/1.0)")
+
+	client := &http.Client{Timeout: 20 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("fetching %s: %s", urlStr, resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.Contains(ct, "html") {
+		return nil, fmt.Errorf("not an HTML page (%s)", ct)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSnapshotBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	snap := ExtractReadable(decodeHTML(body, resp.Header.Get("Content-Type")), resp.Request.URL)
+	snap.URL = resp.Request.URL.String()
+	snap.FetchedAt = time.Now()
+	return snap, nil
+}
+
+// CaptureSnapshot fetches an item's URL and stores its readable copy.
+// The sanitized HTML is only kept when keepHTML is set.
+func CaptureSnapshot(item *VaultItem, keepHTML bool) (*Snapshot, error) {
+	if item.URL == "" {
+		return nil, fmt.Errorf("item %d has no URL", item.ID)
+	}
+	snap, err := FetchSnapshot(item.URL)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(snap.Text) == "" {
+		return nil, fmt.Errorf("no readable content found")
+	}
+	snap.ItemID = item.ID
+	if !keepHTML {
+		snap.HTML = ""
+	}
+	if err := SaveSnapshot(snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// ExtractReadable finds the main content of a page and returns it as
+// plain text plus a sanitized HTML copy
+func ExtractReadable(src string, base *url.URL) *Snapshot {
+	meta := extractPageMetadata(src, base)
+	snap := &Snapshot{Title: meta.Title, Byline: meta.Author}
+
+	doc := parseHTML(src)
+
+	body := doc.Find("body")
+	if body == nil {
+		body = doc
+	}
+	removeUnlikely(body)
+
+	content := pickContentNode(body)
+	snap.Text = renderReadableText(content)
+	snap.HTML = renderSanitizedHTML(content, base)
+	snap.WordCount = len(strings.Fields(snap.Text))
+	return snap
+}
+
+// removeUnlikely drops boilerplate elements in place
+func removeUnlikely(root *htmlNode) {
+	root.Walk(func(n *htmlNode) bool {
+		if n.IsText() || n == root {
+			return true
+		}
+		if stripTags[n.Tag] || n.Attr("hidden") != "" || n.Attr("aria-hidden") == "true" {
+			n.remove()
+			return false
+		}
+		if n.Tag == "article" || n.Tag == "main" {
+			return true
+		}
+		hint := n.Attr("class") + " " + n.Attr("id") + " " + n.Attr("role")
+		if unlikelyPattern.MatchString(hint) && !positivePattern.MatchString(hint) {
+			n.remove()
+			return false
+		}
+		return true
+	})
+}
+
+// pickContentNode scores paragraph containers and returns the best one
+func pickContentNode(body *htmlNode) *htmlNode {
+	scores := map[*htmlNode]float64{}
+	var candidates []*htmlNode
+
+	initScore := func(n *htmlNode) {
+		if _, ok := scores[n]; ok {
+			return
+		}
+		score := 0.0
+		switch n.Tag {
+		case "article", "main":
+			score = 10
+		case "div", "section":
+			score = 5
+		case "pre", "td", "blockquote":
+			score = 3
+		case "ol", "ul", "dl", "form", "li":
+			score = -3
+		case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+			score = -5
+		}
+		hint := n.Attr("class") + " " + n.Attr("id")
+		if positivePattern.MatchString(hint) {
+			score += 25
+		}
+		scores[n] = score
+		candidates = append(candidates, n)
+	}
+
+	body.Walk(func(n *htmlNode) bool {
+		if n.Tag != "p" && n.Tag != "pre" && n.Tag != "td" && n.Tag != "blockquote" {
+			return true
+		}
+		text := n.TextContent()
+		if len(text) < 25 {
+			return true
+		}
+		score := 1 + float64(strings.Count(text, ",")) + minFloat(float64(len(text))/100, 3)
+
+		if p := n.Parent; p != nil {
+			initScore(p)
+			scores[p] += score
+			if gp := p.Parent; gp != nil {
+				initScore(gp)
+				scores[gp] += score / 2
+			}
+		}
+		return true
+	})
+
+	var best *htmlNode
+	bestScore := 0.0
+	for _, n := range candidates {
+		score := scores[n] * (1 - linkDensity(n))
+		if best == nil || score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best == nil || best == body.Parent {
+		return body
+	}
+	return best
+}
+
+// linkDensity is the share of a node's text that sits inside links
+func linkDensity(n *htmlNode) float64 {
+	total := len(n.TextContent())
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	for _, a := range n.FindAll("a") {
+		links += len(a.TextContent())
+	}
+	return float64(links) / float64(total)
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// renderReadableText turns a content node into lightly formatted plain
+// text: blank lines between blocks, "#" headings, "-" list items, "> " quotes
+func renderReadableText(n *htmlNode) string {
+	var blocks []string
+	var cur strings.Builder
+
+	flush := func(prefix string) {
+		text := strings.Join(strings.Fields(cur.String()), " ")
+		cur.Reset()
+		if text != "" {
+			blocks = append(blocks, prefix+text)
+		}
+	}
+
+	var walk func(n *htmlNode, prefix string)
+	walk = func(n *htmlNode, prefix string) {
+		if n.IsText() {
+			cur.WriteString(n.Text)
+			return
+		}
+		switch n.Tag {
+		case "br":
+			cur.WriteString(" ")
+			return
+		case "img":
+			if alt := strings.TrimSpace(n.Attr("alt")); alt != "" {
+				cur.WriteString(" [" + alt + "] ")
+			}
+			return
+		case "pre":
+			flush(prefix)
+			if text := strings.Trim(rawText(n), "\n"); strings.TrimSpace(text) != "" {
+				blocks = append(blocks, text)
+			}
+			return
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			flush(prefix)
+			for _, c := range n.Children {
+				walk(c, prefix)
+			}
+			flush(strings.Repeat("#", int(n.Tag[1]-'0')) + " ")
+			return
+		case "li":
+			flush(prefix)
+			for _, c := range n.Children {
+				walk(c, prefix)
+			}
+			flush(prefix + "- ")
+			return
+		case "blockquote":
+			flush(prefix)
+			for _, c := range n.Children {
+				walk(c, prefix+"> ")
+			}
+			flush(prefix + "> ")
+			return
+		}
+
+		block := blockTags[n.Tag] || n.Tag == "li" || n.Tag == "tr" || n.Tag == "figcaption"
+		if block {
+			flush(prefix)
+		}
+		for _, c := range n.Children {
+			walk(c, prefix)
+		}
+		if block {
+			flush(prefix)
+		}
+	}
+	walk(n, "")
+	flush("")
+
+	return strings.Join(blocks, "\n\n")
+}
+
+// rawText returns text without collapsing whitespace, for <pre> blocks
+func rawText(n *htmlNode) string {
+	var sb strings.Builder
+	n.Walk(func(c *htmlNode) bool {
+		if c.IsText() {
+			sb.WriteString(c.Text)
+		} else if c.Tag == "br" {
+			sb.WriteString("\n")
+		}
+		return true
+	})
+	return sb.String()
+}
+
+// allowedHTMLTags survive sanitization; everything else is unwrapped
+var allowedHTMLTags = map[string]bool{
+	"p": true, "br": true, "hr": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "ul": true, "ol": true, "li": true,
+	"blockquote": true, "pre": true, "code": true, "em": true, "strong": true,
+	"b": true, "i": true, "a": true, "img": true, "figure": true,
+	"figcaption": true, "table": true, "thead": true, "tbody": true,
+	"tr": true, "td": true, "th": true, "dl": true, "dt": true, "dd": true,
+}
+
+// renderSanitizedHTML re-serializes n keeping only safe tags, with links
+// and images resolved against base and restricted to http(s)
+func renderSanitizedHTML(n *htmlNode, base *url.URL) string {
+	var sb strings.Builder
+
+	var walk func(n *htmlNode)
+	walk = func(n *htmlNode) {
+		if n.IsText() {
+			sb.WriteString(html.EscapeString(n.Text))
+			return
+		}
+		if !allowedHTMLTags[n.Tag] {
+			for _, c := range n.Children {
+				walk(c)
+			}
+			return
+		}
+
+		if n.Tag == "img" {
+			if src := safeURL(n.Attr("src"), base); src != "" {
+				sb.WriteString(`<img src="` + html.EscapeString(src) + `" alt="` + html.EscapeString(n.Attr("alt")) + `" loading="lazy">`)
+			}
+			return
+		}
+
+		sb.WriteString("<" + n.Tag)
+		if n.Tag == "a" {
+			if href := safeURL(n.Attr("href"), base); href != "" {
+				sb.WriteString(` href="` + html.EscapeString(href) + `" rel="noopener noreferrer" target="_blank"`)
+			}
+		}
+		sb.WriteString(">")
+		if voidTags[n.Tag] {
+			return
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+		sb.WriteString("</" + n.Tag + ">")
+	}
+
+	for _, c := range n.Children {
+		walk(c)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// safeURL resolves ref against base and returns it only if it is http(s)
+func safeURL(ref string, base *url.URL) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurring todos. A rule is stored in its normalized text form (see
+// Recurrence.String) and parsed again whenever the next occurrence is due.
+
+type RecurrenceKind string
+
+const (
+	RecurDaily   RecurrenceKind = "daily"   // every Interval days from the due date
+	RecurWeekly  RecurrenceKind = "weekly"  // on Weekdays, or the due date's weekday
+	RecurMonthly RecurrenceKind = "monthly" // on MonthDay, or the due date's day
+	RecurAfter   RecurrenceKind = "after"   // Interval days after completion
+)
+
+type Recurrence struct {
+	Kind     RecurrenceKind
+	Interval int
+	Weekdays []time.Weekday
+	MonthDay int
+}
+
+var (
+	recurAfterPattern   = regexp.MustCompile(`^(?:every\s+)?(\d+)\s*(?:d|days?)\s+after\s+(?:done|completion|completed|completing)$`)
+	recurDailyPattern   = regexp.MustCompile(`^(?:daily|every\s*day|every\s+(\d+)\s*(?:d|days?))$`)
+	recurMonthlyPattern = regexp.MustCompile(`^(?:monthly|every\s+month)(?:\s+on)?(?:\s+(?:the|day))?\s*(?:(\d{1,2})(?:st|nd|rd|th)?)?$`)
+	recurNthPattern     = regexp.MustCompile(`^every\s+(\d{1,2})(?:st|nd|rd|th)$`)
+	recurWeeklyPattern  = regexp.MustCompile(`^(?:weekly|every\s+week)(?:\s+on\s+(.+))?$`)
+)
+
+var weekdayNames = map[string][]time.Weekday{
+	"sun": {time.Sunday}, "sunday": {time.Sunday},
+	"mon": {time.Monday}, "monday": {time.Monday},
+	"tue": {time.Tuesday}, "tues": {time.Tuesday}, "tuesday": {time.Tuesday},
+	"wed": {time.Wednesday}, "weds": {time.Wednesday}, "wednesday": {time.Wednesday},
+	"thu": {time.Thursday}, "thur": {time.Thursday}, "thurs": {time.Thursday}, "thursday": {time.Thursday},
+	"fri": {time.Friday}, "friday": {time.Friday},
+	"sat": {time.Saturday}, "saturday": {time.Saturday},
+	"weekday":  {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekend":  {time.Saturday, time.Sunday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// ParseRecurrence parses rules like "daily", "every 2 days", "every mon,wed",
+// "weekly", "monthly on 15", "every 15th" or "every 3 days after done".
+// An empty rule returns nil.
+func ParseRecurrence(s string) (*Recurrence, error) {
+	s = strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	if s == "" || s == "none" || s == "never" {
+		return nil, nil
+	}
+
+	if m := recurAfterPattern.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if n < 1 {
+			return nil, fmt.Errorf("invalid recurrence %q: interval must be at least 1", s)
+		}
+		return &Recurrence{Kind: RecurAfter, Interval: n}, nil
+	}
+	if m := recurDailyPattern.FindStringSubmatch(s); m != nil {
+		n := 1
+		if m[1] != "" {
+			n, _ = strconv.Atoi(m[1])
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("invalid recurrence %q: interval must be at least 1", s)
+		}
+		return &Recurrence{Kind: RecurDaily, Interval: n}, nil
+	}
+
+	monthly := recurMonthlyPattern.FindStringSubmatch(s)
+	if monthly == nil {
+		monthly = recurNthPattern.FindStringSubmatch(s)
+	}
+	if monthly != nil {
+		day := 0
+		if monthly[1] != "" {
+			day, _ = strconv.Atoi(monthly[1])
+			if day < 1 || day > 31 {
+				return nil, fmt.Errorf("invalid recurrence %q: day of month must be 1-31", s)
+			}
+		}
+		return &Recurrence{Kind: RecurMonthly, Interval: 1, MonthDay: day}, nil
+	}
+
+	days := ""
+	if m := recurWeeklyPattern.FindStringSubmatch(s); m != nil {
+		days = m[1]
+	} else if strings.HasPrefix(s, "every ") {
+		days = strings.TrimPrefix(s, "every ")
+	} else {
+		return nil, fmt.Errorf("unrecognized recurrence %q (try daily, every mon,wed, monthly on 15, every 3 days after done)", s)
+	}
+
+	r := &Recurrence{Kind: RecurWeekly, Interval: 1}
+	seen := map[time.Weekday]bool{}
+	for _, word := range strings.FieldsFunc(days, func(c rune) bool { return c == ',' || c == ' ' || c == '/' }) {
+		if word == "and" || word == "on" {
+			continue
+		}
+		wds, ok := weekdayNames[word]
+		if !ok {
+			return nil, fmt.Errorf("unrecognized recurrence %q: unknown day %q", s, word)
+		}
+		for _, wd := range wds {
+			seen[wd] = true
+		}
+	}
+	// Keep Monday-first order so String() is stable
+	for _, wd := range []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday} {
+		if seen[wd] {
+			r.Weekdays = append(r.Weekdays, wd)
+		}
+	}
+	return r, nil
+}
+
+// String returns the normalized rule, which ParseRecurrence accepts
+func (r *Recurrence) String() string {
+	switch r.Kind {
+	case RecurDaily:
+		if r.Interval == 1 {
+			return "daily"
+		}
+		return fmt.Sprintf("every %d days", r.Interval)
+	case RecurWeekly:
+		if len(r.Weekdays) == 0 {
+			return "weekly"
+		}
+		names := make([]string, len(r.Weekdays))
+		for i, wd := range r.Weekdays {
+			names[i] = strings.ToLower(wd.String()[:3])
+		}
+		return "every " + strings.Join(names, ",")
+	case RecurMonthly:
+		if r.MonthDay == 0 {
+			return "monthly"
+		}
+		return fmt.Sprintf("monthly on day %d", r.MonthDay)
+	case RecurAfter:
+		if r.Interval == 1 {
+			return "every 1 day after done"
+		}
+		return fmt.Sprintf("every %d days after done", r.Interval)
+	}
+	return ""
+}
+
+// NormalizeRecurrence validates a rule and returns its normalized form
+func NormalizeRecurrence(s string) (string, error) {
+	r, err := ParseRecurrence(s)
+	if err != nil || r == nil {
+		return "", err
+	}
+	return r.String(), nil
+}
+
+// FirstDue is the first occurrence on or after now, used as the due date
+// when a recurring todo is added without one. "After done" rules have no
+// due date until they are completed.
+func (r *Recurrence) FirstDue(now time.Time) string {
+	today := startOfDay(now)
+	switch {
+	case r.Kind == RecurAfter:
+		return ""
+	case r.Kind == RecurDaily, r.Kind == RecurWeekly && len(r.Weekdays) == 0, r.Kind == RecurMonthly && r.MonthDay == 0:
+		// Anchored on the first due date, so that is today
+		return today.Format("2006-01-02")
+	}
+	yesterday := today.AddDate(0, 0, -1)
+	return r.next(yesterday, yesterday).Format("2006-01-02")
+}
+
+// NextDue returns the due date of the occurrence after one with the given
+// due date that was completed at doneAt. Scheduled rules skip occurrences
+// that are already in the past so an overdue chore doesn't pile up.
+func (r *Recurrence) NextDue(due string, doneAt time.Time) string {
+	base, layout, ok := parseDueDate(due)
+	if !ok {
+		base, layout = startOfDay(doneAt), "2006-01-02"
+	}
+	if r.Kind == RecurAfter {
+		done := startOfDay(doneAt)
+		next := time.Date(done.Year(), done.Month(), done.Day()+r.Interval,
+			base.Hour(), base.Minute(), base.Second(), 0, base.Location())
+		return next.Format(layout)
+	}
+	return r.next(base, startOfDay(doneAt)).Format(layout)
+}
+
+// anchored pins a plain monthly rule to the day of due, so that an
+// occurrence clamped to a short month doesn't move the ones after it: due
+// on Jan 31, Feb 28 is followed by Mar 31, not Mar 28
+func (r *Recurrence) anchored(due string) *Recurrence {
+	if r.Kind != RecurMonthly || r.MonthDay != 0 {
+		return r
+	}
+	t, _, ok := parseDueDate(due)
+	if !ok {
+		return r
+	}
+	pinned := *r
+	pinned.MonthDay = t.Day()
+	return &pinned
+}
+
+// next finds the first occurrence after base whose date is after notBefore
+func (r *Recurrence) next(base, notBefore time.Time) time.Time {
+	t := base
+	// Each step moves at least a day, so this bounds the search to a few
+	// years even for a long-overdue todo
+	for i := 0; i < 5000; i++ {
+		t = r.step(t)
+		if startOfDay(t).After(notBefore) {
+			return t
+		}
+	}
+	return t
+}
+
+// step advances t to the rule's next occurrence
+func (r *Recurrence) step(t time.Time) time.Time {
+	switch r.Kind {
+	case RecurWeekly:
+		if len(r.Weekdays) == 0 {
+			return t.AddDate(0, 0, 7)
+		}
+		for d := 1; d <= 7; d++ {
+			c := t.AddDate(0, 0, d)
+			for _, wd := range r.Weekdays {
+				if c.Weekday() == wd {
+					return c
+				}
+			}
+		}
+	case RecurMonthly:
+		day := r.MonthDay
+		if day == 0 {
+			day = t.Day()
+		}
+		// The occurrence in t's month if it's still ahead, else next month's
+		if c := monthDay(t.Year(), t.Month(), day, t); c.After(t) {
+			return c
+		}
+		return monthDay(t.Year(), t.Month()+1, day, t)
+	}
+	return t.AddDate(0, 0, r.Interval)
+}
+
+// monthDay returns day of the given month at clock's time, clamped to the
+// month's last day (monthly on the 31st falls on the 30th in April)
+func monthDay(year int, month time.Month, day int, clock time.Time) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, clock.Location()).Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(year, month, day, clock.Hour(), clock.Minute(), clock.Second(), 0, clock.Location())
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		in, want string // want "" with wantErr false means no rule
+		wantErr  bool
+	}{
+		{"", "", false},
+		{"none", "", false},
+		{"daily", "daily", false},
+		{"Every  Day", "daily", false},
+		{"every 2 days", "every 2 days", false},
+		{"every 1d", "daily", false},
+		{"weekly", "weekly", false},
+		{"every mon, wed", "every mon,wed", false},
+		{"weekly on sunday and sat", "every sat,sun", false},
+		{"every weekday", "every mon,tue,wed,thu,fri", false},
+		{"monthly", "monthly", false},
+		{"monthly on the 15th", "monthly on day 15", false},
+		{"every 31st", "monthly on day 31", false},
+		{"every 3 days after done", "every 3 days after done", false},
+		{"1 day after completion", "every 1 day after done", false},
+
+		{"every 0 days", "", true},
+		{"monthly on 32", "", true},
+		{"every blursday", "", true},
+		{"sometimes", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeRecurrence(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeRecurrence(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeRecurrence(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRecurrenceNextDue(t *testing.T) {
+	// Friday 16 October 2026, mid-morning
+	doneAt := time.Date(2026, 10, 16, 10, 30, 0, 0, time.Local)
+	tests := []struct {
+		rule, due, want string
+	}{
+		{"daily", "2026-10-16", "2026-10-17"},
+		{"daily", "", "2026-10-17"},
+		{"every 2 days", "2026-10-10", "2026-10-18"}, // overdue: past occurrences are skipped
+		{"every mon,wed", "2026-10-16", "2026-10-19"},
+		{"weekly", "2026-10-14", "2026-10-21"},
+		{"monthly", "2026-09-30", "2026-10-30"},
+		{"monthly on 31", "2026-10-31", "2026-11-30"}, // clamped to the month's last day
+		{"every 3 days after done", "2026-10-01", "2026-10-19"},
+	}
+	for _, tt := range tests {
+		r, err := ParseRecurrence(tt.rule)
+		if err != nil {
+			t.Fatalf("ParseRecurrence(%q): %v", tt.rule, err)
+		}
+		if got := r.NextDue(tt.due, doneAt); got != tt.want {
+			t.Errorf("%q from %q: NextDue = %q, want %q", tt.rule, tt.due, got, tt.want)
+		}
+	}
+}
+
+func TestMonthlyKeepsDayAfterShortMonth(t *testing.T) {
+	r, _ := ParseRecurrence("monthly")
+	due := "2026-01-31"
+	var got []string
+	for i := 0; i < 4; i++ {
+		// As spawnNextOccurrence does, completing each occurrence on time
+		r = r.anchored(due)
+		doneAt, _, _ := parseDueDate(due)
+		due = r.NextDue(due, doneAt)
+		got = append(got, due)
+	}
+	want := []string{"2026-02-28", "2026-03-31", "2026-04-30", "2026-05-31"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("monthly from 2026-01-31: got %v, want %v", got, want)
+	}
+	if s := r.String(); s != "monthly on day 31" {
+		t.Errorf("anchored rule = %q, want %q", s, "monthly on day 31")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Short-link resolution. Shortened links are followed to their destination
+// before detection so a t.co link to a tweet is saved as a tweet and
+// duplicate detection sees the real URL.
+
+const (
+	maxRedirectHops = 10
+	resolveTimeout  = 8 * time.Second
+	maxRefreshSniff = 64 * 1024 // bytes of a 200 response searched for <meta refresh>
+)
+
+// shortLinkHosts only ever redirect somewhere else
+var shortLinkHosts = []string{
+	"t.co", "bit.ly", "bitly.com", "lnkd.in", "vm.tiktok.com", "vt.tiktok.com",
+	"tinyurl.com", "goo.gl", "ow.ly", "buff.ly", "dlvr.it", "is.gd", "tiny.cc",
+	"rb.gy", "shorturl.at", "amzn.to", "fb.me", "trib.al", "redd.it",
+}
+
+// IsShortLink reports whether a URL points at a known link shortener
+func IsShortLink(urlStr string) bool {
+	u, err := url.Parse(strings.TrimSpace(urlStr))
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return hostMatches(u.Hostname(), shortLinkHosts...)
+}
+
+// ResolveShortLink follows a short link to its final destination. Other
+// URLs are returned unchanged without touching the network.
+func ResolveShortLink(urlStr string) (string, error) {
+	urlStr = strings.TrimSpace(urlStr)
+	if !IsShortLink(urlStr) {
+		return urlStr, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	return resolveRedirects(ctx, urlStr)
+}
+
+// resolveRedirects follows up to maxRedirectHops redirects one hop at a
+// time, returning the last URL that didn't redirect
+func resolveRedirects(ctx context.Context, urlStr string) (string, error) {
+	client := &http.Client{
+		Timeout: resolveTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	current := urlStr
+	for hop := 0; hop < maxRedirectHops; hop++ {
+		next, err := nextHop(ctx, client, current)
+		if err != nil {
+			// Destinations often refuse bots; having left the shortener
+			// is good enough
+			if current != urlStr && !IsShortLink(current) {
+				return current, nil
+			}
+			return current, err
+		}
+		if next == "" {
+			return current, nil
+		}
+		current = next
+	}
+	return current, fmt.Errorf("more than %d redirects from %s", maxRedirectHops, urlStr)
+}
+
+// nextHop returns where urlStr redirects to, or "" if it doesn't. HEAD is
+// tried first; GET is used when the server rejects HEAD or when a
+// shortener answers 200, since some (t.co) redirect with <meta refresh>.
+func nextHop(ctx context.Context, client *http.Client, urlStr string) (string, error) {
+	resp, err := resolveRequest(ctx, client, "HEAD", urlStr)
+	if err == nil {
+		resp.Body.Close()
+		if loc := redirectLocation(resp); loc != "" {
+			return loc, nil
+		}
+		if resp.StatusCode < 400 && !IsShortLink(urlStr) {
+			return "", nil
+		}
+	}
+
+	resp, err = resolveRequest(ctx, client, "GET", urlStr)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if loc := redirectLocation(resp); loc != "" {
+		return loc, nil
+	}
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("resolving %s: %s", urlStr, resp.Status)
+	}
+	if strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxRefreshSniff))
+		return metaRefreshURL(string(body), resp.Request.URL), nil
+	}
+	return "", nil
+}
+
+func resolveRequest(ctx context.Context, client *http.Client, method, urlStr string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Vault/1.0)")
+	return client.Do(req)
+}
+
+// redirectLocation returns the absolute Location of a 3xx response
+func redirectLocation(resp *http.Response) string {
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return ""
+	}
+	loc, err := resp.Location()
+	if err != nil {
+		return ""
+	}
+	return loc.String()
+}
+
+// metaRefreshURL finds the target of <meta http-equiv="refresh"
+// content="0; url=..."> in a page
+func metaRefreshURL(src string, base *url.URL) string {
+	z := newHTMLTokenizer(src)
+	for {
+		tok, ok := z.Next()
+		if !ok {
+			return ""
+		}
+		if tok.Type == endTagToken && tok.Tag == "head" {
+			return ""
+		}
+		if tok.Type != startTagToken || tok.Tag != "meta" || !strings.EqualFold(tok.Attrs["http-equiv"], "refresh") {
+			continue
+		}
+		content := tok.Attrs["content"]
+		i := strings.Index(strings.ToLower(content), "url=")
+		if i < 0 {
+			continue
+		}
+		target := strings.Trim(strings.TrimSpace(content[i+4:]), `'"`)
+		return safeURL(target, base)
+	}
+}
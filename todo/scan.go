@@ -0,0 +1,758 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// `vault scan <dir>` harvests TODO/FIXME/HACK comments from a source tree
+// into todos. Each comment is identified by a fingerprint of its path in the
+// repository, kind and text; its line is kept in the scan state, not in the
+// todo, so moving code around neither changes nor rewrites the todo.
+// Identical comments in one file share a fingerprint and are told apart by
+// their order and lines. A comment that is gone on the next scan completes
+// its todo, and one that comes back reopens it.
+
+const codeCommentSchema = `
+	CREATE TABLE code_comments (
+		fingerprint TEXT PRIMARY KEY,
+		root TEXT NOT NULL,
+		file TEXT NOT NULL,
+		line INTEGER NOT NULL,
+		todo_id INTEGER NOT NULL,
+		scanned_at TEXT NOT NULL
+	);
+	CREATE INDEX idx_code_comments_root ON code_comments(root);
+	`
+
+// codeCommentKeySchema keys the scan state by root, so two checkouts with
+// the same comment don't share a row, and stores the fingerprint shared by
+// identical comments separately from the row's key. Rows from before have
+// no base and are matched by file and line once.
+const codeCommentKeySchema = `
+	CREATE TABLE code_comments_new (
+		root TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		base TEXT NOT NULL DEFAULT '',
+		file TEXT NOT NULL,
+		line INTEGER NOT NULL,
+		todo_id INTEGER NOT NULL,
+		gone INTEGER NOT NULL DEFAULT 0,
+		scanned_at TEXT NOT NULL,
+		PRIMARY KEY (root, fingerprint)
+	);
+	INSERT INTO code_comments_new (root, fingerprint, file, line, todo_id, scanned_at)
+		SELECT root, fingerprint, file, line, todo_id, scanned_at FROM code_comments;
+	DROP TABLE code_comments;
+	ALTER TABLE code_comments_new RENAME TO code_comments;
+	`
+
+// codeCommentKeyword is the keyword, an optional (owner) and the text
+const codeCommentKeyword = `(TODO|FIXME|HACK)(?:\(([^)]*)\))?(?::|\s|$)\s*(.*)$`
+
+// codeCommentPattern finds a comment marker followed by the keyword. The
+// marker must not follow a word character or a colon, so URLs and
+// "#include" don't count.
+var codeCommentPattern = regexp.MustCompile(`(?:^|[^\w:/])(?://+|#+|/\*+|<!--|--|;+)\s*` + codeCommentKeyword)
+
+// blockCommentLinePattern finds the keyword on a " * ..." continuation line.
+// It only applies inside a /* */ comment, where a Markdown bullet can't be.
+var blockCommentLinePattern = regexp.MustCompile(`^\s*\*+\s*` + codeCommentKeyword)
+
+// codeCommentPriority maps a comment kind to the priority of its todo
+var codeCommentPriority = map[string]Priority{
+	"FIXME": PriorityHigh,
+	"TODO":  PriorityMedium,
+	"HACK":  PriorityLow,
+}
+
+const (
+	scanMaxFileSize = 1 << 20 // larger files are assumed to be generated
+	scanSniffSize   = 8000    // bytes checked for NUL to skip binaries
+)
+
+// codeComment is one TODO/FIXME/HACK found by a scan
+type codeComment struct {
+	File        string // slash-separated, relative to the scan root
+	Line        int
+	Kind        string
+	Owner       string
+	Text        string
+	Fingerprint string // shared by identical comments in the same file
+}
+
+// task is the todo text for the comment. It names the file but not the
+// line, which changes whenever code above it does.
+func (c codeComment) task() string {
+	where := c.File
+	if c.Owner != "" {
+		where += ", @" + c.Owner
+	}
+	return fmt.Sprintf("%s (%s)", c.Text, where)
+}
+
+// commentFingerprint identifies a comment by its path relative to the scan
+// root, its kind and its text with case and spacing normalized
+func commentFingerprint(file, kind, text string) string {
+	text = strings.Join(strings.Fields(strings.ToLower(text)), " ")
+	sum := sha1.Sum([]byte(file + "\x00" + kind + "\x00" + text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ScanSummary counts what a scan changed
+type ScanSummary struct {
+	Root    string
+	Found   int
+	Added   []*Todo
+	Updated int
+	Closed  []*Todo
+}
+
+// scanRoot is the directory fingerprints and paths are relative to: the
+// enclosing git repository, so scanning a subdirectory and the whole repo
+// agree, or the directory itself outside a repository
+func scanRoot(dir string) (root string, isGit bool) {
+	for d := dir; ; {
+		if fileExists(filepath.Join(d, ".git")) {
+			return d, true
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir, false
+		}
+		d = parent
+	}
+}
+
+// ScanCodeComments walks dir, skipping whatever the .gitignore files along
+// the way exclude, and returns the comments found with paths relative to
+// root. files is the number of text files read.
+func ScanCodeComments(root, dir string) (comments []codeComment, files int, err error) {
+	ignore := gitignore{}
+	// .gitignore files between the root and dir apply too
+	if rel, _ := filepath.Rel(root, dir); rel != "." {
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		ignore.load(root, "")
+		for i := 1; i < len(parts); i++ {
+			ignore.load(root, path.Join(parts[:i]...))
+		}
+	}
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if d.Name() == ".git" || p != dir && ignore.ignored(rel, true) {
+				return filepath.SkipDir
+			}
+			if rel == "." {
+				rel = ""
+			}
+			ignore.load(root, rel)
+			return nil
+		}
+		if !d.Type().IsRegular() || ignore.ignored(rel, false) {
+			return nil
+		}
+		found, ok, err := scanFile(p, rel)
+		if err != nil || !ok {
+			return err
+		}
+		files++
+		comments = append(comments, found...)
+		return nil
+	})
+	return comments, files, err
+}
+
+// scanFile extracts the comments from one file. ok is false for files that
+// look binary or generated.
+func scanFile(p, rel string) (comments []codeComment, ok bool, err error) {
+	info, err := os.Stat(p)
+	if err != nil || info.Size() > scanMaxFileSize {
+		return nil, false, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false, err
+	}
+	if bytes.IndexByte(data[:min(len(data), scanSniffSize)], 0) >= 0 {
+		return nil, false, nil
+	}
+
+	comments, err = scanText(data, rel)
+	return comments, true, err
+}
+
+// scanText extracts the comments from the contents of the file rel
+func scanText(data []byte, rel string) ([]codeComment, error) {
+	var comments []codeComment
+	inBlock := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), scanMaxFileSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		m := codeCommentPattern.FindStringSubmatch(text)
+		if m == nil && inBlock {
+			m = blockCommentLinePattern.FindStringSubmatch(text)
+		}
+		inBlock = blockCommentOpen(text, inBlock)
+		if m == nil {
+			continue
+		}
+		body := strings.TrimSpace(m[3])
+		for _, end := range []string{"*/", "-->"} {
+			body = strings.TrimSpace(strings.TrimSuffix(body, end))
+		}
+		if body == "" {
+			continue
+		}
+		comments = append(comments, codeComment{
+			File:        rel,
+			Line:        line,
+			Kind:        m[1],
+			Owner:       strings.TrimSpace(m[2]),
+			Text:        body,
+			Fingerprint: commentFingerprint(rel, m[1], body),
+		})
+	}
+	return comments, scanner.Err()
+}
+
+// blockCommentOpen reports whether a /* */ comment is still open after
+// line. It ignores string literals, which is close enough for deciding
+// whether a " * TODO" line is part of one.
+func blockCommentOpen(line string, open bool) bool {
+	for {
+		if open {
+			i := strings.Index(line, "*/")
+			if i < 0 {
+				return true
+			}
+			line, open = line[i+2:], false
+		} else {
+			i := strings.Index(line, "/*")
+			if i < 0 {
+				return false
+			}
+			line, open = line[i+2:], true
+		}
+	}
+}
+
+// codeCommentRecord is the stored state of a harvested comment
+type codeCommentRecord struct {
+	key    string // the fingerprint, suffixed for the second and later identical comments
+	base   string // the fingerprint identical comments share, "" for rows from older scans
+	file   string
+	line   int
+	todoID int64
+	gone   bool // the comment was removed and its todo completed
+}
+
+// loadCodeComments reads the scan state of root
+func loadCodeComments(q sqlRunner, root string) ([]codeCommentRecord, error) {
+	rows, err := q.Query(`SELECT fingerprint, base, file, line, todo_id, gone FROM code_comments WHERE root = ? ORDER BY line`, root)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []codeCommentRecord
+	for rows.Next() {
+		var r codeCommentRecord
+		if err := rows.Scan(&r.key, &r.base, &r.file, &r.line, &r.todoID, &r.gone); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// SyncCodeComments brings the todos for root in line with the comments a
+// scan of prefix (a directory relative to root, "" for all of it) found.
+// New comments become todos, reworded ones update theirs, comments no
+// longer there complete theirs and comments that come back reopen theirs.
+// A todo deleted by hand stays deleted while its comment is unchanged.
+// Either all of it happens or, on an error, none of it.
+func SyncCodeComments(root, prefix, context string, comments []codeComment) (*ScanSummary, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	summary, err := syncCodeComments(tx, root, prefix, context, comments)
+	if err != nil {
+		return nil, err
+	}
+	return summary, tx.Commit()
+}
+
+func syncCodeComments(q sqlRunner, root, prefix, context string, comments []codeComment) (*ScanSummary, error) {
+	records, err := loadCodeComments(q, root)
+	if err == nil && len(records) == 0 {
+		records, err = adoptMovedRoot(q, root, context, comments)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ScanSummary{Root: root, Found: len(comments)}
+	now := time.Now().Format(time.RFC3339)
+	taken := map[string]bool{}
+	for _, r := range records {
+		taken[r.key] = true
+	}
+	matched := matchCodeComments(comments, records)
+	kept := map[string]bool{}
+	for i, c := range comments {
+		var rec codeCommentRecord
+		if j := matched[i]; j >= 0 {
+			rec = records[j]
+			kept[rec.key] = true
+			if err := refreshScannedTodo(q, c, rec, summary); err != nil {
+				return nil, err
+			}
+			if rec.base == "" {
+				// A row from before fingerprints were per repository
+				if _, err := q.Exec(`DELETE FROM code_comments WHERE root = ? AND fingerprint = ?`, root, rec.key); err != nil {
+					return nil, err
+				}
+				rec.key = unusedKey(c.Fingerprint, taken)
+			}
+		} else {
+			todo, err := createTodo(q, &Todo{
+				Task:     c.task(),
+				Priority: codeCommentPriority[c.Kind],
+				Category: strings.ToLower(c.Kind),
+				Context:  context,
+			})
+			if err != nil {
+				return nil, err
+			}
+			rec.key, rec.todoID = unusedKey(c.Fingerprint, taken), todo.ID
+			summary.Added = append(summary.Added, todo)
+		}
+		_, err := q.Exec(`INSERT OR REPLACE INTO code_comments (root, fingerprint, base, file, line, todo_id, gone, scanned_at) VALUES (?, ?, ?, ?, ?, ?, 0, ?)`,
+			root, rec.key, c.Fingerprint, c.File, c.Line, rec.todoID, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, rec := range records {
+		if kept[rec.key] || rec.gone || prefix != "" && rec.file != prefix && !strings.HasPrefix(rec.file, prefix+"/") {
+			continue
+		}
+		if todo, err := getTodo(q, rec.todoID); err == nil && !todo.Done {
+			// The comment is gone, so the work is done whatever it waited on
+			if _, err := markTodoDone(q, todo.ID, true, true); err != nil {
+				return nil, err
+			}
+			summary.Closed = append(summary.Closed, todo)
+		}
+		var err error
+		if rec.base == "" {
+			_, err = q.Exec(`DELETE FROM code_comments WHERE root = ? AND fingerprint = ?`, root, rec.key)
+		} else {
+			// Keep the record so the comment reopens its todo if it comes back
+			_, err = q.Exec(`UPDATE code_comments SET gone = 1, scanned_at = ? WHERE root = ? AND fingerprint = ?`, now, root, rec.key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(summary.Closed, func(i, j int) bool { return summary.Closed[i].ID < summary.Closed[j].ID })
+	return summary, nil
+}
+
+// refreshScannedTodo brings the todo of a known comment up to date: a
+// reworded comment renames it and one that came back reopens it
+func refreshScannedTodo(q sqlRunner, c codeComment, rec codeCommentRecord, summary *ScanSummary) error {
+	todo, err := getTodo(q, rec.todoID)
+	if err != nil {
+		return nil // deleted by hand
+	}
+	reopen := rec.gone && todo.Done
+	if todo.Task == c.task() && !reopen {
+		return nil
+	}
+	todo.Task = c.task()
+	if reopen {
+		todo.Done = false
+	}
+	if err := updateTodo(q, todo, false); err != nil {
+		return err
+	}
+	if reopen {
+		summary.Added = append(summary.Added, todo)
+	} else {
+		summary.Updated++
+	}
+	return nil
+}
+
+// matchCodeComments pairs the comments found with the stored records, and
+// returns the index of each comment's record or -1 for a new comment.
+// Identical comments still there are paired by line in file order, so
+// removing one of them completes that one's todo and not the last's. The
+// ones left over take the records of identical comments removed before,
+// and rows from older scans are matched by file and line.
+func matchCodeComments(comments []codeComment, records []codeCommentRecord) []int {
+	matched := make([]int, len(comments))
+	found := map[string][]int{}
+	for i, c := range comments {
+		matched[i] = -1
+		found[c.Fingerprint] = append(found[c.Fingerprint], i)
+	}
+	live, gone := map[string][]int{}, map[string][]int{}
+	legacy := map[string]int{}
+	for j, r := range records {
+		switch {
+		case r.base == "":
+			legacy[fmt.Sprintf("%s:%d", r.file, r.line)] = j
+		case r.gone:
+			gone[r.base] = append(gone[r.base], j)
+		default:
+			live[r.base] = append(live[r.base], j)
+		}
+	}
+
+	for base, idx := range found {
+		sort.Slice(idx, func(a, b int) bool { return comments[idx[a]].Line < comments[idx[b]].Line })
+		recs := live[base]
+		lines := make([]int, len(idx))
+		for k, i := range idx {
+			lines[k] = comments[i].Line
+		}
+		recLines := make([]int, len(recs))
+		for k, j := range recs {
+			recLines[k] = records[j].line
+		}
+		pending := gone[base]
+		for k, r := range alignLines(lines, recLines) {
+			switch {
+			case r >= 0:
+				matched[idx[k]] = recs[r]
+			case len(pending) > 0:
+				matched[idx[k]], pending = pending[0], pending[1:]
+			}
+		}
+	}
+
+	for i, c := range comments {
+		if j, ok := legacy[fmt.Sprintf("%s:%d", c.File, c.Line)]; ok && matched[i] < 0 {
+			matched[i] = j
+			delete(legacy, fmt.Sprintf("%s:%d", c.File, c.Line))
+		}
+	}
+	return matched
+}
+
+// alignLines pairs two ascending lists of line numbers without crossing,
+// pairing as many as the shorter list has at the least total distance. It
+// returns the index in b paired with each entry of a, or -1.
+func alignLines(a, b []int) []int {
+	n, m := len(a), len(b)
+	const unreachable = math.MaxInt / 2
+	cost := make([][]int, n+1)
+	for i := range cost {
+		cost[i] = make([]int, m+1)
+		for j := range cost[i] {
+			cost[i][j] = unreachable
+		}
+	}
+	// Only the longer list may have entries left unpaired
+	cost[0][0] = 0
+	for i := 0; i <= n; i++ {
+		for j := 0; j <= m; j++ {
+			if i > 0 && j > 0 {
+				cost[i][j] = min(cost[i][j], cost[i-1][j-1]+abs(a[i-1]-b[j-1]))
+			}
+			if i > 0 && n > m {
+				cost[i][j] = min(cost[i][j], cost[i-1][j])
+			}
+			if j > 0 && m > n {
+				cost[i][j] = min(cost[i][j], cost[i][j-1])
+			}
+		}
+	}
+
+	pairs := make([]int, n)
+	for i, j := n, m; i > 0; {
+		switch {
+		case j > 0 && cost[i][j] == cost[i-1][j-1]+abs(a[i-1]-b[j-1]):
+			pairs[i-1] = j - 1
+			i, j = i-1, j-1
+		case n > m && cost[i][j] == cost[i-1][j]:
+			pairs[i-1] = -1
+			i--
+		default:
+			j--
+		}
+	}
+	return pairs
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// unusedKey returns the key for a new record of a comment: its fingerprint,
+// or for a second identical comment the fingerprint with a number
+func unusedKey(fingerprint string, taken map[string]bool) string {
+	key := fingerprint
+	for n := 2; taken[key]; n++ {
+		key = fmt.Sprintf("%s-%d", fingerprint, n)
+	}
+	taken[key] = true
+	return key
+}
+
+// adoptMovedRoot hands root the scan state of a directory that no longer
+// exists, when root has none of its own, so moving or re-cloning a
+// repository keeps its todos instead of adding them again. Of several such
+// directories the one sharing the most comments wins. Todos scoped to the
+// old repository move to context.
+func adoptMovedRoot(q sqlRunner, root, context string, comments []codeComment) ([]codeCommentRecord, error) {
+	found := map[string]bool{}
+	for _, c := range comments {
+		found[c.Fingerprint] = true
+	}
+	rows, err := q.Query(`SELECT root, base FROM code_comments WHERE root != ? AND base != ''`, root)
+	if err != nil {
+		return nil, err
+	}
+	shared := map[string]int{}
+	for rows.Next() {
+		var other, base string
+		if err := rows.Scan(&other, &base); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if found[base] {
+			shared[other]++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	old := ""
+	for other, n := range shared {
+		if !fileExists(other) && (n > shared[old] || n == shared[old] && other < old) {
+			old = other
+		}
+	}
+	if old == "" {
+		return nil, nil
+	}
+
+	if _, err := q.Exec(`UPDATE todos SET context = ? WHERE context = ? AND id IN (SELECT todo_id FROM code_comments WHERE root = ?)`,
+		context, "git:"+old, old); err != nil {
+		return nil, err
+	}
+	if _, err := q.Exec(`UPDATE code_comments SET root = ? WHERE root = ?`, root, old); err != nil {
+		return nil, err
+	}
+	return loadCodeComments(q, root)
+}
+
+// ignoreRule is one pattern from a .gitignore
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// gitignore holds the rules read so far, by the directory (relative to the
+// scan root, "" for the root) whose .gitignore they came from
+type gitignore map[string][]ignoreRule
+
+// load reads dir/.gitignore, if there is one
+func (g gitignore) load(root, dir string) {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(dir), ".gitignore"))
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rule, ok := parseIgnoreRule(line); ok {
+			g[dir] = append(g[dir], rule)
+		}
+	}
+}
+
+// ignored applies the rules of every .gitignore above rel, outermost
+// first; as in git, the last matching pattern decides
+func (g gitignore) ignored(rel string, isDir bool) bool {
+	ignored := false
+	dir := ""
+	for {
+		sub := strings.TrimPrefix(rel, dir)
+		sub = strings.TrimPrefix(sub, "/")
+		for _, r := range g[dir] {
+			if (!r.dirOnly || isDir) && r.re.MatchString(sub) {
+				ignored = !r.negate
+			}
+		}
+		i := strings.Index(sub, "/")
+		if i < 0 {
+			return ignored
+		}
+		dir = path.Join(dir, sub[:i])
+	}
+}
+
+// parseIgnoreRule compiles a .gitignore line. A pattern with a slash
+// before its end is anchored to the .gitignore's directory; one without
+// matches a name at any depth.
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, `\`)
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case strings.HasPrefix(line[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(line[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			if end := strings.Index(line[i:], "]"); end > 0 {
+				class := line[i+1 : i+end]
+				if strings.HasPrefix(class, "!") {
+					class = "^" + class[1:]
+				}
+				re.WriteString("[" + class + "]")
+				i += end
+			} else {
+				re.WriteString(`\[`)
+			}
+		case c == '\\' && i+1 < len(line):
+			i++
+			re.WriteString(regexp.QuoteMeta(line[i : i+1]))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = compiled
+	return rule, true
+}
+
+func handleScan(a *cmdArgs) {
+	arg := a.Arg(0)
+	if arg == "" {
+		a.Usage()
+		return
+	}
+	dir, err := filepath.Abs(expandHome(arg))
+	if err == nil {
+		dir, err = filepath.EvalSymlinks(dir)
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		fmt.Printf("Error: %s is not a directory\n", arg)
+		return
+	}
+
+	root, isGit := scanRoot(dir)
+	comments, files, err := ScanCodeComments(root, dir)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if a.Has("--dry-run") {
+		for _, c := range comments {
+			fmt.Printf("%s:%d  %s  %s\n", c.File, c.Line, c.Kind, c.Text)
+		}
+		fmt.Printf("%d comment(s) in %d file(s)\n", len(comments), files)
+		return
+	}
+
+	context := scanContext(root, isGit)
+	prefix, _ := filepath.Rel(root, dir)
+	if prefix = filepath.ToSlash(prefix); prefix == "." {
+		prefix = ""
+	}
+	summary, err := SyncCodeComments(root, prefix, context, comments)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	for _, t := range summary.Added {
+		fmt.Printf("  + [%d] %s\n", t.ID, t.Task)
+	}
+	for _, t := range summary.Closed {
+		fmt.Printf("  ✓ [%d] %s\n", t.ID, t.Task)
+	}
+	fmt.Printf("Scanned %d file(s) in %s: %d comment(s)\n", files, arg, summary.Found)
+	fmt.Printf("  %d added, %d updated, %d done (comment removed)\n", len(summary.Added), summary.Updated, len(summary.Closed))
+	if context != "" {
+		fmt.Println("  " + contextNote(context))
+	}
+}
+
+// scanContext is the context scanned todos get: the one the todo views run
+// in (a tmux session or $VAULT_CONTEXT), unless that would be a git
+// repository, in which case it's the scanned one rather than the working
+// directory's
+func scanContext(root string, isGit bool) string {
+	context := currentContext()
+	if isGit && (context == "" || strings.HasPrefix(context, "git:")) {
+		return "git:" + root
+	}
+	return context
+}
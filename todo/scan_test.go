@@ -0,0 +1,222 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGitignore(t *testing.T) {
+	g := gitignore{}
+	for dir, rules := range map[string][]string{
+		"":    {"# comment", "*.log", "!keep.log", "/build", "node_modules/", "docs/**/*.tmp", `\#hash`, "cache?"},
+		"web": {"dist", "/local.js"},
+	} {
+		for _, line := range rules {
+			if rule, ok := parseIgnoreRule(line); ok {
+				g[dir] = append(g[dir], rule)
+			}
+		}
+	}
+
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"deep/down/app.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"src/build", true, false}, // anchored to the root
+		{"node_modules", true, true},
+		{"web/node_modules", true, true},
+		{"node_modules", false, false}, // only directories
+		{"docs/a/b/x.tmp", false, true},
+		{"docs/x.tmp", false, true},
+		{"x.tmp", false, false},
+		{"#hash", false, true},
+		{"cache1", true, true},
+		{"cache12", true, false},
+		{"web/dist", true, true},
+		{"web/sub/dist", true, true},
+		{"dist", true, false}, // web/.gitignore doesn't reach up
+		{"web/local.js", false, true},
+		{"web/sub/local.js", false, false},
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := g.ignored(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestScanText(t *testing.T) {
+	tests := []struct {
+		name, src string
+		want      []string // kind|owner|text
+	}{
+		{"line comments", "x := 1 // TODO(alice): handle errors\n# FIXME broken\n-- HACK: sql\n; TODO lisp",
+			[]string{"TODO|alice|handle errors", "FIXME||broken", "HACK||sql", "TODO||lisp"}},
+		{"block and html", "/* TODO: one */\n<!-- FIXME two -->", []string{"TODO||one", "FIXME||two"}},
+		{"block continuation", "/*\n * Parse things.\n * TODO: handle tabs\n */\n * TODO not a comment",
+			[]string{"TODO||handle tabs"}},
+		{"markdown bullets", "# Notes\n* TODO buy milk\n- TODO call\n** TODO org", nil},
+		{"not comments", "see https://example.com/#TODO\n#include <TODO.h>\nTODOS // TODOs are fine\nx // TODO", nil},
+	}
+	for _, tt := range tests {
+		comments, err := scanText([]byte(tt.src), "f.go")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, c := range comments {
+			got = append(got, c.Kind+"|"+c.Owner+"|"+c.Text)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCommentFingerprint(t *testing.T) {
+	fp := commentFingerprint("pkg/a.go", "TODO", "Handle  errors")
+	if got := commentFingerprint("pkg/a.go", "TODO", "handle errors "); got != fp {
+		t.Errorf("case and spacing changed the fingerprint: %s != %s", got, fp)
+	}
+	for _, other := range []string{
+		commentFingerprint("pkg/b.go", "TODO", "handle errors"),
+		commentFingerprint("pkg/a.go", "FIXME", "handle errors"),
+		commentFingerprint("pkg/a.go", "TODO", "handle more errors"),
+	} {
+		if other == fp {
+			t.Errorf("different comments share fingerprint %s", fp)
+		}
+	}
+}
+
+func TestAlignLines(t *testing.T) {
+	tests := []struct {
+		a, b, want []int
+	}{
+		{[]int{19, 29}, []int{10, 20, 30}, []int{1, 2}},
+		{[]int{5, 12, 30}, []int{11, 31}, []int{-1, 0, 1}},
+		{[]int{4, 8}, []int{5, 9}, []int{0, 1}},
+		{[]int{7}, nil, []int{-1}},
+		{nil, []int{3}, []int{}},
+	}
+	for _, tt := range tests {
+		if got := alignLines(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("alignLines(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// scanTree writes files under dir and runs a scan and sync of it
+func scanTree(t *testing.T, dir string, files map[string]string) *ScanSummary {
+	t.Helper()
+	for name, src := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	comments, _, err := ScanCodeComments(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := SyncCodeComments(dir, "", "", comments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return summary
+}
+
+func TestSyncCodeCommentsLineShift(t *testing.T) {
+	openTestDB(t)
+	dir := t.TempDir()
+	scanTree(t, dir, map[string]string{"a.go": "package a\n// TODO: first\n"})
+	s := scanTree(t, dir, map[string]string{"a.go": "package a\n\nimport \"fmt\"\n// TODO: first\n"})
+	if len(s.Added) != 0 || s.Updated != 0 || len(s.Closed) != 0 {
+		t.Errorf("moving a comment down: %d added, %d updated, %d closed; want nothing", len(s.Added), s.Updated, len(s.Closed))
+	}
+}
+
+func TestSyncCodeCommentsIdentical(t *testing.T) {
+	openTestDB(t)
+	dir := t.TempDir()
+	s := scanTree(t, dir, map[string]string{"a.go": "// TODO: retry\nx()\n// TODO: retry\ny()\n// TODO: retry\n"})
+	if len(s.Added) != 3 {
+		t.Fatalf("added %d todos, want 3", len(s.Added))
+	}
+	first := s.Added[0].ID
+
+	// Removing the first of three identical comments completes its todo
+	s = scanTree(t, dir, map[string]string{"a.go": "x()\n// TODO: retry\ny()\n// TODO: retry\n"})
+	if len(s.Added) != 0 || len(s.Closed) != 1 || s.Closed[0].ID != first {
+		t.Fatalf("closed %v, added %d; want only todo %d closed", s.Closed, len(s.Added), first)
+	}
+
+	// and putting it back reopens it
+	s = scanTree(t, dir, map[string]string{"a.go": "// TODO: retry\nx()\n// TODO: retry\ny()\n// TODO: retry\n"})
+	if len(s.Added) != 1 || s.Added[0].ID != first || len(s.Closed) != 0 {
+		t.Fatalf("added %v, closed %d; want todo %d reopened", s.Added, len(s.Closed), first)
+	}
+	if n := len(pendingTasks(t)); n != 3 {
+		t.Errorf("%d pending todos, want 3", n)
+	}
+}
+
+func TestSyncCodeCommentsMovedRoot(t *testing.T) {
+	openTestDB(t)
+	base := t.TempDir()
+	old := filepath.Join(base, "old")
+	scanTree(t, old, map[string]string{"a.go": "// TODO: one\n", "b/b.go": "// FIXME: two\n"})
+
+	moved := filepath.Join(base, "moved")
+	if err := os.Rename(old, moved); err != nil {
+		t.Fatal(err)
+	}
+	s := scanTree(t, moved, nil)
+	if len(s.Added) != 0 || len(s.Closed) != 0 {
+		t.Errorf("after moving the tree: %d added, %d closed; want none", len(s.Added), len(s.Closed))
+	}
+	tasks := pendingTasks(t)
+	if len(tasks) != 2 || !strings.Contains(strings.Join(tasks, ";"), "two (b/b.go)") {
+		t.Errorf("pending todos %q, want the two scanned ones", tasks)
+	}
+}
+
+func TestSyncCodeCommentsRollsBack(t *testing.T) {
+	openTestDB(t)
+	dir := t.TempDir()
+	for name, src := range map[string]string{"a.go": "// TODO: one\n", "b.go": "// TODO: two\n"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(src), 0644)
+	}
+	comments, _, err := ScanCodeComments(dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fail partway, after a.go's todo is added
+	db.Exec(`CREATE TRIGGER fail_scan BEFORE INSERT ON code_comments WHEN NEW.file = 'b.go' BEGIN SELECT RAISE(ABORT, 'boom'); END`)
+	if _, err := SyncCodeComments(dir, "", "", comments); err == nil {
+		t.Fatal("sync succeeded despite the failing insert")
+	}
+	if tasks := pendingTasks(t); len(tasks) != 0 {
+		t.Fatalf("failed sync left todos %q", tasks)
+	}
+
+	db.Exec(`DROP TRIGGER fail_scan`)
+	s, err := SyncCodeComments(dir, "", "", comments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Added) != 2 || len(pendingTasks(t)) != 2 {
+		t.Errorf("added %d, %d pending; want 2 of each", len(s.Added), len(pendingTasks(t)))
+	}
+}
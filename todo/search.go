@@ -0,0 +1,166 @@
+package main
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// vaultFTSSchema indexes vault items and their tag names for full-text
+// search (migration 3). Triggers keep the index in sync with vault_items,
+// item_tags and tags.
+const vaultFTSSchema = `
+	CREATE VIRTUAL TABLE vault_fts USING fts5(
+		title, content, meta_title, meta_description, tags,
+		tokenize = 'unicode61 remove_diacritics 2'
+	);
+
+	INSERT INTO vault_fts (rowid, title, content, meta_title, meta_description, tags)
+	SELECT vi.id, vi.title, vi.content, vi.meta_title, vi.meta_description,
+		COALESCE((SELECT group_concat(t.name, ' ') FROM tags t JOIN item_tags it ON t.id = it.tag_id WHERE it.item_id = vi.id), '')
+	FROM vault_items vi;
+
+	CREATE TRIGGER vault_fts_insert AFTER INSERT ON vault_items BEGIN
+		INSERT INTO vault_fts (rowid, title, content, meta_title, meta_description, tags)
+		VALUES (new.id, new.title, new.content, new.meta_title, new.meta_description, '');
+	END;
+
+	CREATE TRIGGER vault_fts_update AFTER UPDATE OF title, content, meta_title, meta_description ON vault_items BEGIN
+		UPDATE vault_fts SET title = new.title, content = new.content,
+			meta_title = new.meta_title, meta_description = new.meta_description
+		WHERE rowid = new.id;
+	END;
+
+	CREATE TRIGGER vault_fts_delete AFTER DELETE ON vault_items BEGIN
+		DELETE FROM vault_fts WHERE rowid = old.id;
+	END;
+
+	CREATE TRIGGER vault_fts_tag_add AFTER INSERT ON item_tags BEGIN
+		UPDATE vault_fts SET tags = COALESCE((SELECT group_concat(t.name, ' ') FROM tags t
+			JOIN item_tags it ON t.id = it.tag_id WHERE it.item_id = new.item_id), '')
+		WHERE rowid = new.item_id;
+	END;
+
+	CREATE TRIGGER vault_fts_tag_remove AFTER DELETE ON item_tags BEGIN
+		UPDATE vault_fts SET tags = COALESCE((SELECT group_concat(t.name, ' ') FROM tags t
+			JOIN item_tags it ON t.id = it.tag_id WHERE it.item_id = old.item_id), '')
+		WHERE rowid = old.item_id;
+	END;
+
+	CREATE TRIGGER vault_fts_tag_rename AFTER UPDATE OF name ON tags BEGIN
+		UPDATE vault_fts SET tags = COALESCE((SELECT group_concat(t.name, ' ') FROM tags t
+			JOIN item_tags it ON t.id = it.tag_id WHERE it.item_id = vault_fts.rowid), '')
+		WHERE rowid IN (SELECT item_id FROM item_tags WHERE tag_id = new.id);
+	END;
+	`
+
+// Snippet highlight markers written by SQLite and replaced for display
+const (
+	snippetStart = "\x02"
+	snippetEnd   = "\x03"
+)
+
+// buildFTSQuery translates user search syntax into an FTS5 MATCH expression.
+//
+//	"exact phrase"  phrase match
+//	go*             prefix match
+//	-python         exclude term
+//	OR              either side
+//
+// Every term is quoted so stray punctuation can't break the FTS5 parser.
+// match is "" when the input has no positive terms; exclude then holds
+// the excluded terms, if any, for filtering out of all items instead.
+func buildFTSQuery(input string) (match, exclude string) {
+	var positive, negative []string
+
+	for _, tok := range tokenizeSearch(input) {
+		if tok == "OR" {
+			if len(positive) > 0 && positive[len(positive)-1] != "OR" {
+				positive = append(positive, "OR")
+			}
+			continue
+		}
+
+		negate := strings.HasPrefix(tok, "-") && len(tok) > 1
+		if negate {
+			tok = tok[1:]
+		}
+		prefix := strings.HasSuffix(tok, "*")
+		tok = strings.Trim(tok, `"*`)
+		if strings.TrimFunc(tok, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) == "" {
+			continue
+		}
+
+		term := `"` + strings.ReplaceAll(tok, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		if negate {
+			negative = append(negative, term)
+		} else {
+			positive = append(positive, term)
+		}
+	}
+
+	if len(positive) > 0 && positive[len(positive)-1] == "OR" {
+		positive = positive[:len(positive)-1]
+	}
+	if len(positive) == 0 {
+		return "", strings.Join(negative, " OR ")
+	}
+
+	match = strings.Join(positive, " ")
+	if len(negative) > 0 {
+		match = "(" + match + ")"
+		for _, n := range negative {
+			match += " NOT " + n
+		}
+	}
+	return match, ""
+}
+
+// tokenizeSearch splits on whitespace while keeping quoted phrases together
+func tokenizeSearch(input string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inQuote := false
+
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			cur.WriteRune(r)
+			if inQuote {
+				inQuote = false
+			} else {
+				inQuote = true
+			}
+		case unicode.IsSpace(r) && !inQuote:
+			flush()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// SnippetHTML escapes a search snippet and wraps matches in <mark>
+func SnippetHTML(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, snippetStart, "<mark>")
+	return strings.ReplaceAll(s, snippetEnd, "</mark>")
+}
+
+// SnippetTerminal renders a search snippet with bold matches
+func SnippetTerminal(s string) string {
+	s = strings.ReplaceAll(s, snippetStart, "\033[1m")
+	s = strings.ReplaceAll(s, snippetEnd, "\033[0m")
+	return strings.Join(strings.Fields(s), " ")
+}
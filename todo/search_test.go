@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestBuildFTSQuery(t *testing.T) {
+	tests := []struct {
+		input, match, exclude string
+	}{
+		{"golang", `"golang"`, ""},
+		{"go*", `"go"*`, ""},
+		{`"exact phrase"`, `"exact phrase"`, ""},
+		{"go OR rust", `"go" OR "rust"`, ""},
+		{"OR go OR", `"go"`, ""},
+		{"golang -python", `("golang") NOT "python"`, ""},
+		{"-python", "", `"python"`},
+		{"-python -rust", "", `"python" OR "rust"`},
+		{"!!! ...", "", ""},
+		{"-", "", ""},
+		{`say "hi`, `"say" "hi"`, ""},
+		{`a"b`, `"a""b"`, ""},
+	}
+	for _, tt := range tests {
+		match, exclude := buildFTSQuery(tt.input)
+		if match != tt.match || exclude != tt.exclude {
+			t.Errorf("buildFTSQuery(%q) = %q, %q; want %q, %q", tt.input, match, exclude, tt.match, tt.exclude)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"io/fs"
@@ -13,14 +14,24 @@ import (
 var content embed.FS
 
 func startServer() {
+	// Background metadata fetching
+	StartFetchWorkers(context.Background(), 3)
+
 	// Serve static files
 	staticFS, _ := fs.Sub(content, "static")
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(staticFS))))
 
+	// Cached thumbnails
+	http.HandleFunc("/media/", handleMedia)
+
+	// Calendar feed of due todos
+	http.HandleFunc("/calendar.ics", handleCalendarICS)
+
 	// Todo API routes
 	http.HandleFunc("/api/todos", handleAPITodos)
 	http.HandleFunc("/api/todos/", handleAPITodo)
 	http.HandleFunc("/api/categories", handleAPICategories)
+	http.HandleFunc("/api/agenda", handleAPIAgenda)
 
 	// Vault API routes
 	http.HandleFunc("/api/vault", handleAPIVault)
@@ -52,6 +63,8 @@ func startServer() {
 	if ip != "" {
 		fmt.Printf("  Network: http://%s:8080\n", ip)
 	}
+	fmt.Printf("  Calendar: http://localhost:8080/calendar.ics\n")
+	fmt.Printf("  Database: %s\n", dbPath)
 	fmt.Println()
 	fmt.Println("Press Ctrl+C to stop")
 
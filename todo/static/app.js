@@ -2,8 +2,10 @@
 
 const API = '/api';
 let todos = [];
+let agendaTodos = [];
 let vaultItems = [];
 let allTags = [];
+let vaultPollTimer = null;
 
 // Initialize
 document.addEventListener('DOMContentLoaded', () => {
@@ -24,6 +26,7 @@ function setupTabs() {
             document.querySelectorAll('.view').forEach(v => v.classList.remove('active'));
             tab.classList.add('active');
             document.getElementById(tab.dataset.view + '-view').classList.add('active');
+            if (tab.dataset.view === 'agenda') loadAgenda();
         });
     });
 }
@@ -34,6 +37,7 @@ function setupEventListeners() {
     document.getElementById('filter-status').addEventListener('change', loadTodos);
     document.getElementById('filter-priority').addEventListener('change', loadTodos);
     document.getElementById('filter-category').addEventListener('change', loadTodos);
+    document.getElementById('filter-due').addEventListener('change', loadTodos);
     document.getElementById('filter-search').addEventListener('input', debounce(loadTodos, 300));
     document.getElementById('edit-form').addEventListener('submit', handleEdit);
     document.getElementById('edit-modal').addEventListener('click', (e) => {
@@ -49,6 +53,9 @@ function setupEventListeners() {
     document.getElementById('vault-edit-modal').addEventListener('click', (e) => {
         if (e.target.id === 'vault-edit-modal') closeVaultModal();
     });
+    document.getElementById('reader-modal').addEventListener('click', (e) => {
+        if (e.target.id === 'reader-modal') closeReader();
+    });
 }
 
 // ==================== TODOS ====================
@@ -58,18 +65,47 @@ async function loadTodos() {
     const priority = document.getElementById('filter-priority').value;
     const category = document.getElementById('filter-category').value;
     const search = document.getElementById('filter-search').value;
+    const due = document.getElementById('filter-due').value;
 
     const params = new URLSearchParams();
     if (status) params.set('status', status);
     if (priority) params.set('priority', priority);
     if (category) params.set('category', category);
     if (search) params.set('search', search);
+    if (due) params.set('due', due);
 
     const response = await fetch(`${API}/todos?${params}`);
     todos = await response.json();
     renderTodos();
 }
 
+// Reload whichever todo views are showing data after a change
+function reloadTodos() {
+    loadTodos();
+    if (document.getElementById('agenda-view').classList.contains('active')) loadAgenda();
+}
+
+async function loadAgenda() {
+    const response = await fetch(`${API}/agenda`);
+    const groups = await response.json();
+    agendaTodos = groups.flatMap(g => g.todos);
+
+    const container = document.getElementById('agenda-groups');
+    const empty = document.getElementById('agenda-empty');
+    if (groups.length === 0) {
+        container.innerHTML = '';
+        empty.style.display = 'block';
+        return;
+    }
+    empty.style.display = 'none';
+    container.innerHTML = groups.map(g => `
+        <section class="agenda-group ${g.overdue ? 'overdue' : ''}">
+            <h3 class="agenda-heading">${escapeHtml(g.label)}${g.label === 'Today' || g.label === 'Tomorrow' ? ` <span class="agenda-date">${formatDue(g.date)}</span>` : ''}</h3>
+            <ul class="todo-list">${g.todos.map(todo => renderTodoItem(todo)).join('')}</ul>
+        </section>
+    `).join('');
+}
+
 async function loadCategories() {
     const response = await fetch(`${API}/categories`);
     const categories = await response.json();
@@ -97,8 +133,26 @@ function renderTodos() {
     list.innerHTML = todos.map(todo => renderTodoItem(todo)).join('');
 }
 
+// Due dates are local "YYYY-MM-DD" (all day) or "YYYY-MM-DDTHH:MM"
+function parseDue(due) {
+    const [date, time] = due.split('T');
+    const [y, m, d] = date.split('-').map(Number);
+    if (!time) return { at: new Date(y, m - 1, d, 23, 59, 59), allDay: true };
+    const [hh, mm] = time.split(':').map(Number);
+    return { at: new Date(y, m - 1, d, hh, mm), allDay: false };
+}
+
+function formatDue(due) {
+    const { at, allDay } = parseDue(due);
+    const opts = { weekday: 'short', day: 'numeric', month: 'short' };
+    if (at.getFullYear() !== new Date().getFullYear()) opts.year = 'numeric';
+    let text = at.toLocaleDateString(undefined, opts);
+    if (!allDay) text += ' ' + at.toLocaleTimeString(undefined, { hour: '2-digit', minute: '2-digit' });
+    return text;
+}
+
 function renderTodoItem(todo) {
-    const isOverdue = todo.due_date && new Date(todo.due_date) < new Date() && !todo.done;
+    const isOverdue = todo.due_date && parseDue(todo.due_date).at < new Date() && !todo.done;
     return `
         <li class="todo-item ${todo.done ? 'done' : ''}">
             <button class="todo-checkbox ${todo.done ? 'checked' : ''}"
@@ -108,7 +162,11 @@ function renderTodoItem(todo) {
                 <div class="todo-meta">
                     <span class="todo-priority ${todo.priority}">${todo.priority}</span>
                     ${todo.category ? `<span class="todo-category">#${escapeHtml(todo.category)}</span>` : ''}
-                    ${todo.due_date ? `<span class="todo-due ${isOverdue ? 'overdue' : ''}">Due: ${todo.due_date}</span>` : ''}
+                    ${todo.context ? `<span class="todo-context">${escapeHtml(todo.context)}</span>` : ''}
+                    ${todo.due_date ? `<span class="todo-due ${isOverdue ? 'overdue' : ''}" title="${escapeHtml(todo.due_phrase || todo.due_date).replace(/"/g, '&quot;')}">Due: ${formatDue(todo.due_date)}</span>` : ''}
+                    ${todo.recurrence ? `<span class="todo-recurrence">↻ ${escapeHtml(todo.recurrence)}</span>` : ''}
+                    ${todo.subtasks_total ? `<span class="todo-progress">${todo.subtasks_done}/${todo.subtasks_total} done</span>` : ''}
+                    ${todo.blocked ? `<span class="todo-blocked">Blocked by ${todo.blocked_by.map(id => '#' + id).join(', ')}</span>` : ''}
                 </div>
             </div>
             <div class="todo-actions">
@@ -128,45 +186,60 @@ async function handleAdd(e) {
 
     if (!task) return;
 
-    await fetch(`${API}/todos`, {
+    const response = await fetch(`${API}/todos`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ task, priority, category, due_date: dueDate })
     });
+    if (!response.ok) {
+        alert(await response.text());
+        return;
+    }
 
     document.getElementById('task-input').value = '';
     document.getElementById('category-input').value = '';
     document.getElementById('due-input').value = '';
     document.getElementById('priority-input').value = 'medium';
 
-    loadTodos();
+    reloadTodos();
     loadCategories();
 }
 
-async function toggleTodo(id, done) {
-    await fetch(`${API}/todos/${id}`, {
+async function toggleTodo(id, done, force = false) {
+    const response = await fetch(`${API}/todos/${id}`, {
         method: 'PATCH',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ done })
+        body: JSON.stringify({ done, force })
     });
-    loadTodos();
+    // Blocked todos are only completed after confirming
+    if (response.status === 409) {
+        const reason = (await response.text()).trim();
+        if (confirm(`${reason}. Complete it anyway?`)) {
+            return toggleTodo(id, done, true);
+        }
+    }
+    reloadTodos();
 }
 
 async function deleteTodo(id) {
-    if (!confirm('Delete this todo?')) return;
+    const todo = todos.find(t => t.id === id) || agendaTodos.find(t => t.id === id);
+    const msg = todo && todo.subtasks_total ? `Delete this todo and its ${todo.subtasks_total} subtask(s)?` : 'Delete this todo?';
+    if (!confirm(msg)) return;
     await fetch(`${API}/todos/${id}`, { method: 'DELETE' });
-    loadTodos();
+    reloadTodos();
     loadCategories();
 }
 
 function openEditModal(id) {
-    const todo = todos.find(t => t.id === id);
+    const todo = todos.find(t => t.id === id) || agendaTodos.find(t => t.id === id);
     if (!todo) return;
     document.getElementById('edit-id').value = todo.id;
     document.getElementById('edit-task').value = todo.task;
     document.getElementById('edit-priority').value = todo.priority;
     document.getElementById('edit-category').value = todo.category || '';
     document.getElementById('edit-due').value = todo.due_date || '';
+    document.getElementById('edit-recurrence').value = todo.recurrence || '';
+    document.getElementById('edit-error').textContent = '';
     document.getElementById('edit-modal').style.display = 'flex';
 }
 
@@ -177,9 +250,9 @@ function closeModal() {
 async function handleEdit(e) {
     e.preventDefault();
     const id = document.getElementById('edit-id').value;
-    const todo = todos.find(t => t.id === parseInt(id));
+    const todo = todos.find(t => t.id === parseInt(id)) || agendaTodos.find(t => t.id === parseInt(id));
 
-    await fetch(`${API}/todos/${id}`, {
+    const response = await fetch(`${API}/todos/${id}`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
@@ -187,12 +260,17 @@ async function handleEdit(e) {
             done: todo.done,
             priority: document.getElementById('edit-priority').value,
             category: document.getElementById('edit-category').value,
-            due_date: document.getElementById('edit-due').value
+            due_date: document.getElementById('edit-due').value,
+            recurrence: document.getElementById('edit-recurrence').value
         })
     });
+    if (!response.ok) {
+        document.getElementById('edit-error').textContent = await response.text();
+        return;
+    }
 
     closeModal();
-    loadTodos();
+    reloadTodos();
     loadCategories();
 }
 
@@ -209,6 +287,12 @@ async function loadVaultItems() {
     const response = await fetch(`${API}/vault?${params}`);
     vaultItems = await response.json();
     renderVaultItems();
+
+    // Metadata is fetched in the background; check back until it lands
+    clearTimeout(vaultPollTimer);
+    if (vaultItems.some(i => i.meta_status === 'pending')) {
+        vaultPollTimer = setTimeout(loadVaultItems, 3000);
+    }
 }
 
 async function loadAllTags() {
@@ -259,11 +343,14 @@ function renderVaultItem(item) {
             <div class="vault-item-header">
                 <span class="type-badge ${item.content_type}">${typeLabel}</span>
                 ${item.pinned ? '<span class="pin-badge">PINNED</span>' : ''}
+                ${item.meta_status === 'pending' ? '<span class="status-badge">Fetching...</span>' : ''}
+                ${item.meta_status === 'failed' ? `<span class="status-badge failed" title="${escapeHtml(item.meta_error || '')}" onclick="refetchVaultItem(${item.id})">Fetch failed · retry</span>` : ''}
             </div>
-            ${item.meta_thumbnail ? `<img class="vault-item-thumb" src="${item.meta_thumbnail}" alt="">` : ''}
+            ${thumbnailURL(item) ? `<img class="vault-item-thumb" src="${thumbnailURL(item)}" alt="" loading="lazy">` : ''}
             <div class="vault-item-title">${escapeHtml(title)}</div>
+            ${item.snippet ? `<div class="vault-item-snippet">${item.snippet}</div>` : ''}
             ${item.meta_description ? `<div class="vault-item-desc">${escapeHtml(truncate(item.meta_description, 120))}</div>` : ''}
-            ${item.meta_author ? `<div class="vault-item-author">${escapeHtml(item.meta_author)}</div>` : ''}
+            ${item.meta_author || item.meta_reading_time ? `<div class="vault-item-author">${escapeHtml([item.meta_author, item.meta_reading_time ? `${item.meta_reading_time} min read` : ''].filter(x => x).join(' · '))}</div>` : ''}
             ${item.tags && item.tags.length > 0 ? `
                 <div class="vault-item-tags">
                     ${item.tags.map(t => `<span class="tag">#${escapeHtml(t.name)}</span>`).join('')}
@@ -271,6 +358,7 @@ function renderVaultItem(item) {
             ` : ''}
             <div class="vault-item-actions">
                 ${item.url ? `<a href="${item.url}" target="_blank" class="btn-open">Open</a>` : ''}
+                ${item.content_type === 'article' ? `<button class="btn-read" onclick="openReader(${item.id})">Read</button>` : ''}
                 <button class="btn-pin ${item.pinned ? 'active' : ''}" onclick="toggleVaultPin(${item.id}, ${!item.pinned})">
                     ${item.pinned ? 'Unpin' : 'Pin'}
                 </button>
@@ -281,6 +369,12 @@ function renderVaultItem(item) {
     `;
 }
 
+// Prefer the locally cached copy; remote thumbnails expire or get blocked
+function thumbnailURL(item) {
+    if (item.thumb_hash) return `/media/${item.thumb_hash}`;
+    return item.meta_thumbnail || '';
+}
+
 async function handleVaultInputPreview() {
     const input = document.getElementById('vault-input').value.trim();
     const preview = document.getElementById('input-preview');
@@ -310,6 +404,9 @@ async function handleVaultInputPreview() {
         if (data.meta_title) {
             html += `<div class="preview-title">${escapeHtml(data.meta_title)}</div>`;
         }
+        if (data.url) {
+            html += `<div class="preview-resolved">→ ${escapeHtml(data.url)}</div>`;
+        }
 
         preview.innerHTML = html;
         preview.classList.add('visible');
@@ -328,16 +425,24 @@ async function handleVaultAdd(e) {
 
     const tags = tagsInput ? tagsInput.split(',').map(t => t.trim()).filter(t => t) : [];
 
-    await fetch(`${API}/vault`, {
+    const response = await fetch(`${API}/vault`, {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ content, tags, pinned })
     });
+    const saved = await response.json();
 
     document.getElementById('vault-input').value = '';
     document.getElementById('vault-tags').value = '';
     document.getElementById('vault-pin').checked = false;
-    document.getElementById('input-preview').classList.remove('visible');
+
+    const preview = document.getElementById('input-preview');
+    if (saved.duplicate) {
+        preview.innerHTML = `<div class="preview-duplicate">Already saved as #${saved.id}${tags.length ? ' — tags merged' : ''}</div>`;
+        setTimeout(() => preview.classList.remove('visible'), 4000);
+    } else {
+        preview.classList.remove('visible');
+    }
 
     loadVaultItems();
     loadAllTags();
@@ -352,6 +457,11 @@ async function toggleVaultPin(id, pinned) {
     loadVaultItems();
 }
 
+async function refetchVaultItem(id) {
+    await fetch(`${API}/vault/${id}/refetch`, { method: 'POST' });
+    loadVaultItems();
+}
+
 async function archiveVaultItem(id) {
     if (!confirm('Archive this item?')) return;
     await fetch(`${API}/vault/${id}`, {
@@ -407,6 +517,42 @@ async function handleVaultEdit(e) {
     loadAllTags();
 }
 
+// Reader (offline snapshot)
+async function openReader(id) {
+    const item = vaultItems.find(i => i.id === id);
+    const title = document.getElementById('reader-title');
+    const meta = document.getElementById('reader-meta');
+    const body = document.getElementById('reader-body');
+
+    title.textContent = item ? (item.meta_title || item.title || '') : '';
+    meta.textContent = '';
+    body.innerHTML = '<p class="hint">Loading...</p>';
+    document.getElementById('reader-modal').style.display = 'flex';
+
+    let response = await fetch(`${API}/vault/${id}/snapshot`);
+    if (response.status === 404) {
+        response = await fetch(`${API}/vault/${id}/snapshot`, { method: 'POST' });
+    }
+    if (!response.ok) {
+        body.innerHTML = '<p class="hint">No offline copy available</p>';
+        return;
+    }
+    const snap = await response.json();
+
+    if (snap.title) title.textContent = snap.title;
+    meta.textContent = [snap.byline, `${snap.word_count} words`].filter(x => x).join(' · ');
+    if (snap.html) {
+        // Sanitized server-side
+        body.innerHTML = snap.html;
+    } else {
+        body.innerHTML = snap.text.split('\n\n').map(p => `<p>${escapeHtml(p)}</p>`).join('');
+    }
+}
+
+function closeReader() {
+    document.getElementById('reader-modal').style.display = 'none';
+}
+
 // Resurface
 async function loadResurface() {
     try {
@@ -438,10 +584,12 @@ function maybeShowResurface() {
 }
 
 // Utilities
+// escapeHtml makes text safe in element content and in quoted attributes;
+// innerHTML only escapes &, < and >, so quotes are done by hand
 function escapeHtml(text) {
     const div = document.createElement('div');
     div.textContent = text;
-    return div.innerHTML;
+    return div.innerHTML.replace(/"/g, '&quot;').replace(/'/g, '&#39;');
 }
 
 function truncate(s, max) {
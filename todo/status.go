@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// `vault status`: a one-line summary for the tmux status bar, e.g.
+//
+//	set -g status-right '#(vault status)'
+//
+// tmux runs it every status-interval seconds, so the rendered line is
+// cached on disk and the database is only opened when the cache is older
+// than the TTL or the database has been written since.
+
+// defaultStatusTemplate is used unless the config or --template sets one
+const defaultStatusTemplate = `{{if .Overdue}}#[fg=red]{{.Overdue}} overdue#[default] · {{end}}{{.Pending}} todo{{if .Pinned}} · 📌{{.Pinned}}{{end}}`
+
+// defaultStatusTTL is how long a cached line is reused
+const defaultStatusTTL = 30 * time.Second
+
+// StatusConfig is the "status" section of the config file
+type StatusConfig struct {
+	Template     string `json:"template"`
+	CacheSeconds int    `json:"cache_seconds"`
+}
+
+// StatusCounts are the values available to the status template
+type StatusCounts struct {
+	Overdue int    // pending todos past their due date
+	Today   int    // pending todos due later today
+	Pending int    // all pending todos, subtasks included
+	Blocked int    // pending todos waiting on others
+	Pinned  int    // pinned, unarchived items
+	Items   int    // unarchived items
+	Next    string // task of the next actionable todo, escaped for tmux
+}
+
+// statusFuncs are the template helpers
+var statusFuncs = template.FuncMap{
+	// trunc shortens s to n characters, ending in "…". Escaped "##"
+	// counts as one character and is never split.
+	"trunc": func(n int, s string) string {
+		r := []rune(strings.ReplaceAll(s, "##", "#"))
+		if n < 1 || len(r) <= n {
+			return s
+		}
+		return strings.ReplaceAll(string(r[:n-1])+"…", "#", "##")
+	},
+}
+
+// tmuxStylePattern matches tmux #[...] style directives
+var tmuxStylePattern = regexp.MustCompile(`#\[[^\]]*\]`)
+
+// GetStatusCounts computes the status values from the database
+func GetStatusCounts(now time.Time) (*StatusCounts, error) {
+	todos, err := GetTodos(TodoFilter{Status: "pending"})
+	if err != nil {
+		return nil, err
+	}
+	c := &StatusCounts{Pending: len(todos)}
+	for _, t := range todos {
+		if t.Blocked {
+			c.Blocked++
+		}
+	}
+	today := now.Format(dueDateLayout)
+	for _, g := range BuildAgenda(todos, now, 1) {
+		switch {
+		case g.Overdue:
+			c.Overdue = len(g.Todos)
+		case g.Date == today:
+			c.Today = len(g.Todos)
+		}
+	}
+	if next := NextActionable(todos, now); next != nil {
+		c.Next = strings.ReplaceAll(next.Task, "#", "##")
+	}
+
+	err = db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(pinned), 0) FROM vault_items WHERE archived = FALSE`).
+		Scan(&c.Items, &c.Pinned)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// RenderStatus fills the template. plain drops tmux styles for use outside
+// tmux.
+func RenderStatus(tmpl string, c *StatusCounts, plain bool) (string, error) {
+	t, err := template.New("status").Funcs(statusFuncs).Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("status template: %w", err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, c); err != nil {
+		return "", fmt.Errorf("status template: %w", err)
+	}
+	line := strings.TrimSpace(b.String())
+	if plain {
+		line = strings.ReplaceAll(tmuxStylePattern.ReplaceAllString(line, ""), "##", "#")
+	}
+	return line, nil
+}
+
+// statusCachePath is the cache file for one database and template
+func statusCachePath(path, tmpl string, plain bool) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%t", path, tmpl, plain)))
+	return filepath.Join(cacheDir(), "status-"+hex.EncodeToString(sum[:6]))
+}
+
+// readStatusCache returns the cached line if it is younger than ttl and
+// newer than the database and its write-ahead log
+func readStatusCache(cachePath, path string, ttl time.Duration) (string, bool) {
+	info, err := os.Stat(cachePath)
+	if err != nil || time.Since(info.ModTime()) > ttl {
+		return "", false
+	}
+	for _, f := range []string{path, path + "-wal"} {
+		if dbInfo, err := os.Stat(f); err == nil && dbInfo.ModTime().After(info.ModTime()) {
+			return "", false
+		}
+	}
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// writeStatusCache replaces the cache file atomically so a concurrent
+// reader never sees half a line
+func writeStatusCache(cachePath, line string) error {
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), ".status-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(line); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), cachePath)
+}
+
+// handleStatus prints the status line. It opens the database itself, and
+// only on a cache miss.
+func handleStatus(a *cmdArgs) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	tmpl := firstNonEmpty(a.Value("--template"), cfg.Status.Template, defaultStatusTemplate)
+	ttl := defaultStatusTTL
+	if cfg.Status.CacheSeconds > 0 {
+		ttl = time.Duration(cfg.Status.CacheSeconds) * time.Second
+	}
+	plain := a.Has("--plain")
+
+	path, err := resolveDBPath()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	cachePath := statusCachePath(path, tmpl, plain)
+	if !a.Has("--no-cache") {
+		if line, ok := readStatusCache(cachePath, path, ttl); ok {
+			fmt.Println(line)
+			return
+		}
+	}
+
+	if err := InitDB(); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer CloseDB()
+	counts, err := GetStatusCounts(time.Now())
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	line, err := RenderStatus(tmpl, counts, plain)
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	// A failed cache write only costs the next run a query
+	writeStatusCache(cachePath, line)
+	fmt.Println(line)
+}
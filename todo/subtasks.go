@@ -0,0 +1,221 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Subtasks. Todos form a tree through parent_id; deleting a todo deletes
+// its subtree via ON DELETE CASCADE, completing one completes its subtree,
+// and reopening a subtask reopens its ancestors.
+
+// subtaskSchema adds the parent link (migration 12)
+const subtaskSchema = `
+	ALTER TABLE todos ADD COLUMN parent_id INTEGER REFERENCES todos(id) ON DELETE CASCADE;
+	CREATE INDEX idx_todos_parent ON todos(parent_id);
+	`
+
+var (
+	// errSubtaskCycle is returned when a todo would become its own ancestor
+	errSubtaskCycle = errors.New("a todo can't be moved under itself or one of its subtasks")
+	errNoParent     = errors.New("parent todo not found")
+)
+
+// todoAncestry pairs every todo with each of its ancestors
+const todoAncestry = `
+	WITH RECURSIVE ancestry(ancestor, id) AS (
+		SELECT parent_id, id FROM todos WHERE parent_id IS NOT NULL
+		UNION ALL
+		SELECT t.parent_id, a.id FROM ancestry a JOIN todos t ON t.id = a.ancestor
+		WHERE t.parent_id IS NOT NULL
+	)`
+
+// progressBatch bounds how many todos one fillProgress query covers, well
+// under SQLite's limit on bound parameters
+const progressBatch = 500
+
+// fillProgress sets the roll-up counts, which cover all descendants. Only
+// the subtrees of the given todos are walked.
+func fillProgress(q sqlRunner, todos []Todo) error {
+	type progress struct{ total, done int }
+	counts := map[int64]progress{}
+	for start := 0; start < len(todos); start += progressBatch {
+		batch := todos[start:min(start+progressBatch, len(todos))]
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, len(batch))
+		for i, t := range batch {
+			placeholders[i] = "?"
+			args[i] = t.ID
+		}
+		rows, err := q.Query(`
+			WITH RECURSIVE subtree(root, id, done) AS (
+				SELECT parent_id, id, done FROM todos WHERE parent_id IN (`+strings.Join(placeholders, ",")+`)
+				UNION ALL
+				SELECT s.root, t.id, t.done FROM subtree s JOIN todos t ON t.parent_id = s.id
+			)
+			SELECT root, COUNT(*), SUM(CASE WHEN done THEN 1 ELSE 0 END)
+			FROM subtree GROUP BY root`, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int64
+			var p progress
+			if err := rows.Scan(&id, &p.total, &p.done); err != nil {
+				rows.Close()
+				return err
+			}
+			counts[id] = p
+		}
+		rows.Close()
+	}
+	for i := range todos {
+		p := counts[todos[i].ID]
+		todos[i].SubtasksTotal, todos[i].SubtasksDone = p.total, p.done
+	}
+	return nil
+}
+
+// descendantIDs lists every todo below id
+func descendantIDs(q sqlRunner, id int64) ([]int64, error) {
+	rows, err := q.Query(todoAncestry+` SELECT id FROM ancestry WHERE ancestor = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var d int64
+		rows.Scan(&d)
+		ids = append(ids, d)
+	}
+	return ids, nil
+}
+
+// checkParent verifies that parentID exists and isn't id or below it
+func checkParent(q sqlRunner, id, parentID int64) error {
+	if parentID == 0 {
+		return nil
+	}
+	var exists int
+	if err := q.QueryRow(`SELECT 1 FROM todos WHERE id = ?`, parentID).Scan(&exists); err == sql.ErrNoRows {
+		return errNoParent
+	} else if err != nil {
+		return err
+	}
+	if id == 0 {
+		return nil
+	}
+	if parentID == id {
+		return errSubtaskCycle
+	}
+	below, err := descendantIDs(q, id)
+	if err != nil {
+		return err
+	}
+	for _, d := range below {
+		if d == parentID {
+			return errSubtaskCycle
+		}
+	}
+	return nil
+}
+
+// cascadeDone propagates a done change: completing a todo completes its
+// subtree, reopening one reopens the ancestors that were marked done
+func cascadeDone(q sqlRunner, id int64, done bool) error {
+	now := time.Now().Format(time.RFC3339)
+	if done {
+		_, err := q.Exec(todoAncestry+`
+			UPDATE todos SET done = TRUE, updated_at = ?, completed_at = ?
+			WHERE done = FALSE AND id IN (SELECT id FROM ancestry WHERE ancestor = ?)`, now, now, id)
+		return err
+	}
+	_, err := q.Exec(todoAncestry+`
+		UPDATE todos SET done = FALSE, updated_at = ?, completed_at = ''
+		WHERE done = TRUE AND id IN (SELECT ancestor FROM ancestry WHERE id = ?)`, now, id)
+	return err
+}
+
+// copySubtasks recreates the subtree of from under to, all undone, so a
+// recurring todo's checklist comes back with each occurrence
+func copySubtasks(q sqlRunner, from, to int64) error {
+	rows, err := q.Query(`SELECT `+todoColumns+` FROM todos WHERE parent_id = ? ORDER BY id`, from)
+	if err != nil {
+		return err
+	}
+	var children []Todo
+	for rows.Next() {
+		if t, err := scanTodo(rows); err == nil {
+			children = append(children, *t)
+		}
+	}
+	rows.Close()
+
+	for _, c := range children {
+		copied, err := createTodo(q, &Todo{
+			Task:     c.Task,
+			Priority: c.Priority,
+			Category: c.Category,
+			ParentID: to,
+			Context:  c.Context,
+		})
+		if err != nil {
+			return err
+		}
+		if err := copySubtasks(q, c.ID, copied.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// todoTreeRow is one line of a rendered todo tree
+type todoTreeRow struct {
+	Todo   Todo
+	Prefix string // box-drawing guides, e.g. "│  └─ "
+}
+
+// todoTree orders todos depth-first under their parents, keeping the
+// given order among siblings. Todos whose parent isn't in the list (it was
+// filtered out) are shown at the top level.
+func todoTree(todos []Todo) []todoTreeRow {
+	present := map[int64]bool{}
+	for _, t := range todos {
+		present[t.ID] = true
+	}
+	children := map[int64][]Todo{}
+	var roots []Todo
+	for _, t := range todos {
+		if t.ParentID != 0 && present[t.ParentID] {
+			children[t.ParentID] = append(children[t.ParentID], t)
+		} else {
+			roots = append(roots, t)
+		}
+	}
+
+	var rows []todoTreeRow
+	var walk func(t Todo, guide, branch string)
+	walk = func(t Todo, guide, branch string) {
+		rows = append(rows, todoTreeRow{Todo: t, Prefix: guide + branch})
+		kids := children[t.ID]
+		if branch == "├─ " {
+			guide += "│  "
+		} else if branch == "└─ " {
+			guide += "   "
+		}
+		for i, c := range kids {
+			if i == len(kids)-1 {
+				walk(c, guide, "└─ ")
+			} else {
+				walk(c, guide, "├─ ")
+			}
+		}
+	}
+	for _, r := range roots {
+		walk(r, "", "")
+	}
+	return rows
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestFillProgressCountsWholeSubtree(t *testing.T) {
+	openTestDB(t)
+
+	add := func(task string, parent int64) int64 {
+		t.Helper()
+		todo, err := CreateTodo(&Todo{Task: task, ParentID: parent})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return todo.ID
+	}
+	release := add("release", 0)
+	docs := add("docs", release)
+	add("changelog", docs)
+	add("tag", release)
+	other := add("unrelated", 0)
+	add("unrelated child", other)
+	if _, err := MarkTodoDone(docs, true, false); err != nil {
+		t.Fatal(err)
+	}
+
+	todo, err := GetTodo(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if todo.SubtasksTotal != 3 || todo.SubtasksDone != 2 {
+		t.Errorf("release progress = %d/%d, want 2/3", todo.SubtasksDone, todo.SubtasksTotal)
+	}
+
+	todos, err := GetTodos(TodoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]int{"release": {2, 3}, "docs": {1, 1}, "unrelated": {0, 1}, "tag": {0, 0}}
+	for _, todo := range todos {
+		if w, ok := want[todo.Task]; ok && (todo.SubtasksDone != w[0] || todo.SubtasksTotal != w[1]) {
+			t.Errorf("%s progress = %d/%d, want %d/%d", todo.Task, todo.SubtasksDone, todo.SubtasksTotal, w[0], w[1])
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Raw terminal input for the interactive commands. The terminal is put in
+// raw mode with stty rather than termios ioctls so the same code runs on
+// Linux and macOS without build tags.
+
+// keyCode names the non-printable keys the interactive commands use
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyEnter
+	keyEsc
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyTab
+	keyBackspace
+	keyCtrl // Ctrl+letter, the letter in key.r
+)
+
+// key is one key press
+type key struct {
+	code keyCode
+	r    rune
+}
+
+// terminal is the controlling terminal in raw mode
+type terminal struct {
+	tty     *os.File
+	saved   string // stty settings to restore
+	pending []byte // input read but not yet returned as keys
+}
+
+// openTerminal opens /dev/tty, so it works even when stdout is piped, and
+// switches it to raw mode on the alternate screen
+func openTerminal() (*terminal, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal: %w", err)
+	}
+	saved, err := stty(tty, "-g")
+	if err != nil {
+		tty.Close()
+		return nil, err
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		tty.Close()
+		return nil, err
+	}
+	t := &terminal{tty: tty, saved: strings.TrimSpace(saved)}
+	t.write("\x1b[?1049h\x1b[?25l") // alternate screen, hide cursor
+	return t, nil
+}
+
+// Close restores the screen and the terminal settings
+func (t *terminal) Close() {
+	t.write("\x1b[?25h\x1b[?1049l")
+	stty(t.tty, t.saved)
+	t.tty.Close()
+}
+
+// suspend hands the terminal back, e.g. to run an editor
+func (t *terminal) suspend() {
+	t.write("\x1b[?25h\x1b[?1049l")
+	stty(t.tty, t.saved)
+}
+
+// resume takes the terminal back after suspend
+func (t *terminal) resume() {
+	stty(t.tty, "raw", "-echo")
+	t.write("\x1b[?1049h\x1b[?25l")
+}
+
+func (t *terminal) write(s string) {
+	t.tty.WriteString(s)
+}
+
+// size returns the terminal's rows and columns, defaulting to 24x80
+func (t *terminal) size() (rows, cols int) {
+	out, err := stty(t.tty, "size")
+	if err == nil {
+		if f := strings.Fields(out); len(f) == 2 {
+			rows, _ = strconv.Atoi(f[0])
+			cols, _ = strconv.Atoi(f[1])
+		}
+	}
+	if rows <= 0 || cols <= 0 {
+		return 24, 80
+	}
+	return rows, cols
+}
+
+// readKey blocks for the next key press. Escape sequences arrive in one
+// read, so a lone ESC byte is the Escape key; pasted text arrives in one
+// read too and is returned a key at a time.
+func (t *terminal) readKey() (key, error) {
+	if len(t.pending) == 0 {
+		buf := make([]byte, 256)
+		n, err := t.tty.Read(buf)
+		if err != nil {
+			return key{}, err
+		}
+		t.pending = buf[:n]
+	}
+	k, size := parseKey(t.pending)
+	t.pending = t.pending[size:]
+	return k, nil
+}
+
+// escapeKeys are the CSI/SS3 sequences understood, without ESC [ or ESC O
+var escapeKeys = map[string]keyCode{
+	"A": keyUp, "B": keyDown, "C": keyRight, "D": keyLeft,
+	"H": keyHome, "1~": keyHome, "7~": keyHome, "F": keyEnd, "4~": keyEnd, "8~": keyEnd,
+	"5~": keyPageUp, "6~": keyPageDown,
+}
+
+// parseKey decodes the key at the start of b and its length in bytes
+func parseKey(b []byte) (key, int) {
+	switch {
+	case b[0] == 27 && len(b) > 2 && (b[1] == '[' || b[1] == 'O'):
+		// Parameters, then a final byte in @..~
+		end := 2
+		for end < len(b) && (b[end] < '@' || b[end] > '~') {
+			end++
+		}
+		end = min(end+1, len(b))
+		if code, ok := escapeKeys[string(b[2:end])]; ok {
+			return key{code: code}, end
+		}
+		return key{code: keyEsc}, end
+	case b[0] == 27:
+		return key{code: keyEsc}, 1
+	case b[0] == '\r' || b[0] == '\n':
+		return key{code: keyEnter}, 1
+	case b[0] == '\t':
+		return key{code: keyTab}, 1
+	case b[0] == 127 || b[0] == 8:
+		return key{code: keyBackspace}, 1
+	case b[0] < 32:
+		return key{code: keyCtrl, r: rune('a' + b[0] - 1)}, 1
+	}
+	r, size := utf8.DecodeRune(b)
+	return key{code: keyRune, r: r}, size
+}
+
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("stty %s: %w", strings.Join(args, " "), err)
+	}
+	return string(out), nil
+}
+
+// fitWidth cuts s to at most width terminal columns, ending it with "…"
+// when it had to be cut
+func fitWidth(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if visibleWidth(s) <= width {
+		return s
+	}
+	var b strings.Builder
+	n, esc := 0, false
+	for _, r := range s {
+		w := escapedWidth(r, &esc)
+		if n+w > width-1 {
+			break
+		}
+		b.WriteRune(r)
+		n += w
+	}
+	return b.String() + "…"
+}
+
+// fitWidthLeft is fitWidth cutting from the start: it keeps the end of s
+// and begins it with "…". s must not contain escape sequences.
+func fitWidthLeft(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if visibleWidth(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	n, start := 0, len(runes)
+	for start > 0 && n+runeWidth(runes[start-1]) <= width-1 {
+		start--
+		n += runeWidth(runes[start])
+	}
+	return "…" + string(runes[start:])
+}
+
+// visibleWidth counts the terminal columns s takes outside escape sequences
+func visibleWidth(s string) int {
+	n, esc := 0, false
+	for _, r := range s {
+		n += escapedWidth(r, &esc)
+	}
+	return n
+}
+
+// escapedWidth is runeWidth for text that may contain escape sequences;
+// esc tracks whether one is open and its runes take no columns
+func escapedWidth(r rune, esc *bool) int {
+	switch {
+	case r == 27:
+		*esc = true
+	case *esc:
+		if r >= '@' && r <= '~' && r != '[' {
+			*esc = false
+		}
+	default:
+		return runeWidth(r)
+	}
+	return 0
+}
+
+// runeWidth is how many columns a terminal gives r: none for control
+// characters and combining marks, two for East Asian wide and fullwidth
+// characters and emoji, one for everything else
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x20 || r >= 0x7f && r < 0xa0:
+		return 0
+	case r < 0x300:
+		return 1
+	case r >= 0x1160 && r <= 0x11ff, unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	}
+	i := sort.Search(len(wideRunes), func(i int) bool { return wideRunes[i][1] >= r })
+	if i < len(wideRunes) && wideRunes[i][0] <= r {
+		return 2
+	}
+	return 1
+}
+
+// wideRunes are the sorted ranges of East Asian Wide (W) and Fullwidth (F)
+// characters in Unicode 15, which include the emoji shown as pictographs
+var wideRunes = [][2]rune{
+	{0x1100, 0x115f}, {0x231a, 0x231b}, {0x2329, 0x232a}, {0x23e9, 0x23ec},
+	{0x23f0, 0x23f0}, {0x23f3, 0x23f3}, {0x25fd, 0x25fe}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267f, 0x267f}, {0x2693, 0x2693}, {0x26a1, 0x26a1},
+	{0x26aa, 0x26ab}, {0x26bd, 0x26be}, {0x26c4, 0x26c5}, {0x26ce, 0x26ce},
+	{0x26d4, 0x26d4}, {0x26ea, 0x26ea}, {0x26f2, 0x26f3}, {0x26f5, 0x26f5},
+	{0x26fa, 0x26fa}, {0x26fd, 0x26fd}, {0x2705, 0x2705}, {0x270a, 0x270b},
+	{0x2728, 0x2728}, {0x274c, 0x274c}, {0x274e, 0x274e}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27b0, 0x27b0}, {0x27bf, 0x27bf},
+	{0x2b1b, 0x2b1c}, {0x2b50, 0x2b50}, {0x2b55, 0x2b55}, {0x2e80, 0x2e99},
+	{0x2e9b, 0x2ef3}, {0x2f00, 0x2fd5}, {0x2ff0, 0x303e}, {0x3041, 0x3096},
+	{0x3099, 0x30ff}, {0x3105, 0x312f}, {0x3131, 0x318e}, {0x3190, 0x31e3},
+	{0x31ef, 0x321e}, {0x3220, 0x3247}, {0x3250, 0x4dbf}, {0x4e00, 0xa48c},
+	{0xa490, 0xa4c6}, {0xa960, 0xa97c}, {0xac00, 0xd7a3}, {0xf900, 0xfaff},
+	{0xfe10, 0xfe19}, {0xfe30, 0xfe52}, {0xfe54, 0xfe66}, {0xfe68, 0xfe6b},
+	{0xff01, 0xff60}, {0xffe0, 0xffe6}, {0x16fe0, 0x16fe4}, {0x16ff0, 0x16ff1},
+	{0x17000, 0x187f7}, {0x18800, 0x18cd5}, {0x18d00, 0x18d08}, {0x1aff0, 0x1aff3},
+	{0x1aff5, 0x1affb}, {0x1affd, 0x1affe}, {0x1b000, 0x1b122}, {0x1b132, 0x1b132},
+	{0x1b150, 0x1b152}, {0x1b155, 0x1b155}, {0x1b164, 0x1b167}, {0x1b170, 0x1b2fb},
+	{0x1f004, 0x1f004}, {0x1f0cf, 0x1f0cf}, {0x1f18e, 0x1f18e}, {0x1f191, 0x1f19a},
+	{0x1f200, 0x1f202}, {0x1f210, 0x1f23b}, {0x1f240, 0x1f248}, {0x1f250, 0x1f251},
+	{0x1f260, 0x1f265}, {0x1f300, 0x1f320}, {0x1f32d, 0x1f335}, {0x1f337, 0x1f37c},
+	{0x1f37e, 0x1f393}, {0x1f3a0, 0x1f3ca}, {0x1f3cf, 0x1f3d3}, {0x1f3e0, 0x1f3f0},
+	{0x1f3f4, 0x1f3f4}, {0x1f3f8, 0x1f43e}, {0x1f440, 0x1f440}, {0x1f442, 0x1f4fc},
+	{0x1f4ff, 0x1f53d}, {0x1f54b, 0x1f54e}, {0x1f550, 0x1f567}, {0x1f57a, 0x1f57a},
+	{0x1f595, 0x1f596}, {0x1f5a4, 0x1f5a4}, {0x1f5fb, 0x1f64f}, {0x1f680, 0x1f6c5},
+	{0x1f6cc, 0x1f6cc}, {0x1f6d0, 0x1f6d2}, {0x1f6d5, 0x1f6d7}, {0x1f6dc, 0x1f6df},
+	{0x1f6eb, 0x1f6ec}, {0x1f6f4, 0x1f6fc}, {0x1f7e0, 0x1f7eb}, {0x1f7f0, 0x1f7f0},
+	{0x1f90c, 0x1f93a}, {0x1f93c, 0x1f945}, {0x1f947, 0x1f9ff}, {0x1fa70, 0x1fa7c},
+	{0x1fa80, 0x1fa88}, {0x1fa90, 0x1fabd}, {0x1fabf, 0x1fac5}, {0x1face, 0x1fadb},
+	{0x1fae0, 0x1fae8}, {0x1faf0, 0x1faf8}, {0x20000, 0x2fffd}, {0x30000, 0x3fffd},
+}
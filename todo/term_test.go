@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRuneWidth(t *testing.T) {
+	tests := []struct {
+		r    rune
+		want int
+	}{
+		{'a', 1},
+		{'é', 1},
+		{'↻', 1},
+		{'─', 1},
+		{'\t', 0},
+		{'\u0301', 0}, // combining acute accent
+		{'\u200d', 0}, // zero width joiner
+		{'\ufe0f', 0}, // variation selector
+		{'日', 2},
+		{'한', 2},
+		{'Ａ', 2}, // fullwidth A
+		{'⛔', 2},
+		{'📌', 2},
+		{'🚀', 2},
+		{'🤖', 2},
+	}
+	for _, tt := range tests {
+		if got := runeWidth(tt.r); got != tt.want {
+			t.Errorf("runeWidth(%q) = %d, want %d", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestFitWidth(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello world", 6, "hello…"},
+		{"hello", 0, ""},
+		{"📌 pinned note", 8, "📌 pinn…"},
+		{"日本語のタスク", 7, "日本語…"},
+		{"日本語のタスク", 8, "日本語…"}, // a wide rune doesn't fit in one column
+		{"\x1b[31mred\x1b[0m text", 8, "\x1b[31mred\x1b[0m text"},
+		{"\x1b[31mred\x1b[0m text", 5, "\x1b[31mred\x1b[0m …"},
+	}
+	for _, tt := range tests {
+		got := fitWidth(tt.s, tt.width)
+		if got != tt.want {
+			t.Errorf("fitWidth(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+		if w := visibleWidth(got); w > tt.width {
+			t.Errorf("fitWidth(%q, %d) is %d columns wide", tt.s, tt.width, w)
+		}
+	}
+}
+
+func TestTruncateStr(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exactly10!", 10, "exactly10!"},
+		{"a longer note", 10, "a longe..."},
+		{"café crème brûlée", 10, "café cr..."},
+		{"日本語のメモです", 6, "日本語..."},
+	}
+	for _, tt := range tests {
+		got := truncateStr(tt.s, tt.max)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("truncateStr(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestFitWidthLeft(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"hello", 5, "hello"},
+		{"hello world", 6, "…world"},
+		{"日本語のタスク", 7, "…タスク"},
+		{"日本語のタスク", 6, "…スク"}, // a wide rune doesn't fit in one column
+		{"hello", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := fitWidthLeft(tt.s, tt.width); got != tt.want {
+			t.Errorf("fitWidthLeft(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestPromptVisibleText(t *testing.T) {
+	text := []rune("a fairly long todo with ünïcode and 日本語 in the middle of it")
+	for _, width := range []int{20, 33, 80} {
+		for cursor := 0; cursor <= len(text); cursor++ {
+			p := &tuiPrompt{label: "Add:", text: text, cursor: cursor}
+			before, after := p.visibleText(width)
+			if w := visibleWidth(p.label) + 2 + visibleWidth(before) + visibleWidth(after); w > width {
+				t.Fatalf("width %d, cursor %d: line is %d columns (%q|%q)", width, cursor, w, before, after)
+			}
+			// The text just before the cursor is always shown
+			if cursor > 0 && !strings.HasSuffix(before, string(text[cursor-1])) {
+				t.Fatalf("width %d, cursor %d: %q doesn't end at the cursor", width, cursor, before)
+			}
+			if cursor < len(text) && !strings.HasPrefix(after, string(text[cursor])) {
+				t.Fatalf("width %d, cursor %d: %q doesn't start at the cursor", width, cursor, after)
+			}
+		}
+	}
+}
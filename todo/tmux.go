@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// `vault tmux install` writes the key bindings for the picker popup into
+// the tmux config, between marker lines so running it again replaces the
+// block instead of adding another.
+
+const (
+	tmuxBlockStart = "# >>> vault >>>"
+	tmuxBlockEnd   = "# <<< vault <<<"
+)
+
+// tmuxBindings returns the config block. The popup runs this binary by its
+// absolute path, with the same --db or --profile as the install.
+func tmuxBindings() string {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "vault"
+	}
+	vault := shellQuote(exe)
+	if dbFlag != "" {
+		vault += " --db " + shellQuote(expandHome(dbFlag))
+	} else if profileFlag != "" {
+		vault += " --profile " + shellQuote(profileFlag)
+	}
+
+	popup := func(only string) string {
+		pick := vault + " pick"
+		if only != "" {
+			pick += " " + only
+		}
+		// tmux expands #{pane_id} before running the command
+		return fmt.Sprintf(`display-popup -E -w 80%% -h 60%% -T " vault " "%s --pane '#{pane_id}'"`,
+			strings.ReplaceAll(pick, `"`, `\"`))
+	}
+	lines := []string{
+		tmuxBlockStart,
+		"# Added by `vault tmux install`; edits inside this block are overwritten",
+		"bind-key T " + popup("--todos"),
+		"bind-key V " + popup("--items"),
+		"bind-key F " + popup(""),
+		"# Todo counts in the status bar:",
+		fmt.Sprintf("# set -g status-right '#(%s status) %%H:%%M'", vault),
+		tmuxBlockEnd,
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// shellQuote quotes s for sh when it contains anything but safe characters
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("/._-+:=@", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// tmuxConfPath is ~/.tmux.conf, or the XDG location when only that exists
+func tmuxConfPath() string {
+	home, _ := os.UserHomeDir()
+	path := filepath.Join(home, ".tmux.conf")
+	if fileExists(path) {
+		return path
+	}
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	if alt := filepath.Join(xdg, "tmux", "tmux.conf"); fileExists(alt) {
+		return alt
+	}
+	return path
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// replaceTmuxBlock swaps the vault block in conf for block, appending it
+// when there is none
+func replaceTmuxBlock(conf, block string) string {
+	start := strings.Index(conf, tmuxBlockStart)
+	if start >= 0 {
+		if end := strings.Index(conf[start:], tmuxBlockEnd); end >= 0 {
+			rest := strings.TrimPrefix(conf[start+end+len(tmuxBlockEnd):], "\n")
+			return conf[:start] + block + rest
+		}
+	}
+	if conf != "" && !strings.HasSuffix(conf, "\n") {
+		conf += "\n"
+	}
+	if conf != "" {
+		conf += "\n"
+	}
+	return conf + block
+}
+
+func handleTmuxInstall(a *cmdArgs) {
+	block := tmuxBindings()
+	if a.Has("--print") {
+		fmt.Print(block)
+		return
+	}
+
+	path := tmuxConfPath()
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Error:", err)
+		return
+	}
+	updated := replaceTmuxBlock(string(data), block)
+	if updated == string(data) {
+		fmt.Printf("%s is up to date\n", path)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if err := os.WriteFile(path, []byte(updated), 0644); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Wrote the vault bindings to %s\n", path)
+	fmt.Println("  prefix T  pick a todo      prefix V  pick an item      prefix F  both")
+
+	if os.Getenv("TMUX") != "" {
+		if err := exec.Command("tmux", "source-file", path).Run(); err != nil {
+			fmt.Println("Reload with: tmux source-file", path)
+		} else {
+			fmt.Println("Reloaded tmux")
+		}
+	} else {
+		fmt.Println("Reload with: tmux source-file", path)
+	}
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// todo.txt support (http://todotxt.org). A line maps to a todo as:
+//
+//	x 2026-10-16 2026-10-01 (A) Call the bank +finance due:2026-10-20
+//
+// "x" is Done, (A) is high priority, (B) medium and (C) or lower low, the
+// first +project is the category and due: the due date. Other projects,
+// @contexts and key:value tags stay in the task text. Medium priority is
+// written without a letter since it is the default.
+
+// todotxtSyncSchema remembers, per synced file, which line each todo was
+// last synced as (migration 15). Rows outlive their todo on purpose: that
+// is how a sync tells a todo deleted in the vault from a new line.
+const todotxtSyncSchema = `
+	CREATE TABLE todotxt_sync (
+		file TEXT NOT NULL,
+		todo_id INTEGER NOT NULL,
+		line_fp TEXT NOT NULL,
+		todo_fp TEXT NOT NULL,
+		synced_at TEXT NOT NULL,
+		PRIMARY KEY (file, todo_id)
+	);
+	`
+
+var todotxtPriority = regexp.MustCompile(`^\(([A-Z])\) `)
+
+// ParseTodoTxt parses one todo.txt line. ok is false for blank lines.
+func ParseTodoTxt(line string) (todo Todo, ok bool) {
+	rest := strings.TrimSpace(line)
+	if rest == "" {
+		return todo, false
+	}
+	todo.Priority = PriorityMedium
+
+	if strings.HasPrefix(rest, "x ") {
+		todo.Done = true
+		rest = strings.TrimSpace(rest[2:])
+		// Completion date, then creation date
+		if completed, r, ok := cutDate(rest); ok {
+			todo.CompletedAt = completed
+			rest = r
+		}
+	} else if m := todotxtPriority.FindStringSubmatch(rest); m != nil {
+		switch m[1] {
+		case "A":
+			todo.Priority = PriorityHigh
+		case "B":
+		default:
+			todo.Priority = PriorityLow
+		}
+		rest = rest[len(m[0]):]
+	}
+	if created, r, ok := cutDate(rest); ok {
+		todo.CreatedAt = created
+		rest = r
+	}
+
+	var words []string
+	for _, word := range strings.Fields(rest) {
+		switch {
+		case strings.HasPrefix(word, "+") && len(word) > 1 && todo.Category == "":
+			todo.Category = word[1:]
+		case strings.HasPrefix(word, "due:") && todo.DueDate == "":
+			if _, _, ok := parseDueDate(word[4:]); ok {
+				todo.DueDate = word[4:]
+			} else {
+				words = append(words, word)
+			}
+		default:
+			words = append(words, word)
+		}
+	}
+	todo.Task = strings.Join(words, " ")
+	return todo, todo.Task != ""
+}
+
+// cutDate splits a leading YYYY-MM-DD off s
+func cutDate(s string) (time.Time, string, bool) {
+	word, rest, _ := strings.Cut(s, " ")
+	t, err := time.ParseInLocation(dueDateLayout, word, time.Local)
+	if err != nil {
+		return time.Time{}, s, false
+	}
+	return t, strings.TrimSpace(rest), true
+}
+
+// FormatTodoTxt renders a todo as a todo.txt line
+func FormatTodoTxt(t Todo) string {
+	var parts []string
+	if t.Done {
+		parts = append(parts, "x")
+		// todo.txt only allows a creation date after a completion date
+		if !t.CompletedAt.IsZero() {
+			parts = append(parts, t.CompletedAt.In(time.Local).Format(dueDateLayout))
+		} else if !t.CreatedAt.IsZero() {
+			parts = append(parts, t.CreatedAt.In(time.Local).Format(dueDateLayout))
+		}
+	} else {
+		switch t.Priority {
+		case PriorityHigh:
+			parts = append(parts, "(A)")
+		case PriorityLow:
+			parts = append(parts, "(C)")
+		}
+	}
+	if !t.CreatedAt.IsZero() {
+		parts = append(parts, t.CreatedAt.In(time.Local).Format(dueDateLayout))
+	}
+	parts = append(parts, strings.Join(strings.Fields(t.Task), " "))
+	if t.Category != "" {
+		parts = append(parts, "+"+strings.Join(strings.Fields(t.Category), "-"))
+	}
+	if t.DueDate != "" {
+		parts = append(parts, "due:"+t.DueDate)
+	}
+	return strings.Join(parts, " ")
+}
+
+// lineFingerprint identifies a line's content
+func lineFingerprint(line string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(line)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ExportTodoTxt renders todos as a todo.txt file
+func ExportTodoTxt(todos []Todo) []byte {
+	var buf bytes.Buffer
+	for _, t := range todos {
+		buf.WriteString(FormatTodoTxt(t))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// ImportTodoTxt creates a todo for every line not imported before; the
+// line's fingerprint is its source id
+func ImportTodoTxt(data []byte) (*ImportSummary, error) {
+	summary := &ImportSummary{Format: "todo.txt"}
+	for n, line := range splitLines(data) {
+		t, ok := ParseTodoTxt(line)
+		if !ok {
+			continue
+		}
+		t.SourceID = "todotxt:" + lineFingerprint(line)
+		var existing int64
+		err := db.QueryRow(`SELECT id FROM todos WHERE source_id = ?`, t.SourceID).Scan(&existing)
+		if err == nil {
+			summary.Skipped++
+			continue
+		} else if err != sql.ErrNoRows {
+			return summary, err
+		}
+		if _, err := CreateTodo(&t); err != nil {
+			return summary, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		summary.Imported++
+		if t.Done {
+			summary.Done++
+		}
+	}
+	return summary, nil
+}
+
+func splitLines(data []byte) []string {
+	var lines []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines
+}
+
+// SyncSummary reports what a todo.txt sync changed on each side
+type SyncSummary struct {
+	Added, Updated, Deleted                int // in the vault
+	LinesAdded, LinesUpdated, LinesRemoved int // in the file
+	Conflicts                              []string
+}
+
+// syncRecord is a todo's state at the last sync of a file: the line it
+// was written as and its own rendering
+type syncRecord struct {
+	lineFP, todoFP string
+}
+
+// SyncTodoTxt reconciles a todo.txt file with the vault. Each side is
+// compared against the fingerprints stored at the last sync: a line edited
+// in the file updates its todo, a todo changed in the vault rewrites its
+// line, and deletions on either side are carried over. When both sides
+// changed the same todo the vault wins and the conflict is reported.
+func SyncTodoTxt(path string) (*SyncSummary, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range splitLines(data) {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	records, err := loadSyncRecords(abs)
+	if err != nil {
+		return nil, err
+	}
+	summary := &SyncSummary{}
+
+	// Pair lines with the todos they were synced as: unchanged lines by
+	// fingerprint, then edited lines by their task text
+	owner := make([]int64, len(lines)) // 0 for lines new in the file
+	paired := map[int64]bool{}
+	byLineFP := map[string]int64{}
+	for id, r := range records {
+		byLineFP[r.lineFP] = id
+	}
+	for i, line := range lines {
+		if id, ok := byLineFP[lineFingerprint(line)]; ok && !paired[id] {
+			owner[i] = id
+			paired[id] = true
+		}
+	}
+	before := map[int64]*Todo{} // vault state before this sync
+	for id := range records {
+		if t, err := GetTodo(id); err == nil {
+			before[id] = t
+		}
+	}
+	if err := adoptUnsyncedLines(lines, owner, paired, records, before); err != nil {
+		return nil, err
+	}
+	for i, line := range lines {
+		if owner[i] != 0 {
+			continue
+		}
+		parsed, _ := ParseTodoTxt(line)
+		for id := range records {
+			if t := before[id]; t != nil && !paired[id] && t.Task == parsed.Task {
+				owner[i] = id
+				paired[id] = true
+				break
+			}
+		}
+	}
+	vaultChanged := func(id int64) bool {
+		t := before[id]
+		return t != nil && lineFingerprint(FormatTodoTxt(*t)) != records[id].todoFP
+	}
+
+	// File side first, so completing a todo in the file cascades and spawns
+	// recurrences before the vault side is written back
+	keepLine := map[int]bool{} // lines whose text is already current
+	dropLine := map[int]bool{}
+	for i, line := range lines {
+		id := owner[i]
+		parsed, ok := ParseTodoTxt(line)
+		fileChanged := id == 0 || lineFingerprint(line) != records[id].lineFP
+		switch {
+		case !ok:
+			keepLine[i] = true
+		case id != 0 && before[id] == nil && !fileChanged:
+			// Deleted in the vault
+			dropLine[i] = true
+			summary.LinesRemoved++
+		case id == 0 || before[id] == nil:
+			// New in the file, or edited after being deleted in the vault
+			if id != 0 {
+				summary.Conflicts = append(summary.Conflicts, fmt.Sprintf("%q was deleted in the vault but edited in the file; recreated", parsed.Task))
+			}
+			if _, err := CreateTodo(&parsed); err != nil {
+				return summary, err
+			}
+			owner[i] = parsed.ID
+			keepLine[i] = true
+			summary.Added++
+		case fileChanged && vaultChanged(id):
+			summary.Conflicts = append(summary.Conflicts, fmt.Sprintf("[%d] %s changed on both sides; kept the vault version", id, before[id].Task))
+		case fileChanged:
+			if err := applyTodoTxtLine(before[id], parsed); err != nil {
+				return summary, err
+			}
+			keepLine[i] = true
+			summary.Updated++
+		}
+	}
+
+	// Synced todos whose line is gone were deleted in the file
+	var restored []int64
+	for id := range records {
+		t := before[id]
+		if paired[id] || t == nil {
+			continue
+		}
+		if vaultChanged(id) {
+			summary.Conflicts = append(summary.Conflicts, fmt.Sprintf("[%d] %s was removed from the file but changed in the vault; restored", id, t.Task))
+			restored = append(restored, id)
+			continue
+		}
+		if err := DeleteTodo(id); err != nil {
+			return summary, err
+		}
+		summary.Deleted++
+	}
+
+	// Then write the vault side back
+	all, err := GetTodos(TodoFilter{})
+	if err != nil {
+		return summary, err
+	}
+	current := map[int64]Todo{}
+	for _, t := range all {
+		current[t.ID] = t
+	}
+	var out []string
+	var outOwner []int64
+	for i, line := range lines {
+		if dropLine[i] {
+			continue
+		}
+		id := owner[i]
+		if t, ok := current[id]; ok && !keepLine[i] {
+			if rendered := FormatTodoTxt(t); lineFingerprint(rendered) != records[id].todoFP || lineFingerprint(line) != records[id].lineFP {
+				line = rendered
+				summary.LinesUpdated++
+			}
+		} else if !ok && id != 0 {
+			// Deleted as part of another todo, e.g. a subtask
+			summary.LinesRemoved++
+			continue
+		}
+		out = append(out, line)
+		outOwner = append(outOwner, id)
+	}
+	written := map[int64]bool{}
+	for _, id := range outOwner {
+		written[id] = true
+	}
+	for _, id := range restored {
+		if t, ok := current[id]; ok && !written[id] {
+			out = append(out, FormatTodoTxt(t))
+			outOwner = append(outOwner, id)
+			written[id] = true
+			summary.LinesAdded++
+		}
+	}
+	// Todos the file has never seen, including occurrences spawned above
+	for _, t := range all {
+		if written[t.ID] {
+			continue
+		}
+		out = append(out, FormatTodoTxt(t))
+		outOwner = append(outOwner, t.ID)
+		summary.LinesAdded++
+	}
+
+	newData := []byte(strings.Join(out, "\n"))
+	if len(out) > 0 {
+		newData = append(newData, '\n')
+	}
+	if !bytes.Equal(newData, data) {
+		if err := os.WriteFile(abs, newData, 0644); err != nil {
+			return summary, err
+		}
+	}
+
+	next := map[int64]syncRecord{}
+	for i, id := range outOwner {
+		if t, ok := current[id]; ok {
+			next[id] = syncRecord{lineFP: lineFingerprint(out[i]), todoFP: lineFingerprint(FormatTodoTxt(t))}
+		}
+	}
+	return summary, saveSyncRecords(abs, next)
+}
+
+// adoptUnsyncedLines pairs lines that no sync has recorded with the todos
+// they came from, so the first sync of a file written by ExportTodoTxt or
+// loaded by ImportTodoTxt doesn't duplicate every todo. A line is matched
+// by the source id its import stored, or by being exactly how a todo
+// renders. Adopted todos get a record as if they had just been synced;
+// an imported todo edited since then counts as changed in the vault.
+func adoptUnsyncedLines(lines []string, owner []int64, paired map[int64]bool, records map[int64]syncRecord, before map[int64]*Todo) error {
+	var rendered map[string][]int64 // line fingerprint -> unrecorded todos, oldest first
+	for i, line := range lines {
+		if owner[i] != 0 {
+			continue
+		}
+		fp := lineFingerprint(line)
+		var id int64
+		err := db.QueryRow(`SELECT id FROM todos WHERE source_id = ?`, "todotxt:"+fp).Scan(&id)
+		imported := err == nil
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if !imported {
+			if rendered == nil {
+				all, err := GetTodos(TodoFilter{})
+				if err != nil {
+					return err
+				}
+				rendered = map[string][]int64{}
+				sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+				for _, t := range all {
+					if _, synced := records[t.ID]; !synced {
+						fp := lineFingerprint(FormatTodoTxt(t))
+						rendered[fp] = append(rendered[fp], t.ID)
+					}
+				}
+			}
+			// Identical todos pair with identical lines one by one
+			for ids := rendered[fp]; len(ids) > 0 && id == 0; {
+				if !paired[ids[0]] {
+					id = ids[0]
+				}
+				ids = ids[1:]
+				rendered[fp] = ids
+			}
+		}
+		if _, synced := records[id]; id == 0 || synced || paired[id] {
+			continue
+		}
+		t, err := GetTodo(id)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return err
+		}
+		owner[i], paired[id], before[id] = id, true, t
+		rec := syncRecord{lineFP: fp, todoFP: lineFingerprint(FormatTodoTxt(*t))}
+		if parsed, _ := ParseTodoTxt(line); imported && !sameTodoTxtFields(*t, parsed) {
+			rec.todoFP = ""
+		}
+		records[id] = rec
+	}
+	return nil
+}
+
+// sameTodoTxtFields reports whether a todo still matches a parsed line in
+// everything todo.txt carries
+func sameTodoTxtFields(t, parsed Todo) bool {
+	return t.Task == parsed.Task && t.Done == parsed.Done && t.Category == parsed.Category &&
+		t.DueDate == parsed.DueDate && (t.Done || t.Priority == parsed.Priority)
+}
+
+// applyTodoTxtLine copies the fields todo.txt carries from an edited line
+// onto its todo; recurrence, subtasks and dependencies are kept. A line
+// checked off in the file completes its todo even if it is blocked.
+func applyTodoTxtLine(t *Todo, parsed Todo) error {
+	t.Task = parsed.Task
+	t.Done = parsed.Done
+	if !parsed.Done {
+		// Done lines drop their priority letter, so only pending ones say
+		t.Priority = parsed.Priority
+	}
+	t.Category = parsed.Category
+	if parsed.DueDate != t.DueDate {
+		t.DueDate, t.DuePhrase = parsed.DueDate, ""
+	}
+	return UpdateTodo(t, true)
+}
+
+func loadSyncRecords(file string) (map[int64]syncRecord, error) {
+	rows, err := db.Query(`SELECT todo_id, line_fp, todo_fp FROM todotxt_sync WHERE file = ?`, file)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := map[int64]syncRecord{}
+	for rows.Next() {
+		var id int64
+		var r syncRecord
+		rows.Scan(&id, &r.lineFP, &r.todoFP)
+		records[id] = r
+	}
+	return records, nil
+}
+
+// saveSyncRecords replaces the stored state of a file
+func saveSyncRecords(file string, records map[int64]syncRecord) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM todotxt_sync WHERE file = ?`, file); err != nil {
+		return err
+	}
+	now := time.Now().Format(time.RFC3339)
+	for id, r := range records {
+		_, err := tx.Exec(`INSERT INTO todotxt_sync (file, todo_id, line_fp, todo_fp, synced_at) VALUES (?, ?, ?, ?, ?)`,
+			file, id, r.lineFP, r.todoFP, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTodoTxt(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation(dueDateLayout, s, time.Local)
+		return d
+	}
+	tests := []struct {
+		line string
+		want Todo
+		ok   bool
+	}{
+		{"", Todo{}, false},
+		{"   ", Todo{}, false},
+		{"Call mom", Todo{Task: "Call mom", Priority: PriorityMedium}, true},
+		{"(A) Call the bank +finance due:2026-10-20", Todo{Task: "Call the bank", Priority: PriorityHigh, Category: "finance", DueDate: "2026-10-20"}, true},
+		{"(B) 2026-10-01 plan trip", Todo{Task: "plan trip", Priority: PriorityMedium, CreatedAt: day("2026-10-01")}, true},
+		{"(D) someday", Todo{Task: "someday", Priority: PriorityLow}, true},
+		{"x 2026-10-16 2026-10-01 renew passport", Todo{Task: "renew passport", Done: true, Priority: PriorityMedium, CompletedAt: day("2026-10-16"), CreatedAt: day("2026-10-01")}, true},
+		{"x 2026-10-16 renew passport", Todo{Task: "renew passport", Done: true, Priority: PriorityMedium, CompletedAt: day("2026-10-16")}, true},
+		// Only the first project is the category; other tags stay in the text
+		{"email +work +q4 @laptop id:7", Todo{Task: "email +q4 @laptop id:7", Priority: PriorityMedium, Category: "work"}, true},
+		{"pay due:whenever", Todo{Task: "pay due:whenever", Priority: PriorityMedium}, true},
+		{"xylophone lesson", Todo{Task: "xylophone lesson", Priority: PriorityMedium}, true},
+		{"+work", Todo{Priority: PriorityMedium, Category: "work"}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseTodoTxt(tt.line)
+		if ok != tt.ok || ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTodoTxt(%q) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFormatTodoTxt(t *testing.T) {
+	created := time.Date(2026, 10, 1, 9, 0, 0, 0, time.Local)
+	completed := time.Date(2026, 10, 16, 18, 0, 0, 0, time.Local)
+	tests := []struct {
+		todo Todo
+		want string
+	}{
+		{Todo{Task: "Call mom", Priority: PriorityMedium}, "Call mom"},
+		{Todo{Task: "Call the bank", Priority: PriorityHigh, Category: "finance", DueDate: "2026-10-20"}, "(A) Call the bank +finance due:2026-10-20"},
+		{Todo{Task: "someday", Priority: PriorityLow, CreatedAt: created}, "(C) 2026-10-01 someday"},
+		{Todo{Task: "multi  word\\ttask", Priority: PriorityMedium, Category: "side project"}, "multi word\\ttask +side-project"},
+		// The completion date is when it was completed, not last edited
+		{Todo{Task: "renew passport", Done: true, Priority: PriorityHigh, CreatedAt: created, CompletedAt: completed,
+			UpdatedAt: completed.AddDate(0, 0, 5)}, "x 2026-10-16 2026-10-01 renew passport"},
+	}
+	for _, tt := range tests {
+		if got := FormatTodoTxt(tt.todo); got != tt.want {
+			t.Errorf("FormatTodoTxt(%+v) = %q, want %q", tt.todo, got, tt.want)
+		}
+	}
+}
+
+// writeTodoTxt writes lines to a temporary todo.txt file
+func writeTodoTxt(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "todo.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func countTodos(t *testing.T) int {
+	t.Helper()
+	todos, err := GetTodos(TodoFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(todos)
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return splitLines(data)
+}
+
+func TestSyncAfterExportDoesNotDuplicate(t *testing.T) {
+	openTestDB(t)
+
+	for _, task := range []string{"call bank", "write report", "buy milk", "fix bike"} {
+		if _, err := CreateTodo(&Todo{Task: task}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	todos, _ := GetTodos(TodoFilter{})
+	if _, err := MarkTodoDone(todos[0].ID, true, false); err != nil {
+		t.Fatal(err)
+	}
+	todos, _ = GetTodos(TodoFilter{})
+	path := writeTodoTxt(t, strings.Split(strings.TrimSpace(string(ExportTodoTxt(todos))), "\n")...)
+
+	summary, err := SyncTodoTxt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countTodos(t); n != 4 {
+		t.Errorf("vault has %d todos after syncing its own export, want 4 (summary %+v)", n, *summary)
+	}
+	if lines := readLines(t, path); len(lines) != 4 {
+		t.Errorf("file has %d lines after sync, want 4:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+
+	// The export is now tracked: a later edit in the file updates its todo
+	lines := readLines(t, path)
+	lines[1] = lines[1] + " +errands"
+	os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	if summary, err = SyncTodoTxt(path); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Updated != 1 || summary.Added != 0 || countTodos(t) != 4 {
+		t.Errorf("after editing a line: summary %+v, %d todos; want 1 updated of 4", *summary, countTodos(t))
+	}
+}
+
+func TestSyncAfterExportPairsIdenticalTodos(t *testing.T) {
+	openTestDB(t)
+
+	for _, task := range []string{"water plants", "water plants", "water plants", "buy milk"} {
+		if _, err := CreateTodo(&Todo{Task: task}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	todos, _ := GetTodos(TodoFilter{})
+	path := writeTodoTxt(t, strings.Split(strings.TrimSpace(string(ExportTodoTxt(todos))), "\n")...)
+
+	summary, err := SyncTodoTxt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countTodos(t); n != 4 || summary.Added != 0 {
+		t.Errorf("vault has %d todos after syncing identical lines, want 4 (summary %+v)", n, *summary)
+	}
+	if lines := readLines(t, path); len(lines) != 4 {
+		t.Errorf("file has %d lines after sync, want 4:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+}
+
+func TestSyncAfterImportDoesNotDuplicate(t *testing.T) {
+	openTestDB(t)
+
+	path := writeTodoTxt(t,
+		"(B) 2026-10-01 plan trip +travel",
+		"x 2026-10-10 2026-10-01 renew passport",
+		"(A) dentist due:2026-10-30",
+	)
+	data, _ := os.ReadFile(path)
+	if _, err := ImportTodoTxt(data); err != nil {
+		t.Fatal(err)
+	}
+
+	// Edited in the vault after the import, so the vault wins
+	todos, _ := GetTodos(TodoFilter{Search: "dentist"})
+	dentist := todos[0]
+	dentist.Task = "dentist appointment"
+	if err := UpdateTodo(&dentist, false); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := SyncTodoTxt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Added != 0 || summary.LinesAdded != 0 || countTodos(t) != 3 {
+		t.Fatalf("first sync after import: summary %+v, %d todos; want nothing added to 3", *summary, countTodos(t))
+	}
+	lines := readLines(t, path)
+	if len(lines) != 3 {
+		t.Fatalf("file has %d lines, want 3:\n%s", len(lines), strings.Join(lines, "\n"))
+	}
+	// Untouched lines keep their exact text, including the completion date
+	if lines[0] != "(B) 2026-10-01 plan trip +travel" || lines[1] != "x 2026-10-10 2026-10-01 renew passport" {
+		t.Errorf("unchanged lines were rewritten: %q", lines[:2])
+	}
+	if !strings.Contains(lines[2], "dentist appointment") {
+		t.Errorf("vault edit not written back: %q", lines[2])
+	}
+}
+
+func TestCompletionDateSurvivesEdits(t *testing.T) {
+	openTestDB(t)
+
+	todo, err := CreateTodo(&Todo{Task: "renew passport"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MarkTodoDone(todo.ID, true, false); err != nil {
+		t.Fatal(err)
+	}
+	done, _ := GetTodo(todo.ID)
+	if done.CompletedAt.IsZero() {
+		t.Fatal("completing a todo did not record when")
+	}
+
+	// Pretend it was completed a while ago, then edit it
+	completed := time.Date(2026, 1, 2, 12, 0, 0, 0, time.Local)
+	db.Exec(`UPDATE todos SET completed_at = ? WHERE id = ?`, completed.Format(time.RFC3339), todo.ID)
+	edited, _ := GetTodo(todo.ID)
+	edited.Task = "renew passport (done at the embassy)"
+	if err := UpdateTodo(edited, false); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := GetTodo(todo.ID)
+	if !strings.HasPrefix(FormatTodoTxt(*after), "x 2026-01-02 ") {
+		t.Errorf("editing a done todo changed its completion date: %q", FormatTodoTxt(*after))
+	}
+
+	// Reopening clears it
+	if _, err := MarkTodoDone(todo.ID, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if reopened, _ := GetTodo(todo.ID); !reopened.CompletedAt.IsZero() {
+		t.Errorf("reopened todo still has completion time %v", reopened.CompletedAt)
+	}
+}
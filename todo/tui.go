@@ -0,0 +1,768 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// `vault tui`: a full-screen interface with the web UI's Vault and Todos
+// tabs. Every change goes through the same functions as the CLI and the
+// API, and the lists are reloaded from the database after each one.
+
+const (
+	tabVault = iota
+	tabTodos
+)
+
+// tuiTypes is the vault type filter cycle, "" meaning all types
+var tuiTypes = []ContentType{"", ContentTypeArticle, ContentTypeYouTube, ContentTypeTweet, ContentTypeTikTok, ContentTypeNote}
+
+// tuiStatuses is the todo status filter cycle
+var tuiStatuses = []string{"pending", "all", "done"}
+
+// tuiPrompt is the one-line input at the bottom of the screen
+type tuiPrompt struct {
+	label    string
+	text     []rune
+	cursor   int
+	onChange func(text string) // live filtering
+	onSubmit func(text string)
+	onCancel func()
+}
+
+type tui struct {
+	term *terminal
+	tab  int
+	quit bool
+
+	todos      []todoTreeRow
+	statusIdx  int
+	items      []VaultItem
+	typeIdx    int
+	archived   bool
+	resurface  *VaultItem
+	filter     [2]string
+	selected   [2]int
+	offset     [2]int
+	prompt     *tuiPrompt
+	confirm    func() // run when the pending y/n question is answered yes
+	message    string
+	messageErr bool
+}
+
+func handleTUI(a *cmdArgs) {
+	term, err := openTerminal()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	defer term.Close()
+
+	t := &tui{term: term}
+	if a.Has("--todos") {
+		t.tab = tabTodos
+	}
+	t.reload()
+	t.resurface, _ = GetRandomVaultItem()
+	for !t.quit {
+		t.draw()
+		k, err := term.readKey()
+		if err != nil {
+			return
+		}
+		t.handleKey(k)
+	}
+}
+
+// reload reads both lists again, keeping the selected rows where they are
+func (t *tui) reload() {
+	keep := [2]int64{t.selectedItemID(), t.selectedTodoID()}
+
+	todos, err := GetTodos(TodoFilter{Status: tuiStatuses[t.statusIdx]})
+	if err != nil {
+		t.fail(err)
+	}
+	t.todos = todoTree(todos)
+
+	filter := VaultFilter{ContentType: string(tuiTypes[t.typeIdx])}
+	if t.archived {
+		archived := true
+		filter.Archived = &archived
+	}
+	if t.items, err = GetVaultItems(filter); err != nil {
+		t.fail(err)
+	}
+
+	for tab, id := range keep {
+		if id == 0 {
+			continue
+		}
+		for i, row := range t.visible(tab) {
+			if t.rowID(tab, row) == id {
+				t.selected[tab] = i
+			}
+		}
+	}
+	t.clampSelection()
+}
+
+// visible returns the indexes of the rows matching the tab's filter
+func (t *tui) visible(tab int) []int {
+	n := len(t.items)
+	if tab == tabTodos {
+		n = len(t.todos)
+	}
+	var rows []int
+	for i := 0; i < n; i++ {
+		if _, _, ok := fuzzyMatch(t.filter[tab], t.rowText(tab, i)); ok {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
+
+func (t *tui) rowText(tab, i int) string {
+	if tab == tabTodos {
+		return todoLine(todoTreeRow{Todo: t.todos[i].Todo})
+	}
+	return itemLine(&t.items[i])
+}
+
+func (t *tui) rowID(tab, i int) int64 {
+	if tab == tabTodos {
+		return t.todos[i].Todo.ID
+	}
+	return t.items[i].ID
+}
+
+// current returns the index of the selected row in the tab's list, or -1
+func (t *tui) current(tab int) int {
+	rows := t.visible(tab)
+	if len(rows) == 0 {
+		return -1
+	}
+	return rows[min(t.selected[tab], len(rows)-1)]
+}
+
+func (t *tui) selectedTodo() *Todo {
+	if i := t.current(tabTodos); i >= 0 {
+		return &t.todos[i].Todo
+	}
+	return nil
+}
+
+func (t *tui) selectedItem() *VaultItem {
+	if i := t.current(tabVault); i >= 0 {
+		return &t.items[i]
+	}
+	return nil
+}
+
+func (t *tui) selectedTodoID() int64 {
+	if todo := t.selectedTodo(); todo != nil {
+		return todo.ID
+	}
+	return 0
+}
+
+func (t *tui) selectedItemID() int64 {
+	if item := t.selectedItem(); item != nil {
+		return item.ID
+	}
+	return 0
+}
+
+func (t *tui) clampSelection() {
+	for tab := range t.selected {
+		n := len(t.visible(tab))
+		t.selected[tab] = max(min(t.selected[tab], n-1), 0)
+	}
+}
+
+// itemLine renders a vault item as one list row
+func itemLine(item *VaultItem) string {
+	title := firstNonEmpty(item.MetaTitle, item.Title, truncateStr(item.Content, 80))
+	line := fmt.Sprintf("%s %d. %s", getTypeIcon(item.ContentType), item.ID, title)
+	if item.Pinned {
+		line += " 📌"
+	}
+	switch item.MetaStatus {
+	case MetaStatusPending:
+		line += " [fetching]"
+	case MetaStatusFailed:
+		line += " [fetch failed]"
+	}
+	for _, tag := range item.Tags {
+		line += " #" + tag.Name
+	}
+	return line
+}
+
+func (t *tui) info(format string, args ...interface{}) {
+	t.message, t.messageErr = fmt.Sprintf(format, args...), false
+}
+
+func (t *tui) fail(err error) {
+	t.message, t.messageErr = "Error: "+err.Error(), true
+}
+
+// ask shows a prompt; the text starts out as initial
+func (t *tui) ask(label, initial string, submit func(string)) {
+	text := []rune(initial)
+	t.prompt = &tuiPrompt{label: label, text: text, cursor: len(text), onSubmit: submit}
+}
+
+// Drawing
+
+func (t *tui) draw() {
+	rows, cols := t.term.size()
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	line := func(s string) {
+		b.WriteString(s + "\x1b[0m\x1b[K\r\n")
+	}
+
+	// Tabs, with the active filters on the right
+	tabs := ""
+	for tab, name := range []string{"Vault", "Todos"} {
+		n := len(t.items)
+		if tab == tabTodos {
+			n = len(t.todos)
+		}
+		label := fmt.Sprintf(" %d %s (%d) ", tab+1, name, n)
+		if tab == t.tab {
+			tabs += "\x1b[1;7m" + label + "\x1b[0m "
+		} else {
+			tabs += "\x1b[90m" + label + "\x1b[0m "
+		}
+	}
+	var filters []string
+	if t.tab == tabTodos {
+		filters = append(filters, tuiStatuses[t.statusIdx])
+	} else {
+		if typ := tuiTypes[t.typeIdx]; typ != "" {
+			filters = append(filters, string(typ))
+		}
+		if t.archived {
+			filters = append(filters, "archived")
+		}
+	}
+	if f := t.filter[t.tab]; f != "" {
+		filters = append(filters, "/"+f)
+	}
+	right := strings.Join(filters, " · ")
+	pad := max(cols-visibleWidth(tabs)-visibleWidth(right)-1, 1)
+	line(tabs + strings.Repeat(" ", pad) + "\x1b[90m" + fitWidth(right, cols/2) + "\x1b[0m")
+	line("\x1b[90m" + strings.Repeat("─", cols))
+	used := 2
+
+	// Resurface panel, like the banner above the web vault list
+	if t.tab == tabVault && t.resurface != nil {
+		r := t.resurface
+		line("\x1b[35m ↻ From your vault: \x1b[0m" + fitWidth(itemLine(r), cols-21))
+		detail := firstNonEmpty(r.URL, truncateStr(r.Content, 200))
+		if r.MetaAuthor != "" {
+			detail = "by " + r.MetaAuthor + " · " + detail
+		}
+		line("\x1b[90m   " + fitWidth(detail, cols-4))
+		line("")
+		used += 3
+	}
+
+	listRows := max(rows-used-2, 1)
+	visible := t.visible(t.tab)
+	sel := t.selected[t.tab]
+	if sel < t.offset[t.tab] {
+		t.offset[t.tab] = sel
+	}
+	if sel >= t.offset[t.tab]+listRows {
+		t.offset[t.tab] = sel - listRows + 1
+	}
+	off := t.offset[t.tab]
+	for r := 0; r < listRows; r++ {
+		i := off + r
+		if i >= len(visible) {
+			if r == 0 {
+				line("\x1b[90m  " + t.emptyText())
+			} else {
+				line("")
+			}
+			continue
+		}
+		text, style := t.renderRow(visible[i])
+		text = fitWidth(" "+text, cols-1)
+		if i == sel {
+			line("\x1b[7m" + text + strings.Repeat(" ", max(cols-1-visibleWidth(text), 0)))
+		} else {
+			line(style + text)
+		}
+	}
+
+	// Prompt or message, then the keys
+	switch {
+	case t.prompt != nil:
+		p := t.prompt
+		before, after := p.visibleText(cols - 1)
+		line("\x1b[1;36m" + p.label + "\x1b[0m " + before + "\x1b[7m \x1b[0m" + after)
+	case t.message != "" && t.messageErr:
+		line("\x1b[31m" + fitWidth(t.message, cols-1))
+	default:
+		line("\x1b[32m" + fitWidth(t.message, cols-1))
+	}
+	b.WriteString("\x1b[90m" + fitWidth(t.keyHelp(), cols-1) + "\x1b[0m\x1b[K\x1b[J")
+	t.term.write(b.String())
+}
+
+// visibleText is the input on either side of the cursor, cut to fit the
+// prompt line in width columns. Long input scrolls to keep the cursor in
+// view, with some of what follows it when the cursor isn't at the end.
+func (p *tuiPrompt) visibleText(width int) (before, after string) {
+	before, after = string(p.text[:p.cursor]), string(p.text[p.cursor:])
+	room := width - visibleWidth(p.label) - 2 // the space and the cursor
+	if visibleWidth(before)+visibleWidth(after) <= room {
+		return before, after
+	}
+	left := min(visibleWidth(before), room-min(visibleWidth(after), room/4))
+	return fitWidthLeft(before, left), fitWidth(after, room-left)
+}
+
+// renderRow returns a row's text and the style for it when unselected
+func (t *tui) renderRow(i int) (string, string) {
+	if t.tab == tabVault {
+		item := &t.items[i]
+		if item.Archived {
+			return itemLine(item), "\x1b[90m"
+		}
+		return itemLine(item), ""
+	}
+	row := t.todos[i]
+	style := ""
+	switch {
+	case row.Todo.Done:
+		style = "\x1b[90m"
+	case row.Todo.Blocked:
+		style = "\x1b[33m"
+	case isOverdue(row.Todo, time.Now()):
+		style = "\x1b[31m"
+	}
+	if t.filter[tabTodos] != "" {
+		row.Prefix = "" // the tree makes no sense with rows missing
+	}
+	return todoLine(row), style
+}
+
+func (t *tui) emptyText() string {
+	switch {
+	case t.filter[t.tab] != "":
+		return "Nothing matches the filter (esc clears it)"
+	case t.tab == tabTodos:
+		return "No todos here. Press a to add one."
+	}
+	return "No items in vault. Press a to save a link or note."
+}
+
+func (t *tui) keyHelp() string {
+	switch {
+	case t.prompt != nil:
+		return "enter: ok · esc: cancel"
+	case t.confirm != nil:
+		return "y: yes · n: no"
+	case t.tab == tabTodos:
+		return "a/A add/sub · e edit · space done · p prio · c cat · d due · r repeat · D del · s status · / filter · E editor · q quit"
+	}
+	return "a add · e title · t tags · p pin · x archive · o open · D del · f type · v archived · r resurface · / filter · q quit"
+}
+
+// isOverdue reports whether a pending todo is past its due date
+func isOverdue(todo Todo, now time.Time) bool {
+	due, layout, ok := parseDueDate(todo.DueDate)
+	if !ok || todo.Done {
+		return false
+	}
+	if layout == dueDateLayout {
+		return due.Before(startOfDay(now))
+	}
+	return due.Before(now)
+}
+
+// Keys
+
+func (t *tui) handleKey(k key) {
+	if t.prompt != nil {
+		t.handlePromptKey(k)
+		return
+	}
+	if t.confirm != nil {
+		confirm := t.confirm
+		t.confirm = nil
+		if k.code == keyRune && (k.r == 'y' || k.r == 'Y') {
+			confirm()
+		} else {
+			t.info("Cancelled")
+		}
+		return
+	}
+	t.message = ""
+
+	rows := len(t.visible(t.tab))
+	page := 10
+	if r, _ := t.term.size(); r > 8 {
+		page = r - 8
+	}
+	switch {
+	case k.code == keyCtrl && k.r == 'c', k.code == keyRune && k.r == 'q':
+		t.quit = true
+	case k.code == keyTab, k.code == keyRune && (k.r == 'h' || k.r == 'l'), k.code == keyLeft, k.code == keyRight:
+		t.tab = 1 - t.tab
+	case k.code == keyRune && k.r == '1':
+		t.tab = tabVault
+	case k.code == keyRune && k.r == '2':
+		t.tab = tabTodos
+	case k.code == keyDown, k.code == keyRune && k.r == 'j', k.code == keyCtrl && k.r == 'n':
+		t.selected[t.tab] = min(t.selected[t.tab]+1, max(rows-1, 0))
+	case k.code == keyUp, k.code == keyRune && k.r == 'k', k.code == keyCtrl && k.r == 'p':
+		t.selected[t.tab] = max(t.selected[t.tab]-1, 0)
+	case k.code == keyPageDown, k.code == keyCtrl && k.r == 'd':
+		t.selected[t.tab] = min(t.selected[t.tab]+page, max(rows-1, 0))
+	case k.code == keyPageUp, k.code == keyCtrl && k.r == 'u':
+		t.selected[t.tab] = max(t.selected[t.tab]-page, 0)
+	case k.code == keyHome, k.code == keyRune && k.r == 'g':
+		t.selected[t.tab] = 0
+	case k.code == keyEnd, k.code == keyRune && k.r == 'G':
+		t.selected[t.tab] = max(rows-1, 0)
+	case k.code == keyCtrl && k.r == 'l':
+		t.reload()
+	case k.code == keyEsc:
+		t.filter[t.tab] = ""
+		t.clampSelection()
+	case k.code == keyRune && k.r == '/':
+		t.startFilter()
+	case k.code == keyRune && k.r == 'E':
+		t.editInEditor()
+	case t.tab == tabTodos:
+		t.handleTodoKey(k)
+	default:
+		t.handleVaultKey(k)
+	}
+}
+
+func (t *tui) handlePromptKey(k key) {
+	p := t.prompt
+	changed := false
+	switch {
+	case k.code == keyEnter:
+		t.prompt = nil
+		p.onSubmit(strings.TrimSpace(string(p.text)))
+		return
+	case k.code == keyEsc, k.code == keyCtrl && (k.r == 'c' || k.r == 'g'):
+		t.prompt = nil
+		if p.onCancel != nil {
+			p.onCancel()
+		}
+		return
+	case k.code == keyLeft, k.code == keyCtrl && k.r == 'b':
+		p.cursor = max(p.cursor-1, 0)
+	case k.code == keyRight, k.code == keyCtrl && k.r == 'f':
+		p.cursor = min(p.cursor+1, len(p.text))
+	case k.code == keyHome, k.code == keyCtrl && k.r == 'a':
+		p.cursor = 0
+	case k.code == keyEnd, k.code == keyCtrl && k.r == 'e':
+		p.cursor = len(p.text)
+	case k.code == keyBackspace:
+		if p.cursor > 0 {
+			p.text = append(p.text[:p.cursor-1], p.text[p.cursor:]...)
+			p.cursor--
+			changed = true
+		}
+	case k.code == keyCtrl && k.r == 'u':
+		p.text, p.cursor, changed = p.text[p.cursor:], 0, true
+	case k.code == keyRune && unicode.IsPrint(k.r):
+		p.text = append(p.text[:p.cursor], append([]rune{k.r}, p.text[p.cursor:]...)...)
+		p.cursor++
+		changed = true
+	}
+	if changed && p.onChange != nil {
+		p.onChange(string(p.text))
+	}
+}
+
+// startFilter filters the list as the user types; esc restores the
+// previous filter
+func (t *tui) startFilter() {
+	tab, prev := t.tab, t.filter[t.tab]
+	t.ask("/", prev, func(string) {})
+	t.prompt.onChange = func(text string) {
+		t.filter[tab] = text
+		t.selected[tab], t.offset[tab] = 0, 0
+	}
+	t.prompt.onCancel = func() {
+		t.filter[tab] = prev
+		t.clampSelection()
+	}
+}
+
+// editInEditor opens the selection in $EDITOR, as `vault todo edit` does
+func (t *tui) editInEditor() {
+	todo, item := t.selectedTodo(), t.selectedItem()
+	if t.tab == tabTodos && todo == nil || t.tab == tabVault && item == nil {
+		return
+	}
+	t.term.suspend()
+	if t.tab == tabTodos {
+		editTodo(todo.ID, false, frontMatter{})
+	} else {
+		editItem(item.ID, frontMatter{}, nil)
+	}
+	t.term.resume()
+	t.reload()
+}
+
+// Todos
+
+func (t *tui) handleTodoKey(k key) {
+	if k.code != keyRune && k.code != keyEnter {
+		return
+	}
+	if k.code == keyRune && k.r == 'a' {
+		t.ask("New todo:", "", func(task string) { t.addTodo(task, nil) })
+		return
+	}
+	if k.code == keyRune && k.r == 's' {
+		t.statusIdx = (t.statusIdx + 1) % len(tuiStatuses)
+		t.reload()
+		t.info("Showing %s todos", tuiStatuses[t.statusIdx])
+		return
+	}
+
+	todo := t.selectedTodo()
+	if todo == nil {
+		return
+	}
+	prev := *todo
+	switch {
+	case k.code == keyEnter, k.r == ' ', k.r == 'x':
+		next, err := MarkTodoDone(prev.ID, !prev.Done, false)
+		switch {
+		case err != nil:
+			t.fail(err)
+		case prev.Done:
+			t.info("Undone: [%d] %s", prev.ID, prev.Task)
+		case next != nil:
+			t.info("Done: [%d] %s · next due %s", prev.ID, prev.Task, FormatDue(next.DueDate))
+		default:
+			t.info("Done: [%d] %s", prev.ID, prev.Task)
+		}
+		t.reload()
+	case k.r == 'A':
+		t.ask(fmt.Sprintf("New subtask of #%d:", prev.ID), "", func(task string) { t.addTodo(task, &prev) })
+	case k.r == 'e':
+		t.ask("Task:", prev.Task, func(v string) { t.updateTodo(&prev, "task", v) })
+	case k.r == 'p':
+		next := map[Priority]Priority{PriorityLow: PriorityMedium, PriorityMedium: PriorityHigh, PriorityHigh: PriorityLow}
+		t.updateTodo(&prev, "priority", string(next[prev.Priority]))
+	case k.r == 'c':
+		t.ask("Category:", prev.Category, func(v string) { t.updateTodo(&prev, "category", v) })
+	case k.r == 'd':
+		t.ask("Due (empty clears):", firstNonEmpty(prev.DuePhrase, prev.DueDate), func(v string) { t.updateTodo(&prev, "due", v) })
+	case k.r == 'r':
+		t.ask("Repeat (empty clears):", prev.Recurrence, func(v string) { t.updateTodo(&prev, "recurrence", v) })
+	case k.r == 'D':
+		question := fmt.Sprintf("Delete [%d] %s", prev.ID, prev.Task)
+		if prev.SubtasksTotal > 0 {
+			question += fmt.Sprintf(" and its %d subtasks", prev.SubtasksTotal)
+		}
+		t.info("%s? (y/n)", question)
+		t.confirm = func() {
+			if err := DeleteTodo(prev.ID); err != nil {
+				t.fail(err)
+				return
+			}
+			t.info("Removed: [%d] %s", prev.ID, prev.Task)
+			t.reload()
+		}
+	}
+}
+
+// addTodo creates a todo, under parent when it is set
+func (t *tui) addTodo(task string, parent *Todo) {
+	if task == "" {
+		return
+	}
+	// Added in the current context like `vault todo add`; subtasks take
+	// their parent's
+	todo := &Todo{Task: task, Priority: PriorityMedium}
+	if parent != nil {
+		todo.ParentID, todo.Category = parent.ID, parent.Category
+	} else {
+		todo.Context = currentContext()
+	}
+	if _, err := CreateTodo(todo); err != nil {
+		t.fail(err)
+		return
+	}
+	t.info("Added: [%d] %s", todo.ID, todo.Task)
+	t.reload()
+	for i, row := range t.visible(tabTodos) {
+		if t.todos[row].Todo.ID == todo.ID {
+			t.selected[tabTodos] = i
+		}
+	}
+}
+
+// updateTodo sets one field, validated like `vault todo edit --<field>`
+func (t *tui) updateTodo(prev *Todo, field, value string) {
+	updated, err := applyTodoFields(prev, frontMatter{field: value})
+	if err == nil {
+		err = UpdateTodo(updated, false)
+	}
+	if err != nil {
+		t.fail(err)
+		return
+	}
+	t.info("Updated: [%d] %s", updated.ID, updated.Task)
+	t.reload()
+}
+
+// Vault
+
+func (t *tui) handleVaultKey(k key) {
+	if k.code != keyRune && k.code != keyEnter {
+		return
+	}
+	switch k.r {
+	case 'a':
+		t.ask("Save URL or note:", "", t.saveItem)
+		return
+	case 'f':
+		t.typeIdx = (t.typeIdx + 1) % len(tuiTypes)
+		t.reload()
+		t.info("Showing %s", firstNonEmpty(string(tuiTypes[t.typeIdx]), "all types"))
+		return
+	case 'v':
+		t.archived = !t.archived
+		t.reload()
+		if t.archived {
+			t.info("Showing archived items")
+		} else {
+			t.info("Showing the vault")
+		}
+		return
+	case 'r':
+		item, err := GetRandomVaultItem()
+		if err != nil {
+			t.info("No items in vault to resurface")
+			return
+		}
+		t.resurface = item
+		return
+	case 'R':
+		t.resurface = nil
+		return
+	}
+
+	item := t.selectedItem()
+	if item == nil {
+		return
+	}
+	prev := *item
+	title := firstNonEmpty(prev.MetaTitle, prev.Title, truncateStr(prev.Content, 40))
+	switch {
+	case k.code == keyEnter, k.r == 'o':
+		if prev.URL == "" {
+			t.info("Nothing to open: item has no URL")
+		} else if err := openURL(prev.URL); err != nil {
+			t.fail(err)
+		} else {
+			t.info("Opened %s", prev.URL)
+		}
+	case k.r == 'e':
+		t.ask("Title:", firstNonEmpty(prev.Title, prev.MetaTitle), func(v string) { t.updateItem(&prev, "title", v) })
+	case k.r == 't':
+		names := make([]string, len(prev.Tags))
+		for i, tag := range prev.Tags {
+			names[i] = tag.Name
+		}
+		t.ask("Tags:", strings.Join(names, ","), func(v string) { t.updateItem(&prev, "tags", v) })
+	case k.r == 'p':
+		t.updateItem(&prev, "pinned", strconv.FormatBool(!prev.Pinned))
+	case k.r == 'x':
+		t.updateItem(&prev, "archived", strconv.FormatBool(!prev.Archived))
+	case k.r == 'D':
+		t.info("Delete [%d] %s? (y/n)", prev.ID, title)
+		t.confirm = func() {
+			if err := DeleteVaultItem(prev.ID); err != nil {
+				t.fail(err)
+				return
+			}
+			if t.resurface != nil && t.resurface.ID == prev.ID {
+				t.resurface = nil
+			}
+			t.info("Deleted [%d] %s", prev.ID, title)
+			t.reload()
+		}
+	}
+}
+
+// saveItem saves a link or note, as `vault item save` does; metadata is
+// fetched in the background
+func (t *tui) saveItem(content string) {
+	if content == "" {
+		return
+	}
+	contentType := DetectContentType(content)
+	item := &VaultItem{ContentType: contentType, Content: content}
+	if contentType == ContentTypeNote {
+		item.Title = content
+	} else {
+		item.URL = content
+		item.MetaStatus = MetaStatusPending
+	}
+	saved, err := CreateVaultItem(item, nil)
+	if err != nil {
+		t.fail(err)
+		return
+	}
+	switch {
+	case saved.Duplicate:
+		t.info("Already saved [%d]", saved.ID)
+	case saved.URL != "":
+		if err := EnqueueFetch(saved.ID, false); err != nil {
+			t.fail(err)
+			return
+		}
+		spawnFetchWorker()
+		t.info("Saved [%d] %s, fetching metadata...", saved.ID, saved.ContentType)
+	default:
+		t.info("Saved note [%d]", saved.ID)
+	}
+	t.reload()
+}
+
+// updateItem sets one field, validated like `vault item edit`
+func (t *tui) updateItem(prev *VaultItem, field, value string) {
+	edit, err := applyItemFields(prev, frontMatter{field: value}, prev.Content)
+	if err == nil {
+		err = saveItemEdit(edit)
+	}
+	if err != nil {
+		t.fail(err)
+		return
+	}
+	title := firstNonEmpty(edit.item.MetaTitle, edit.item.Title, truncateStr(edit.item.Content, 40))
+	switch {
+	case field == "pinned" && edit.item.Pinned:
+		t.info("Pinned [%d] %s", prev.ID, title)
+	case field == "pinned":
+		t.info("Unpinned [%d] %s", prev.ID, title)
+	case field == "archived" && edit.item.Archived:
+		t.info("Archived [%d] %s", prev.ID, title)
+	case field == "archived":
+		t.info("Unarchived [%d] %s", prev.ID, title)
+	default:
+		t.info("Updated [%d] %s", prev.ID, title)
+	}
+	t.reload()
+}
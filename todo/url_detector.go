@@ -1,73 +1,33 @@
 package main
 
 import (
-	"net/url"
-	"regexp"
 	"strings"
 )
 
-var (
-	twitterPattern = regexp.MustCompile(`(?i)^https?://(?:www\.)?(twitter\.com|x\.com)/\w+/status/\d+`)
-	tiktokPattern  = regexp.MustCompile(`(?i)^https?://(?:www\.|vm\.)?tiktok\.com/`)
-	youtubePattern = regexp.MustCompile(`(?i)^https?://(?:www\.)?(youtube\.com/watch\?v=|youtu\.be/|youtube\.com/shorts/)`)
-)
-
-// DetectContentType determines the content type from input
+// DetectContentType determines the content type from input by asking the
+// provider registry; anything that isn't an http(s) URL is a note
 func DetectContentType(input string) ContentType {
 	input = strings.TrimSpace(input)
 
-	// Check if it's a URL
-	parsedURL, err := url.Parse(input)
-	if err != nil || parsedURL.Scheme == "" {
-		return ContentTypeNote
-	}
-
-	// Match against known patterns
-	switch {
-	case twitterPattern.MatchString(input):
-		return ContentTypeTweet
-	case tiktokPattern.MatchString(input):
-		return ContentTypeTikTok
-	case youtubePattern.MatchString(input):
-		return ContentTypeYouTube
-	default:
-		if strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://") {
-			return ContentTypeArticle
-		}
+	p := ProviderFor(input)
+	if p == nil {
 		return ContentTypeNote
 	}
+	return p.ContentType()
 }
 
-// ExtractYouTubeID extracts video ID from YouTube URLs
-func ExtractYouTubeID(urlStr string) string {
-	// Handle youtube.com/watch?v=ID
-	if strings.Contains(urlStr, "youtube.com/watch") {
-		u, _ := url.Parse(urlStr)
-		return u.Query().Get("v")
-	}
-	// Handle youtu.be/ID
-	if strings.Contains(urlStr, "youtu.be/") {
-		parts := strings.Split(urlStr, "youtu.be/")
-		if len(parts) > 1 {
-			id := strings.Split(parts[1], "?")[0]
-			return strings.TrimSuffix(id, "/")
-		}
-	}
-	// Handle youtube.com/shorts/ID
-	if strings.Contains(urlStr, "/shorts/") {
-		parts := strings.Split(urlStr, "/shorts/")
-		if len(parts) > 1 {
-			return strings.Split(parts[1], "?")[0]
-		}
+// DetectLink resolves short links before detection so the content type
+// reflects the destination. It returns the resolved URL, which is the
+// trimmed input for notes or when the short link can't be resolved. It
+// can block on the network; saves leave resolution to the fetch job.
+func DetectLink(input string) (string, ContentType, error) {
+	input = strings.TrimSpace(input)
+	if ProviderFor(input) == nil {
+		return input, ContentTypeNote, nil
 	}
-	return ""
-}
-
-// ExtractTweetID extracts tweet ID from Twitter/X URLs
-func ExtractTweetID(urlStr string) string {
-	matches := regexp.MustCompile(`/status/(\d+)`).FindStringSubmatch(urlStr)
-	if len(matches) > 1 {
-		return matches[1]
+	resolved, err := ResolveShortLink(input)
+	if err != nil || ProviderFor(resolved) == nil {
+		return input, DetectContentType(input), err
 	}
-	return ""
+	return resolved, DetectContentType(resolved), nil
 }
@@ -1,35 +1,28 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"unicode/utf8"
 )
 
-func handleVaultSave() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: vault save <url-or-text> [-t tags] [-p]")
+func handleVaultSave(a *cmdArgs) {
+	content := a.Text()
+	if content == "" {
+		a.Usage()
 		return
 	}
+	tags := splitTags(a.Value("-t"))
+	pinned := a.Has("-p")
+	keepHTML := a.Has("--html")
 
-	content := os.Args[2]
-	tags := []string{}
-	pinned := false
-
-	for i := 3; i < len(os.Args); i++ {
-		switch os.Args[i] {
-		case "-t", "--tags":
-			if i+1 < len(os.Args) {
-				tags = strings.Split(os.Args[i+1], ",")
-				i++
-			}
-		case "-p", "--pin":
-			pinned = true
-		}
-	}
-
-	// Detect type
+	// Detect type. Short links are followed by the fetch job so saving
+	// never waits on the network.
 	contentType := DetectContentType(content)
 
 	item := &VaultItem{
@@ -38,20 +31,11 @@ func handleVaultSave() {
 		Pinned:      pinned,
 	}
 
-	// Set URL and fetch metadata for links
+	// Metadata for links is fetched in the background
 	if contentType != ContentTypeNote {
-		item.URL = content
+		item.URL = strings.TrimSpace(content)
+		item.MetaStatus = MetaStatusPending
 		fmt.Printf("Detected: %s\n", contentType)
-		fmt.Println("Fetching metadata...")
-
-		meta := FetchMetadata(content, contentType)
-		if meta != nil {
-			item.MetaTitle = meta.Title
-			item.MetaDescription = meta.Description
-			item.MetaThumbnail = meta.Thumbnail
-			item.MetaAuthor = meta.Author
-			item.MetaSiteName = meta.SiteName
-		}
 	}
 
 	saved, err := CreateVaultItem(item, tags)
@@ -60,6 +44,31 @@ func handleVaultSave() {
 		return
 	}
 
+	if saved.Duplicate {
+		fmt.Printf("\nAlready saved [%d] %s\n", saved.ID, saved.ContentType)
+		if title := firstNonEmpty(saved.Title, saved.MetaTitle); title != "" {
+			fmt.Printf("  %s\n", title)
+		}
+		if len(saved.Tags) > 0 {
+			names := make([]string, len(saved.Tags))
+			for i, t := range saved.Tags {
+				names[i] = t.Name
+			}
+			fmt.Printf("  Tags: %s\n", strings.Join(names, ", "))
+		}
+		return
+	}
+
+	if saved.URL != "" {
+		if err := EnqueueFetch(saved.ID, keepHTML); err != nil {
+			fmt.Println("Error queueing metadata fetch:", err)
+		} else if err := spawnFetchWorker(); err != nil {
+			fmt.Println("Metadata will be fetched by the next `vault worker` or `vault server` run")
+		} else {
+			fmt.Println("Fetching metadata in the background...")
+		}
+	}
+
 	fmt.Printf("\nSaved [%d] %s\n", saved.ID, saved.ContentType)
 	if saved.MetaTitle != "" {
 		fmt.Printf("  %s\n", saved.MetaTitle)
@@ -75,27 +84,14 @@ func handleVaultSave() {
 	}
 }
 
-func handleVaultNote() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: vault note <text> [-t tags] [-p]")
+func handleVaultNote(a *cmdArgs) {
+	content := a.Text()
+	if content == "" {
+		a.Usage()
 		return
 	}
-
-	content := os.Args[2]
-	tags := []string{}
-	pinned := false
-
-	for i := 3; i < len(os.Args); i++ {
-		switch os.Args[i] {
-		case "-t", "--tags":
-			if i+1 < len(os.Args) {
-				tags = strings.Split(os.Args[i+1], ",")
-				i++
-			}
-		case "-p", "--pin":
-			pinned = true
-		}
-	}
+	tags := splitTags(a.Value("-t"))
+	pinned := a.Has("-p")
 
 	item := &VaultItem{
 		ContentType: ContentTypeNote,
@@ -116,33 +112,19 @@ func handleVaultNote() {
 	}
 }
 
-func handleVaultList() {
-	filter := VaultFilter{}
-
-	for i := 2; i < len(os.Args); i++ {
-		switch os.Args[i] {
-		case "-t", "--type":
-			if i+1 < len(os.Args) {
-				filter.ContentType = os.Args[i+1]
-				i++
-			}
-		case "--tags":
-			if i+1 < len(os.Args) {
-				filter.TagNames = strings.Split(os.Args[i+1], ",")
-				i++
-			}
-		case "-s", "--search":
-			if i+1 < len(os.Args) {
-				filter.Search = os.Args[i+1]
-				i++
-			}
-		case "--pinned":
-			p := true
-			filter.Pinned = &p
-		case "--archived":
-			a := true
-			filter.Archived = &a
-		}
+func handleVaultList(a *cmdArgs) {
+	filter := VaultFilter{
+		ContentType: a.Value("-t"),
+		TagNames:    splitTags(a.Value("--tags")),
+		Search:      a.Value("-s"),
+	}
+	if a.Has("--pinned") {
+		p := true
+		filter.Pinned = &p
+	}
+	if a.Has("--archived") {
+		archived := true
+		filter.Archived = &archived
 	}
 
 	items, err := GetVaultItems(filter)
@@ -152,7 +134,7 @@ func handleVaultList() {
 	}
 
 	if len(items) == 0 {
-		fmt.Println("No items in vault. Save something with: vault save <url>")
+		fmt.Println("No items in vault. Save something with: vault item save <url>")
 		return
 	}
 
@@ -172,8 +154,19 @@ func handleVaultList() {
 			pin = " [pinned]"
 		}
 
+		switch item.MetaStatus {
+		case MetaStatusPending:
+			pin += " [fetching]"
+		case MetaStatusFailed:
+			pin += " [fetch failed]"
+		}
+
 		fmt.Printf("  %s %d. %s%s\n", icon, item.ID, title, pin)
 
+		if item.Snippet != "" {
+			fmt.Printf("     %s\n", SnippetTerminal(item.Snippet))
+		}
+
 		if len(item.Tags) > 0 {
 			tagNames := make([]string, len(item.Tags))
 			for i, t := range item.Tags {
@@ -185,7 +178,7 @@ func handleVaultList() {
 	fmt.Println()
 }
 
-func handleVaultRandom() {
+func handleVaultRandom(*cmdArgs) {
 	item, err := GetRandomVaultItem()
 	if err != nil {
 		fmt.Println("No items in vault to resurface")
@@ -219,19 +212,97 @@ func handleVaultRandom() {
 	fmt.Println()
 }
 
-func handleVaultPin(pin bool) {
-	if len(os.Args) < 3 {
-		if pin {
-			fmt.Println("Usage: vault pin <id>")
-		} else {
-			fmt.Println("Usage: vault unpin <id>")
-		}
+func handleVaultRead(a *cmdArgs) {
+	id, ok := a.ID()
+	if !ok {
 		return
 	}
+	refresh := a.Has("--refresh")
+	keepHTML := a.Has("--html")
 
-	id, err := strconv.ParseInt(os.Args[2], 10, 64)
+	item, err := GetVaultItem(id)
 	if err != nil {
-		fmt.Println("Invalid ID")
+		fmt.Println("Item not found")
+		return
+	}
+
+	snap, err := GetSnapshot(id)
+	if err != nil || refresh {
+		if item.URL == "" {
+			fmt.Println("Nothing to read: item has no URL")
+			return
+		}
+		fmt.Println("Fetching readable copy...")
+		snap, err = CaptureSnapshot(item, keepHTML)
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+	}
+
+	width := terminalWidth()
+	title := snap.Title
+	if title == "" {
+		title = item.MetaTitle
+	}
+
+	fmt.Println()
+	fmt.Println(wrapText(title, width, "  "))
+	if snap.Byline != "" {
+		fmt.Printf("  by %s\n", snap.Byline)
+	}
+	fmt.Printf("  %s\n", snap.URL)
+	fmt.Printf("  %d words, saved %s\n", snap.WordCount, snap.FetchedAt.Format("2006-01-02"))
+	fmt.Println()
+
+	for _, block := range strings.Split(snap.Text, "\n\n") {
+		if strings.Contains(block, "\n") {
+			// Preformatted text keeps its own line breaks
+			for _, line := range strings.Split(block, "\n") {
+				fmt.Printf("    %s\n", line)
+			}
+		} else if strings.HasPrefix(block, "> ") {
+			fmt.Println(wrapText(strings.TrimPrefix(block, "> "), width, "  > "))
+		} else {
+			fmt.Println(wrapText(block, width, "  "))
+		}
+		fmt.Println()
+	}
+}
+
+// terminalWidth reads $COLUMNS, defaulting to 80 and capping long lines
+func terminalWidth() int {
+	width, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || width < 20 {
+		width = 80
+	}
+	if width > 100 {
+		width = 100
+	}
+	return width
+}
+
+// wrapText word-wraps s to width, indenting every line
+func wrapText(s string, width int, indent string) string {
+	var lines []string
+	line := indent
+	for _, word := range strings.Fields(s) {
+		if len(line) > len(indent) && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = indent
+		}
+		if len(line) > len(indent) {
+			line += " "
+		}
+		line += word
+	}
+	lines = append(lines, line)
+	return strings.Join(lines, "\n")
+}
+
+func handleVaultPin(a *cmdArgs, pin bool) {
+	id, ok := a.ID()
+	if !ok {
 		return
 	}
 
@@ -249,19 +320,9 @@ func handleVaultPin(pin bool) {
 	}
 }
 
-func handleVaultArchive(archive bool) {
-	if len(os.Args) < 3 {
-		if archive {
-			fmt.Println("Usage: vault archive <id>")
-		} else {
-			fmt.Println("Usage: vault unarchive <id>")
-		}
-		return
-	}
-
-	id, err := strconv.ParseInt(os.Args[2], 10, 64)
-	if err != nil {
-		fmt.Println("Invalid ID")
+func handleVaultArchive(a *cmdArgs, archive bool) {
+	id, ok := a.ID()
+	if !ok {
 		return
 	}
 
@@ -279,15 +340,9 @@ func handleVaultArchive(archive bool) {
 	}
 }
 
-func handleVaultDelete() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage: vault rm <id>")
-		return
-	}
-
-	id, err := strconv.ParseInt(os.Args[2], 10, 64)
-	if err != nil {
-		fmt.Println("Invalid ID")
+func handleVaultDelete(a *cmdArgs) {
+	id, ok := a.ID()
+	if !ok {
 		return
 	}
 
@@ -305,7 +360,115 @@ func handleVaultDelete() {
 	fmt.Printf("Deleted [%d] %s\n", id, title)
 }
 
-func handleVaultTags() {
+// handleVaultWorker processes every due metadata fetch and exits
+func handleVaultWorker(a *cmdArgs) {
+	if a.Has("--once") {
+		RunPendingFetches(logFetchError)
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := RunFetchWorker(ctx, a.Has("--drain"), logFetchError); err != nil {
+		fmt.Println("Error:", err)
+	}
+}
+
+func handleVaultRefetch(a *cmdArgs) {
+	if a.Has("--failed") {
+		n, err := EnqueueFailedFetches()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if n == 0 {
+			fmt.Println("No failed fetches")
+			return
+		}
+		fmt.Printf("Retrying %d failed fetches...\n", n)
+	} else {
+		id, ok := a.ID()
+		if !ok {
+			return
+		}
+		item, err := GetVaultItem(id)
+		if err != nil {
+			fmt.Println("Item not found")
+			return
+		}
+		if item.URL == "" {
+			fmt.Println("Item has no URL to fetch")
+			return
+		}
+		if err := EnqueueFetch(id, false); err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		fmt.Printf("Refetching [%d] %s...\n", id, item.URL)
+	}
+
+	RunPendingFetches(func(job *FetchJob, err error) {
+		if err != nil {
+			fmt.Printf("  [%d] error: %v\n", job.ItemID, err)
+			return
+		}
+		item, err := GetVaultItem(job.ItemID)
+		if err != nil {
+			return
+		}
+		switch item.MetaStatus {
+		case MetaStatusOK:
+			fmt.Printf("  [%d] ok: %s\n", item.ID, item.MetaTitle)
+		case MetaStatusPending:
+			fmt.Printf("  [%d] failed (attempt %d, will retry): %s\n", item.ID, item.MetaAttempts, item.MetaError)
+		case MetaStatusFailed:
+			fmt.Printf("  [%d] failed after %d attempts: %s\n", item.ID, item.MetaAttempts, item.MetaError)
+		}
+	})
+}
+
+func handleVaultDedupe(a *cmdArgs) {
+	dryRun := a.Has("-n")
+
+	groups, err := FindDuplicates()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	if len(groups) == 0 {
+		fmt.Println("No duplicates found")
+		if !dryRun {
+			// Still fill canonical URLs the migration had to leave empty
+			if err := MergeDuplicates(nil); err != nil {
+				fmt.Println("Error:", err)
+			}
+		}
+		return
+	}
+
+	fmt.Println()
+	merged := 0
+	for _, g := range groups {
+		fmt.Printf("  %s\n", truncateStr(g.Canonical, 70))
+		fmt.Printf("    keep   [%d]\n", g.Keep.ID)
+		for _, d := range g.Dupes {
+			fmt.Printf("    merge  [%d] %s\n", d.ID, truncateStr(d.URL, 60))
+			merged++
+		}
+	}
+	fmt.Println()
+
+	if dryRun {
+		fmt.Printf("%d duplicates in %d groups (dry run, nothing changed)\n", merged, len(groups))
+		return
+	}
+	if err := MergeDuplicates(groups); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Merged %d duplicates into %d items\n", merged, len(groups))
+}
+
+func handleVaultTags(*cmdArgs) {
 	tags, err := GetAllTags()
 	if err != nil {
 		fmt.Println("Error:", err)
@@ -324,23 +487,125 @@ func handleVaultTags() {
 	fmt.Println()
 }
 
-func handleVaultSetTags() {
-	if len(os.Args) < 4 {
-		fmt.Println("Usage: vault tag <id> <tag1,tag2,...>")
+func handleVaultSetTags(a *cmdArgs) {
+	if a.Arg(1) == "" {
+		a.Usage()
 		return
 	}
-
-	id, err := strconv.ParseInt(os.Args[2], 10, 64)
-	if err != nil {
-		fmt.Println("Invalid ID")
+	id, ok := a.ID()
+	if !ok {
 		return
 	}
 
-	tags := strings.Split(os.Args[3], ",")
+	tags := strings.Split(a.Arg(1), ",")
 	SetItemTags(id, tags)
 	fmt.Printf("Updated tags for [%d]: %s\n", id, strings.Join(tags, ", "))
 }
 
+func handleMigrate(a *cmdArgs) {
+	sub := a.Arg(0)
+	if sub == "" {
+		sub = "status"
+	}
+
+	// status only reads, so it doesn't create a missing database either
+	if sub == "status" {
+		path, err := resolveDBPath()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		if !fileExists(path) {
+			fmt.Printf("\nSchema version: unversioned (binary supports %d)\n", LatestSchemaVersion())
+			fmt.Printf("  No database at %s yet\n\n", path)
+			return
+		}
+	}
+	if err := OpenDB(); err != nil {
+		fmt.Println("Error opening database:", err)
+		os.Exit(1)
+	}
+	defer CloseDB()
+
+	switch sub {
+	case "status":
+		versioned, err := IsVersioned()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		current, err := CurrentSchemaVersion()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+		statuses, err := GetMigrationStatus()
+		if err != nil {
+			fmt.Println("Error:", err)
+			return
+		}
+
+		if versioned {
+			fmt.Printf("\nSchema version: %d (binary supports %d)\n", current, LatestSchemaVersion())
+		} else {
+			fmt.Printf("\nSchema version: unversioned (binary supports %d)\n", LatestSchemaVersion())
+		}
+		if current > LatestSchemaVersion() {
+			fmt.Println("  Database is newer than this binary; please upgrade vault")
+		}
+		fmt.Println()
+		for _, s := range statuses {
+			if s.Applied {
+				fmt.Printf("  [x] %3d %s (applied %s)\n", s.Version, s.Name, s.AppliedAt.Format("2006-01-02 15:04"))
+			} else {
+				fmt.Printf("  [ ] %3d %s\n", s.Version, s.Name)
+			}
+		}
+		fmt.Println()
+	case "up":
+		before, _ := CurrentSchemaVersion()
+		if err := Migrate(); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		after, _ := CurrentSchemaVersion()
+		if after == before {
+			fmt.Printf("Already up to date (version %d)\n", after)
+		} else {
+			fmt.Printf("Migrated from version %d to %d\n", before, after)
+		}
+	default:
+		a.Usage()
+	}
+}
+
+func handleVaultProfiles(*cmdArgs) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+
+	fmt.Printf("\nDatabase: %s\n", dbPath)
+	fmt.Printf("Config:   %s\n\n", configPath())
+
+	names := ProfileNames(cfg)
+	if len(names) == 0 {
+		fmt.Println("  No profiles yet. Create one with: vault --profile <name> item list")
+		fmt.Println()
+		return
+	}
+	for _, name := range names {
+		path, _ := profileDBPath(cfg, name)
+		marker := " "
+		if path == dbPath {
+			marker = "*"
+		}
+		fmt.Printf("  %s %-12s %s\n", marker, name, path)
+	}
+	fmt.Println()
+}
+
 func getTypeIcon(t ContentType) string {
 	switch t {
 	case ContentTypeTweet:
@@ -358,38 +623,19 @@ func getTypeIcon(t ContentType) string {
 	}
 }
 
+// truncateStr shortens s to max characters, ending it with "..." when it
+// had to be cut. It counts runes, so multi-byte text is never split.
 func truncateStr(s string, max int) string {
-	if len(s) <= max {
+	if utf8.RuneCountInString(s) <= max {
 		return s
 	}
-	return s[:max-3] + "..."
+	return string([]rune(s)[:max-3]) + "..."
 }
 
-func printVaultUsage() {
-	fmt.Println(`vault - personal content manager
-
-Vault Commands:
-  vault save <url> [-t tags] [-p]   Save a link (auto-detects type)
-  vault note <text> [-t tags] [-p]  Save a quick note
-  vault list [-t type] [--tags x]   List saved items
-  vault random                      Resurface a random old item
-  vault pin <id>                    Pin an item
-  vault unpin <id>                  Unpin an item
-  vault archive <id>                Archive an item
-  vault rm <id>                     Delete an item
-  vault tags                        List all tags
-  vault tag <id> <tags>             Set tags for an item
-  vault server                      Start web UI
-
-Todo Commands (still work):
-  vault add <task> [-p priority] [-c category] [-d due]
-  vault list [-s status] [-p priority] [-c category]
-  vault done <id>
-  vault rm <id>
-
-Examples:
-  vault save "https://youtube.com/watch?v=..." -t music,favorites
-  vault note "Great idea for app" -t ideas -p
-  vault list --tags coding
-  vault random`)
+// splitTags splits a comma-separated tag list; empty gives none
+func splitTags(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
 }
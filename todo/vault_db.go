@@ -8,9 +8,8 @@ import (
 	"time"
 )
 
-// InitVaultDB creates vault tables
-func InitVaultDB() error {
-	schema := `
+// vaultSchema holds the vault tables (migration 2)
+const vaultSchema = `
 	CREATE TABLE IF NOT EXISTS vault_items (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		content_type TEXT NOT NULL,
@@ -47,27 +46,57 @@ func InitVaultDB() error {
 	CREATE INDEX IF NOT EXISTS idx_vault_pinned ON vault_items(pinned);
 	CREATE INDEX IF NOT EXISTS idx_vault_archived ON vault_items(archived);
 	`
-	_, err := db.Exec(schema)
-	return err
-}
 
-// CreateVaultItem creates a new vault item with optional tags
+// snapshotSchema stores readable copies of saved articles (migration 4)
+const snapshotSchema = `
+	CREATE TABLE snapshots (
+		item_id INTEGER PRIMARY KEY,
+		url TEXT NOT NULL,
+		title TEXT DEFAULT '',
+		byline TEXT DEFAULT '',
+		text TEXT NOT NULL,
+		html TEXT DEFAULT '',
+		word_count INTEGER DEFAULT 0,
+		fetched_at TEXT NOT NULL,
+		FOREIGN KEY (item_id) REFERENCES vault_items(id) ON DELETE CASCADE
+	);
+	`
+
+// CreateVaultItem creates a new vault item with optional tags. If a link
+// with the same canonical URL is already saved, the tags are added to that
+// item instead and it is returned with Duplicate set.
 func CreateVaultItem(item *VaultItem, tagNames []string) (*VaultItem, error) {
 	now := time.Now()
+	if item.MetaStatus == "" {
+		item.MetaStatus = MetaStatusOK
+	}
+	if item.URL != "" {
+		item.CanonicalURL = CanonicalizeURL(item.URL)
+		if existing, err := GetVaultItemByCanonicalURL(item.CanonicalURL); err == nil {
+			return mergeIntoExisting(existing, tagNames)
+		}
+	}
+
 	result, err := db.Exec(`
 		INSERT INTO vault_items (
-			content_type, title, content, url,
+			content_type, title, content, url, original_url, canonical_url,
 			meta_title, meta_description, meta_thumbnail,
-			meta_author, meta_site_name,
+			meta_author, meta_site_name, thumb_hash, meta_status,
 			pinned, archived, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		item.ContentType, item.Title, item.Content, item.URL,
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		item.ContentType, item.Title, item.Content, item.URL, item.OriginalURL, item.CanonicalURL,
 		item.MetaTitle, item.MetaDescription, item.MetaThumbnail,
-		item.MetaAuthor, item.MetaSiteName,
+		item.MetaAuthor, item.MetaSiteName, item.ThumbHash, item.MetaStatus,
 		item.Pinned, item.Archived,
 		now.Format(time.RFC3339), now.Format(time.RFC3339),
 	)
 	if err != nil {
+		// Lost a race with a concurrent save of the same link
+		if item.CanonicalURL != "" && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			if existing, lookupErr := GetVaultItemByCanonicalURL(item.CanonicalURL); lookupErr == nil {
+				return mergeIntoExisting(existing, tagNames)
+			}
+		}
 		return nil, err
 	}
 
@@ -93,15 +122,51 @@ func CreateVaultItem(item *VaultItem, tagNames []string) (*VaultItem, error) {
 	return item, nil
 }
 
+// mergeIntoExisting adds tags from a repeated save to the existing item
+func mergeIntoExisting(existing *VaultItem, tagNames []string) (*VaultItem, error) {
+	for _, tagName := range tagNames {
+		tagName = strings.TrimSpace(tagName)
+		if tagName == "" {
+			continue
+		}
+		tag, err := GetOrCreateTag(tagName)
+		if err != nil {
+			continue
+		}
+		AddTagToItem(existing.ID, tag.ID)
+	}
+	existing.Tags, _ = GetTagsForItem(existing.ID)
+	existing.Duplicate = true
+	return existing, nil
+}
+
 // GetVaultItems retrieves items with filtering
 func GetVaultItems(filter VaultFilter) ([]VaultItem, error) {
-	query := `SELECT DISTINCT vi.id, vi.content_type, vi.title, vi.content, vi.url,
-		vi.meta_title, vi.meta_description, vi.meta_thumbnail, vi.meta_author, vi.meta_site_name,
-		vi.pinned, vi.archived, vi.created_at, vi.updated_at
-		FROM vault_items vi`
 	args := []interface{}{}
 	where := []string{"1=1"}
 
+	// Full-text search joins the FTS index and ranks by relevance. A search
+	// of only exclusions filters all items; one with nothing searchable in
+	// it matches nothing rather than everything.
+	ftsQuery, ftsExclude := "", ""
+	if filter.Search != "" {
+		ftsQuery, ftsExclude = buildFTSQuery(filter.Search)
+		if ftsQuery == "" && ftsExclude == "" {
+			return nil, nil
+		}
+	}
+
+	query := "SELECT DISTINCT " + vaultItemColumns("vi")
+	if ftsQuery != "" {
+		query += `,
+		snippet(vault_fts, -1, '` + snippetStart + `', '` + snippetEnd + `', '...', 16) AS snippet,
+		bm25(vault_fts, 10.0, 1.0, 10.0, 3.0, 5.0) AS rank`
+	}
+	query += " FROM vault_items vi"
+	if ftsQuery != "" {
+		query += " JOIN vault_fts ON vault_fts.rowid = vi.id"
+	}
+
 	// Tag filtering requires join
 	if len(filter.TagNames) > 0 {
 		query += " LEFT JOIN item_tags it ON vi.id = it.item_id LEFT JOIN tags t ON it.tag_id = t.id"
@@ -133,14 +198,21 @@ func GetVaultItems(filter VaultFilter) ([]VaultItem, error) {
 		where = append(where, fmt.Sprintf("LOWER(t.name) IN (%s)", strings.Join(placeholders, ",")))
 	}
 
-	if filter.Search != "" {
-		where = append(where, "(vi.title LIKE ? OR vi.content LIKE ? OR vi.meta_title LIKE ? OR vi.meta_description LIKE ?)")
-		searchTerm := "%" + filter.Search + "%"
-		args = append(args, searchTerm, searchTerm, searchTerm, searchTerm)
+	if ftsQuery != "" {
+		where = append(where, "vault_fts MATCH ?")
+		args = append(args, ftsQuery)
+	}
+	if ftsExclude != "" {
+		where = append(where, "vi.id NOT IN (SELECT rowid FROM vault_fts WHERE vault_fts MATCH ?)")
+		args = append(args, ftsExclude)
 	}
 
 	query += " WHERE " + strings.Join(where, " AND ")
-	query += " ORDER BY vi.pinned DESC, vi.created_at DESC"
+	if ftsQuery != "" {
+		query += " ORDER BY rank, vi.pinned DESC, vi.created_at DESC"
+	} else {
+		query += " ORDER BY vi.pinned DESC, vi.created_at DESC"
+	}
 
 	if filter.Limit > 0 {
 		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
@@ -157,7 +229,17 @@ func GetVaultItems(filter VaultFilter) ([]VaultItem, error) {
 
 	var items []VaultItem
 	for rows.Next() {
-		item, err := scanVaultItem(rows)
+		var item *VaultItem
+		if ftsQuery != "" {
+			var rank float64
+			var snippet string
+			item, err = scanVaultItem(rows, &snippet, &rank)
+			if item != nil {
+				item.Snippet = snippet
+			}
+		} else {
+			item, err = scanVaultItem(rows)
+		}
 		if err != nil {
 			continue
 		}
@@ -169,12 +251,9 @@ func GetVaultItems(filter VaultFilter) ([]VaultItem, error) {
 
 // GetVaultItem gets a single item by ID
 func GetVaultItem(id int64) (*VaultItem, error) {
-	row := db.QueryRow(`SELECT id, content_type, title, content, url,
-		meta_title, meta_description, meta_thumbnail, meta_author, meta_site_name,
-		pinned, archived, created_at, updated_at
-		FROM vault_items WHERE id = ?`, id)
+	row := db.QueryRow(`SELECT `+vaultItemColumns("")+` FROM vault_items WHERE id = ?`, id)
 
-	item, err := scanVaultItemRow(row)
+	item, err := scanVaultItem(row)
 	if err != nil {
 		return nil, err
 	}
@@ -188,17 +267,82 @@ func UpdateVaultItem(id int64, item *VaultItem) error {
 	_, err := db.Exec(`UPDATE vault_items SET
 		title=?, content=?, url=?,
 		meta_title=?, meta_description=?, meta_thumbnail=?,
-		meta_author=?, meta_site_name=?,
+		meta_author=?, meta_site_name=?, thumb_hash=?,
 		pinned=?, archived=?, updated_at=?
 		WHERE id=?`,
 		item.Title, item.Content, item.URL,
 		item.MetaTitle, item.MetaDescription, item.MetaThumbnail,
-		item.MetaAuthor, item.MetaSiteName,
+		item.MetaAuthor, item.MetaSiteName, item.ThumbHash,
 		item.Pinned, item.Archived, now.Format(time.RFC3339), id,
 	)
 	return err
 }
 
+// UpdateVaultItemURL stores a late short-link resolution: the new URL,
+// the short link it came from and the re-detected type. If another item is
+// already saved under the resolved link, this one is a duplicate of it: its
+// tags and pin are moved over, it is deleted, and the existing item is
+// returned with Duplicate set.
+func UpdateVaultItemURL(item *VaultItem) (*VaultItem, error) {
+	now := time.Now().Format(time.RFC3339)
+	canonical := CanonicalizeURL(item.URL)
+	if existing, err := GetVaultItemByCanonicalURL(canonical); err == nil && existing.ID != item.ID {
+		return mergeDuplicateItem(item, existing)
+	}
+	_, err := db.Exec(`UPDATE vault_items SET url=?, original_url=?, canonical_url=?, content_type=?, updated_at=? WHERE id=?`,
+		item.URL, item.OriginalURL, canonical, item.ContentType, now, item.ID)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		// Lost a race with a concurrent save of the same link
+		if existing, lookupErr := GetVaultItemByCanonicalURL(canonical); lookupErr == nil {
+			return mergeDuplicateItem(item, existing)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	item.CanonicalURL = canonical
+	return item, nil
+}
+
+// mergeDuplicateItem folds item into existing, which was saved first
+func mergeDuplicateItem(item, existing *VaultItem) (*VaultItem, error) {
+	tags, err := GetTagsForItem(item.ID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(tags))
+	for i, t := range tags {
+		names[i] = t.Name
+	}
+	if item.Pinned && !existing.Pinned {
+		if err := ToggleVaultItemPin(existing.ID, true); err != nil {
+			return nil, err
+		}
+		existing.Pinned = true
+	}
+	if err := DeleteVaultItem(item.ID); err != nil {
+		return nil, err
+	}
+	return mergeIntoExisting(existing, names)
+}
+
+// UpdateVaultItemMeta stores fetched metadata without touching user-edited fields
+func UpdateVaultItemMeta(item *VaultItem) error {
+	now := time.Now()
+	_, err := db.Exec(`UPDATE vault_items SET
+		meta_title=?, meta_description=?, meta_thumbnail=?,
+		meta_author=?, meta_site_name=?,
+		meta_published_at=?, meta_canonical_url=?, meta_favicon=?, meta_reading_time=?,
+		thumb_hash=?, updated_at=?
+		WHERE id=?`,
+		item.MetaTitle, item.MetaDescription, item.MetaThumbnail,
+		item.MetaAuthor, item.MetaSiteName,
+		item.MetaPublishedAt, item.MetaCanonical, item.MetaFavicon, item.MetaReadingTime,
+		item.ThumbHash, now.Format(time.RFC3339), item.ID,
+	)
+	return err
+}
+
 // ToggleVaultItemPin toggles the pinned status
 func ToggleVaultItemPin(id int64, pinned bool) error {
 	now := time.Now()
@@ -230,13 +374,10 @@ func GetRandomVaultItem() (*VaultItem, error) {
 	}
 
 	offset := rand.Intn(count)
-	row := db.QueryRow(`SELECT id, content_type, title, content, url,
-		meta_title, meta_description, meta_thumbnail, meta_author, meta_site_name,
-		pinned, archived, created_at, updated_at
-		FROM vault_items WHERE archived = FALSE
+	row := db.QueryRow(`SELECT `+vaultItemColumns("")+` FROM vault_items WHERE archived = FALSE
 		LIMIT 1 OFFSET ?`, offset)
 
-	item, err := scanVaultItemRow(row)
+	item, err := scanVaultItem(row)
 	if err != nil {
 		return nil, err
 	}
@@ -244,6 +385,36 @@ func GetRandomVaultItem() (*VaultItem, error) {
 	return item, nil
 }
 
+// SaveSnapshot stores or replaces the readable copy of an item
+func SaveSnapshot(snap *Snapshot) error {
+	_, err := db.Exec(`
+		INSERT INTO snapshots (item_id, url, title, byline, text, html, word_count, fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(item_id) DO UPDATE SET
+			url=excluded.url, title=excluded.title, byline=excluded.byline,
+			text=excluded.text, html=excluded.html,
+			word_count=excluded.word_count, fetched_at=excluded.fetched_at`,
+		snap.ItemID, snap.URL, snap.Title, snap.Byline, snap.Text, snap.HTML,
+		snap.WordCount, snap.FetchedAt.Format(time.RFC3339),
+	)
+	return err
+}
+
+// GetSnapshot returns the readable copy of an item
+func GetSnapshot(itemID int64) (*Snapshot, error) {
+	var snap Snapshot
+	var fetchedAt string
+	err := db.QueryRow(`SELECT item_id, url, title, byline, text, html, word_count, fetched_at
+		FROM snapshots WHERE item_id = ?`, itemID).
+		Scan(&snap.ItemID, &snap.URL, &snap.Title, &snap.Byline, &snap.Text, &snap.HTML,
+			&snap.WordCount, &fetchedAt)
+	if err != nil {
+		return nil, err
+	}
+	snap.FetchedAt, _ = time.Parse(time.RFC3339, fetchedAt)
+	return &snap, nil
+}
+
 // Tag operations
 func GetOrCreateTag(name string) (*Tag, error) {
 	name = strings.TrimSpace(strings.ToLower(name))
@@ -334,37 +505,46 @@ func SetItemTags(itemID int64, tagNames []string) error {
 }
 
 // Helper scan functions
-func scanVaultItem(rows *sql.Rows) (*VaultItem, error) {
-	var item VaultItem
-	var createdAt, updatedAt string
-	var contentType string
-	err := rows.Scan(
-		&item.ID, &contentType, &item.Title, &item.Content, &item.URL,
-		&item.MetaTitle, &item.MetaDescription, &item.MetaThumbnail,
-		&item.MetaAuthor, &item.MetaSiteName,
-		&item.Pinned, &item.Archived,
-		&createdAt, &updatedAt,
-	)
-	if err != nil {
-		return nil, err
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// vaultItemColumns lists the columns scanVaultItem expects, qualified with
+// alias when the query joins other tables
+func vaultItemColumns(alias string) string {
+	cols := []string{
+		"id", "content_type", "title", "content", "url", "original_url", "canonical_url",
+		"meta_title", "meta_description", "meta_thumbnail", "meta_author", "meta_site_name",
+		"meta_published_at", "meta_canonical_url", "meta_favicon", "meta_reading_time",
+		"thumb_hash", "meta_status", "meta_error", "meta_attempts",
+		"pinned", "archived", "created_at", "updated_at",
 	}
-	item.ContentType = ContentType(contentType)
-	item.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
-	item.UpdatedAt, _ = time.Parse(time.RFC3339, updatedAt)
-	return &item, nil
+	if alias != "" {
+		for i, c := range cols {
+			cols[i] = alias + "." + c
+		}
+	}
+	return strings.Join(cols, ", ")
 }
 
-func scanVaultItemRow(row *sql.Row) (*VaultItem, error) {
+// scanVaultItem scans the vaultItemColumns followed by any extra columns
+// the query selected
+func scanVaultItem(row rowScanner, extra ...interface{}) (*VaultItem, error) {
 	var item VaultItem
 	var createdAt, updatedAt string
 	var contentType string
-	err := row.Scan(
-		&item.ID, &contentType, &item.Title, &item.Content, &item.URL,
+	dest := []interface{}{
+		&item.ID, &contentType, &item.Title, &item.Content, &item.URL, &item.OriginalURL, &item.CanonicalURL,
 		&item.MetaTitle, &item.MetaDescription, &item.MetaThumbnail,
 		&item.MetaAuthor, &item.MetaSiteName,
+		&item.MetaPublishedAt, &item.MetaCanonical, &item.MetaFavicon, &item.MetaReadingTime,
+		&item.ThumbHash, &item.MetaStatus, &item.MetaError, &item.MetaAttempts,
 		&item.Pinned, &item.Archived,
 		&createdAt, &updatedAt,
-	)
+	}
+	err := row.Scan(append(dest, extra...)...)
 	if err != nil {
 		return nil, err
 	}
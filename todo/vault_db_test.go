@@ -0,0 +1,71 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestUpdateVaultItemURLMergesDuplicate(t *testing.T) {
+	openTestDB(t)
+
+	first, err := CreateVaultItem(&VaultItem{ContentType: ContentTypeArticle, URL: "https://example.com/post"}, []string{"read"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	short, err := CreateVaultItem(&VaultItem{ContentType: ContentTypeArticle, URL: "https://bit.ly/abc", Pinned: true}, []string{"later"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The short link resolves to the item that is already saved
+	short.OriginalURL = short.URL
+	short.URL = "https://example.com/post?utm_source=x"
+	got, err := UpdateVaultItemURL(short)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Duplicate || got.ID != first.ID {
+		t.Fatalf("UpdateVaultItemURL returned item %d (duplicate %v), want %d as a duplicate", got.ID, got.Duplicate, first.ID)
+	}
+	if _, err := GetVaultItem(short.ID); err != sql.ErrNoRows {
+		t.Errorf("short-link item still exists (err %v)", err)
+	}
+	merged, err := GetVaultItem(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !merged.Pinned {
+		t.Error("pin was not carried over")
+	}
+	tags := map[string]bool{}
+	for _, tag := range merged.Tags {
+		tags[tag.Name] = true
+	}
+	if !tags["read"] || !tags["later"] {
+		t.Errorf("tags = %v, want read and later", merged.Tags)
+	}
+}
+
+func TestUpdateVaultItemURLStoresCanonical(t *testing.T) {
+	openTestDB(t)
+
+	item, err := CreateVaultItem(&VaultItem{ContentType: ContentTypeArticle, URL: "https://bit.ly/abc"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item.OriginalURL = item.URL
+	item.URL = "https://example.com/post"
+	if _, err := UpdateVaultItemURL(item); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetVaultItemByCanonicalURL("https://example.com/post"); err != nil {
+		t.Errorf("resolved URL not findable by canonical URL: %v", err)
+	}
+	again, err := CreateVaultItem(&VaultItem{ContentType: ContentTypeArticle, URL: "https://example.com/post#top"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Duplicate || again.ID != item.ID {
+		t.Errorf("saving the resolved URL again gave item %d (duplicate %v), want %d", again.ID, again.Duplicate, item.ID)
+	}
+}
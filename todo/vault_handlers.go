@@ -39,14 +39,20 @@ func handleAPIVault(w http.ResponseWriter, r *http.Request) {
 		if items == nil {
 			items = []VaultItem{}
 		}
+		for i := range items {
+			if items[i].Snippet != "" {
+				items[i].Snippet = SnippetHTML(items[i].Snippet)
+			}
+		}
 		json.NewEncoder(w).Encode(items)
 
 	case "POST":
 		var input struct {
-			Content string   `json:"content"`
-			Title   string   `json:"title"`
-			Tags    []string `json:"tags"`
-			Pinned  bool     `json:"pinned"`
+			Content      string   `json:"content"`
+			Title        string   `json:"title"`
+			Tags         []string `json:"tags"`
+			Pinned       bool     `json:"pinned"`
+			SnapshotHTML bool     `json:"snapshot_html"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -57,7 +63,7 @@ func handleAPIVault(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Detect content type
+		// Detect content type; short links are resolved by the fetch job
 		contentType := DetectContentType(input.Content)
 
 		item := &VaultItem{
@@ -67,18 +73,10 @@ func handleAPIVault(w http.ResponseWriter, r *http.Request) {
 			Pinned:      input.Pinned,
 		}
 
-		// Set URL if it's a link type
+		// Links are saved immediately; metadata is fetched in the background
 		if contentType != ContentTypeNote {
-			item.URL = input.Content
-			// Fetch metadata
-			meta := FetchMetadata(input.Content, contentType)
-			if meta != nil {
-				item.MetaTitle = meta.Title
-				item.MetaDescription = meta.Description
-				item.MetaThumbnail = meta.Thumbnail
-				item.MetaAuthor = meta.Author
-				item.MetaSiteName = meta.SiteName
-			}
+			item.URL = strings.TrimSpace(input.Content)
+			item.MetaStatus = MetaStatusPending
 		}
 
 		saved, err := CreateVaultItem(item, input.Tags)
@@ -86,6 +84,16 @@ func handleAPIVault(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if saved.Duplicate {
+			json.NewEncoder(w).Encode(saved)
+			return
+		}
+		if saved.URL != "" {
+			if err := EnqueueFetch(saved.ID, input.SnapshotHTML); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(saved)
 
@@ -97,14 +105,38 @@ func handleAPIVault(w http.ResponseWriter, r *http.Request) {
 func handleAPIVaultItem(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Extract ID from path: /api/vault/123
+	// Extract ID from path: /api/vault/123 or /api/vault/123/snapshot
 	path := strings.TrimPrefix(r.URL.Path, "/api/vault/")
+	path, sub, _ := strings.Cut(path, "/")
 	id, err := strconv.ParseInt(path, 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid ID", http.StatusBadRequest)
 		return
 	}
 
+	switch sub {
+	case "":
+	case "snapshot":
+		handleAPIVaultSnapshot(w, r, id)
+		return
+	case "refetch":
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := EnqueueFetch(id, false); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		item, _ := GetVaultItem(id)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(item)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		item, err := GetVaultItem(id)
@@ -182,6 +214,36 @@ func handleAPIVaultItem(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handleAPIVaultSnapshot serves the readable copy of an item.
+// POST re-fetches the page and replaces the stored copy.
+func handleAPIVaultSnapshot(w http.ResponseWriter, r *http.Request, id int64) {
+	switch r.Method {
+	case "GET":
+		snap, err := GetSnapshot(id)
+		if err != nil {
+			http.Error(w, "No snapshot", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(snap)
+
+	case "POST":
+		item, err := GetVaultItem(id)
+		if err != nil {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		snap, err := CaptureSnapshot(item, r.URL.Query().Get("html") == "true")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(snap)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 func handleAPIVaultResurface(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -204,7 +266,7 @@ func handleAPIVaultDetect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	contentType := DetectContentType(input.Content)
+	link, contentType, _ := DetectLink(input.Content)
 
 	result := map[string]interface{}{
 		"content_type": contentType,
@@ -212,13 +274,20 @@ func handleAPIVaultDetect(w http.ResponseWriter, r *http.Request) {
 
 	// Fetch metadata preview if it's a URL
 	if contentType != ContentTypeNote {
-		meta := FetchMetadata(input.Content, contentType)
+		if link != strings.TrimSpace(input.Content) {
+			result["url"] = link
+		}
+		meta, _ := FetchMetadata(link, contentType)
 		if meta != nil {
 			result["meta_title"] = meta.Title
 			result["meta_description"] = meta.Description
 			result["meta_thumbnail"] = meta.Thumbnail
 			result["meta_author"] = meta.Author
 			result["meta_site_name"] = meta.SiteName
+			result["meta_published_at"] = meta.PublishedAt
+			result["meta_canonical_url"] = meta.CanonicalURL
+			result["meta_favicon"] = meta.Favicon
+			result["meta_reading_time"] = meta.ReadingTime
 		}
 	}
 